@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+	"view_count/auth"
+	"view_count/model"
+	"view_count/repository/apikeyrepository"
+
+	"github.com/spf13/cobra"
+)
+
+// newAPIKeyCmd returns the apikey command, which manages the keys the
+// server authenticates clients with.
+func newAPIKeyCmd(repo apikeyrepository.Repository) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apikey",
+		Short: "Manage API keys",
+	}
+
+	var name, role string
+	create := &cobra.Command{
+		Use:          "create",
+		Short:        "Create an API key and print it once",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := auth.ParseRole(role)
+			if err != nil {
+				return err
+			}
+			key, err := auth.GenerateKey()
+			if err != nil {
+				return err
+			}
+			k, err := repo.CreateAPIKey(cmd.Context(), model.APIKey{Name: name, Role: string(r), Hash: auth.HashKey(key)})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "id:   %s\nrole: %s\nkey:  %s\n\nThe key is not stored and cannot be shown again.\n", k.Id, k.Role, key)
+			return nil
+		},
+	}
+	create.Flags().StringVar(&name, "name", "", "what the key is for")
+	create.Flags().StringVar(&role, "role", string(auth.RoleReader), "role of the key: reader, writer or admin")
+
+	list := &cobra.Command{
+		Use:          "list",
+		Short:        "List API keys",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keys, err := repo.ListAPIKeys(cmd.Context())
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tNAME\tROLE\tCREATED\tLAST USED\tREVOKED")
+			for _, k := range keys {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", k.Id, k.Name, k.Role,
+					formatTime(k.CreatedAt), formatTime(k.LastUsedAt), formatTime(k.RevokedAt))
+			}
+			return w.Flush()
+		},
+	}
+
+	revoke := &cobra.Command{
+		Use:          "revoke [id]",
+		Short:        "Revoke an API key",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := repo.RevokeAPIKey(cmd.Context(), args[0]); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "revoked %s\n", args[0])
+			return nil
+		},
+	}
+
+	cmd.AddCommand(create, list, revoke)
+	return cmd
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,315 @@
+// Package apiv1 serves version 1 of the JSON API below /v1. Successful
+// responses wrap their payload in an envelope with a data member and, for
+// lists, a meta member; errors are RFC 7807 problem details.
+package apiv1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"view_count/auth"
+	"view_count/model"
+	"view_count/negotiate"
+	"view_count/problem"
+	"view_count/ratelimit"
+	"view_count/viewservice"
+
+	"github.com/gorilla/mux"
+)
+
+// Prefix is the path prefix of the API.
+const Prefix = "/v1"
+
+const defaultN = 10
+
+// Config configures a Handler.
+type Config struct {
+	// Policy gives the roles the routes require.
+	Policy auth.Policy
+	// MaxN caps the n of the top and recent lists.
+	MaxN int
+	// MaxBatchSize caps the ids of one lookup of several videos.
+	MaxBatchSize int
+	// IdempotencyTTL is how long Idempotency-Key values are remembered.
+	IdempotencyTTL time.Duration
+}
+
+// Handler serves the routes of the API.
+type Handler struct {
+	svc viewservice.Service
+	cfg Config
+}
+
+func NewHandler(svc viewservice.Service, cfg Config) *Handler {
+	return &Handler{svc: svc, cfg: cfg}
+}
+
+type envelope struct {
+	Data any   `json:"data"`
+	Meta *meta `json:"meta,omitempty"`
+}
+
+type meta struct {
+	Count int `json:"count"`
+}
+
+type video struct {
+	Id    string `json:"id"`
+	Views int    `json:"views"`
+}
+
+type rank struct {
+	Id       string `json:"id"`
+	Views    int    `json:"views"`
+	Position int    `json:"position"`
+	Ties     int    `json:"ties"`
+}
+
+type increment struct {
+	Id       string `json:"id"`
+	Replayed bool   `json:"replayed"`
+}
+
+func toVideos(infos []model.VideoInfo) []video {
+	videos := make([]video, 0, len(infos))
+	for _, info := range infos {
+		videos = append(videos, video{Id: info.Id, Views: info.Views})
+	}
+	return videos
+}
+
+// Register adds the routes below Prefix to r. Unknown paths and methods
+// below Prefix are answered with problem details too; the problem
+// middleware must be installed on r for auth and rate limiting to do so.
+func (h *Handler) Register(r *mux.Router) {
+	v1 := r.PathPrefix(Prefix).Subrouter()
+	v1.Use(acceptJSON)
+
+	reads := auth.Require(h.cfg.Policy.Reads)
+	v1.Handle("/videos", reads(http.HandlerFunc(h.listVideos))).Methods("GET")
+	v1.Handle("/videos/{id}", reads(http.HandlerFunc(h.getVideo))).Methods("GET")
+	v1.Handle("/videos/{id}/rank", reads(http.HandlerFunc(h.getRank))).Methods("GET")
+	v1.Handle("/videos/{id}/views", auth.Require(h.cfg.Policy.Increment)(http.HandlerFunc(h.increment))).Methods("POST")
+	v1.Handle("/top", reads(http.HandlerFunc(h.topVideos))).Methods("GET")
+	v1.Handle("/recent", reads(http.HandlerFunc(h.recentVideos))).Methods("GET")
+
+	v1.NotFoundHandler = unmatched(v1)
+	v1.MethodNotAllowedHandler = v1.NotFoundHandler
+}
+
+// unmatched replies 405 with an Allow header when a route of r has the
+// request's path and 404 otherwise. mux cannot tell the two apart below a
+// subrouter: the prefix matcher it copies into every route clears the
+// method mismatch of the routes before.
+func unmatched(r *mux.Router) http.Handler {
+	type route struct {
+		path    *regexp.Regexp
+		methods []string
+	}
+	var routes []route
+	r.Walk(func(rt *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		expr, err := rt.GetPathRegexp()
+		if err != nil {
+			return nil
+		}
+		methods, _ := rt.GetMethods()
+		routes = append(routes, route{regexp.MustCompile(expr), methods})
+		return nil
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var allow []string
+		for _, rt := range routes {
+			if rt.path.MatchString(r.URL.Path) {
+				allow = append(allow, rt.methods...)
+			}
+		}
+		if len(allow) == 0 {
+			problem.Write(w, r, problem.New("", http.StatusNotFound, ""))
+			return
+		}
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		problem.Write(w, r, problem.New("", http.StatusMethodNotAllowed, ""))
+	})
+}
+
+// acceptJSON rejects requests that accept neither JSON nor problem
+// details with 406.
+func acceptJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if negotiate.Best(r.Header.Get("Accept"), "application/json", problem.ContentType) == "" {
+			problem.Write(w, r, problem.New("", http.StatusNotAcceptable, "responses are application/json"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// listVideos lists every video or, given id parameters, those videos in
+// the order asked for.
+func (h *Handler) listVideos(w http.ResponseWriter, r *http.Request) {
+	if ids := r.URL.Query()["id"]; len(ids) > 0 {
+		h.lookupVideos(w, r, ids)
+		return
+	}
+	infos, err := h.svc.GetAllViews(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeList(w, toVideos(infos))
+}
+
+func (h *Handler) lookupVideos(w http.ResponseWriter, r *http.Request, ids []string) {
+	if len(ids) > h.cfg.MaxBatchSize {
+		problem.Write(w, r, problem.New(problem.TypeInvalidArgument, http.StatusBadRequest,
+			"at most "+strconv.Itoa(h.cfg.MaxBatchSize)+" ids may be given"))
+		return
+	}
+	views, err := h.svc.GetViews(r.Context(), ids)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	videos := make([]video, len(ids))
+	for i, id := range ids {
+		videos[i] = video{Id: id, Views: views[id]}
+	}
+	writeList(w, videos)
+}
+
+func (h *Handler) getVideo(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	views, err := h.svc.GetView(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeData(w, http.StatusOK, video{Id: id, Views: views})
+}
+
+func (h *Handler) getRank(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	rk, err := h.svc.GetRank(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeData(w, http.StatusOK, rank{Id: rk.Id, Views: rk.Views, Position: rk.Position, Ties: rk.Ties})
+}
+
+func (h *Handler) increment(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	ctx := r.Context()
+	key := r.Header.Get("Idempotency-Key")
+	if key != "" && !viewservice.ValidIdempotencyKey(key) {
+		problem.Write(w, r, problem.New(problem.TypeInvalidIdempotencyKey, http.StatusBadRequest,
+			"Idempotency-Key must be 1 to 255 printable ASCII characters"))
+		return
+	}
+	if token := viewservice.ViewTokenFromRequest(r); token != "" {
+		ctx = viewservice.NewViewTokenContext(ctx, token)
+	}
+
+	var (
+		replayed bool
+		err      error
+	)
+	if key != "" {
+		replayed, err = h.svc.IncrementOnce(ctx, id, key, h.cfg.IdempotencyTTL)
+	} else {
+		err = h.svc.Increment(ctx, id)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+	writeData(w, http.StatusOK, increment{Id: id, Replayed: replayed})
+}
+
+func (h *Handler) topVideos(w http.ResponseWriter, r *http.Request) {
+	n, ok := h.parseN(w, r)
+	if !ok {
+		return
+	}
+	infos, err := h.svc.GetTopVideos(r.Context(), n)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeList(w, toVideos(infos))
+}
+
+func (h *Handler) recentVideos(w http.ResponseWriter, r *http.Request) {
+	n, ok := h.parseN(w, r)
+	if !ok {
+		return
+	}
+	infos, err := h.svc.GetRecentVideos(r.Context(), n)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeList(w, toVideos(infos))
+}
+
+// parseN returns the n query parameter, defaulting to 10 or MaxN if that
+// is less, or replies with 400 when it is not between 1 and MaxN.
+func (h *Handler) parseN(w http.ResponseWriter, r *http.Request) (int, bool) {
+	n := min(defaultN, h.cfg.MaxN)
+	if s := r.URL.Query().Get("n"); s != "" {
+		var err error
+		if n, err = strconv.Atoi(s); err != nil {
+			n = 0
+		}
+	}
+	if n < 1 || n > h.cfg.MaxN {
+		problem.Write(w, r, problem.New(problem.TypeInvalidArgument, http.StatusBadRequest,
+			"n must be between 1 and "+strconv.Itoa(h.cfg.MaxN)))
+		return 0, false
+	}
+	return n, true
+}
+
+// writeError replies with the problem matching an error of the service.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	if retryAfter, limited := ratelimit.RetryAfter(err); limited {
+		ratelimit.WriteTooManyRequests(w, r, retryAfter)
+		return
+	}
+	var p problem.Problem
+	switch {
+	case errors.Is(err, viewservice.ErrInvalidArgument):
+		p = problem.New(problem.TypeInvalidArgument, http.StatusBadRequest, "video id is required")
+	case errors.Is(err, viewservice.ErrVideoNotFound):
+		p = problem.New("", http.StatusNotFound, "video has no views")
+	case errors.Is(err, viewservice.ErrIdempotencyKeyReused):
+		p = problem.New(problem.TypeIdempotencyKeyReused, http.StatusUnprocessableEntity,
+			"Idempotency-Key was already used for another video")
+	case errors.Is(err, viewservice.ErrViewTokenRequired),
+		errors.Is(err, viewservice.ErrViewTokenInvalid),
+		errors.Is(err, viewservice.ErrViewTokenReplayed):
+		p = problem.New(problem.TypeViewTokenRejected, http.StatusForbidden, err.Error())
+	default:
+		p = problem.New("", http.StatusInternalServerError, "")
+	}
+	problem.Write(w, r, p)
+}
+
+func writeData(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(envelope{Data: data})
+}
+
+func writeList(w http.ResponseWriter, videos []video) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(envelope{Data: videos, Meta: &meta{Count: len(videos)}})
+}
@@ -0,0 +1,144 @@
+package apiv1
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"view_count/auth"
+	"view_count/problem"
+	"view_count/ratelimit"
+	"view_count/repository/viewrepository"
+	"view_count/viewservice"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingService fails increments with err.
+type failingService struct {
+	viewservice.Service
+	err error
+}
+
+func (s failingService) Increment(ctx context.Context, videoId string) error {
+	return s.err
+}
+
+func newRouter(svc viewservice.Service) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(problem.Middleware(Prefix + "/"))
+	NewHandler(svc, Config{Policy: auth.DefaultPolicy, MaxN: 5, MaxBatchSize: 3, IdempotencyTTL: time.Minute}).Register(r)
+	return r
+}
+
+func do(t *testing.T, r http.Handler, method, target string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	// requests are made as an admin; TestProblems covers the others.
+	req = req.WithContext(auth.NewContext(req.Context(), auth.Principal{Role: auth.RoleAdmin}))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRoutes(t *testing.T) {
+	vs := viewservice.NewService(viewrepository.NewInmemoryRepo())
+	r := newRouter(vs)
+
+	for _, id := range []string{"video1", "video2", "video1"} {
+		rec := do(t, r, "POST", "/v1/videos/"+id+"/views", nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	for _, tc := range []struct {
+		target string
+		want   string
+	}{
+		{"/v1/videos/video1", `{"data": {"id": "video1", "views": 2}}`},
+		{"/v1/videos/unseen", `{"data": {"id": "unseen", "views": 0}}`},
+		{"/v1/videos/video2/rank", `{"data": {"id": "video2", "views": 1, "position": 2, "ties": 0}}`},
+		{"/v1/top?n=1", `{"data": [{"id": "video1", "views": 2}], "meta": {"count": 1}}`},
+		{"/v1/top", `{"data": [{"id": "video1", "views": 2}, {"id": "video2", "views": 1}], "meta": {"count": 2}}`},
+		{"/v1/videos?id=video2&id=unseen&id=video1", `{"data": [{"id": "video2", "views": 1}, {"id": "unseen", "views": 0}, {"id": "video1", "views": 2}], "meta": {"count": 3}}`},
+	} {
+		rec := do(t, r, "GET", tc.target, http.Header{"Accept": {"application/json"}})
+		assert.Equal(t, http.StatusOK, rec.Code, tc.target)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"), tc.target)
+		assert.JSONEq(t, tc.want, rec.Body.String(), tc.target)
+	}
+
+	// the order of these lists is not fixed for views made this close.
+	for _, target := range []string{"/v1/videos", "/v1/recent"} {
+		rec := do(t, r, "GET", target, nil)
+		var list struct {
+			Data []video
+			Meta meta
+		}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&list))
+		assert.ElementsMatch(t, []video{{"video1", 2}, {"video2", 1}}, list.Data, target)
+		assert.Equal(t, 2, list.Meta.Count, target)
+	}
+
+	t.Run("idempotency", func(t *testing.T) {
+		key := http.Header{"Idempotency-Key": {"k1"}}
+		assert.JSONEq(t, `{"data": {"id": "video3", "replayed": false}}`, do(t, r, "POST", "/v1/videos/video3/views", key).Body.String())
+		rec := do(t, r, "POST", "/v1/videos/video3/views", key)
+		assert.JSONEq(t, `{"data": {"id": "video3", "replayed": true}}`, rec.Body.String())
+		assert.Equal(t, "true", rec.Header().Get("Idempotent-Replayed"))
+	})
+}
+
+func TestProblems(t *testing.T) {
+	vs := viewservice.NewService(viewrepository.NewInmemoryRepo())
+	r := newRouter(vs)
+	limited := &ratelimit.LimitedError{Scope: ratelimit.ScopeVideo, RetryAfter: 2 * time.Second}
+
+	for _, tc := range []struct {
+		name           string
+		router         http.Handler
+		method, target string
+		header         http.Header
+		want           int
+		typ            string
+	}{
+		{"n too large", r, "GET", "/v1/top?n=6", nil, http.StatusBadRequest, problem.TypeInvalidArgument},
+		{"n not a number", r, "GET", "/v1/recent?n=x", nil, http.StatusBadRequest, problem.TypeInvalidArgument},
+		{"too many ids", r, "GET", "/v1/videos?id=a&id=b&id=c&id=d", nil, http.StatusBadRequest, problem.TypeInvalidArgument},
+		{"empty id", r, "GET", "/v1/videos?id=a&id=", nil, http.StatusBadRequest, problem.TypeInvalidArgument},
+		{"not acceptable", r, "GET", "/v1/videos", http.Header{"Accept": {"text/html"}}, http.StatusNotAcceptable, "about:blank"},
+		{"not found", r, "GET", "/v1/nope", nil, http.StatusNotFound, "about:blank"},
+		{"rank of unseen video", r, "GET", "/v1/videos/unseen/rank", nil, http.StatusNotFound, "about:blank"},
+		{"method not allowed", r, "DELETE", "/v1/videos", nil, http.StatusMethodNotAllowed, "about:blank"},
+		{"invalid idempotency key", r, "POST", "/v1/videos/video1/views", http.Header{"Idempotency-Key": {"a b"}}, http.StatusBadRequest, problem.TypeInvalidIdempotencyKey},
+		{"view token", newRouter(failingService{vs, viewservice.ErrViewTokenReplayed}), "POST", "/v1/videos/video1/views", nil, http.StatusForbidden, problem.TypeViewTokenRejected},
+		{"idempotency key reused", newRouter(failingService{vs, viewservice.ErrIdempotencyKeyReused}), "POST", "/v1/videos/video1/views", nil, http.StatusUnprocessableEntity, problem.TypeIdempotencyKeyReused},
+		{"rate limited", newRouter(failingService{vs, limited}), "POST", "/v1/videos/video1/views", nil, http.StatusTooManyRequests, problem.TypeRateLimited},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := do(t, tc.router, tc.method, tc.target, tc.header)
+			assert.Equal(t, tc.want, rec.Code)
+			assert.Equal(t, problem.ContentType, rec.Header().Get("Content-Type"))
+			var p problem.Problem
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&p))
+			assert.Equal(t, tc.typ, p.Type)
+			assert.Equal(t, tc.want, p.Status)
+			assert.Equal(t, strings.SplitN(tc.target, "?", 2)[0], p.Instance)
+		})
+	}
+	assert.Equal(t, "GET", do(t, r, "DELETE", "/v1/videos/video1", nil).Header().Get("Allow"))
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/videos/video1/views", nil))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, problem.ContentType, rec.Header().Get("Content-Type"))
+	})
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+const (
+	// APIKeyHeader is one of the headers API keys are read from, besides
+	// a bearer token in Authorization.
+	APIKeyHeader = "X-API-Key"
+
+	// keyPrefix marks API keys so they are easy to recognise, e.g. by
+	// secret scanners.
+	keyPrefix = "vck_"
+)
+
+// GenerateKey returns a new random API key.
+func GenerateKey() (string, error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return keyPrefix + base64.RawURLEncoding.EncodeToString(b[:]), nil
+}
+
+// HashKey returns the hex SHA-256 of key, which is what the repository
+// stores. Keys have 256 bits of entropy, so an unsalted hash is enough.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// KeyFromRequest returns the API key or JWT of r from APIKeyHeader or a
+// bearer token, or "" if there is none.
+func KeyFromRequest(r *http.Request) string {
+	if k := r.Header.Get(APIKeyHeader); k != "" {
+		return k
+	}
+	if k, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return k
+	}
+	return ""
+}
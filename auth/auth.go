@@ -0,0 +1,112 @@
+// Package auth authenticates API clients and authorizes them by role. The
+// HTTP routes and the go-kit endpoints enforce the same Policy: both find
+// the caller's Principal in the request context and compare its role with
+// the one the operation requires.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Role grants access to a class of operations. Roles are ordered: admin
+// includes writer, which includes reader.
+type Role string
+
+const (
+	// RolePublic requires no authentication at all.
+	RolePublic Role = ""
+	RoleReader Role = "reader"
+	RoleWriter Role = "writer"
+	RoleAdmin  Role = "admin"
+)
+
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrForbidden       = errors.New("insufficient role")
+)
+
+// ParseRole parses one of reader, writer or admin.
+func ParseRole(s string) (Role, error) {
+	switch r := Role(s); r {
+	case RoleReader, RoleWriter, RoleAdmin:
+		return r, nil
+	}
+	return "", fmt.Errorf("unknown role %q, expected %s, %s or %s", s, RoleReader, RoleWriter, RoleAdmin)
+}
+
+func (r Role) rank() int {
+	switch r {
+	case RoleReader:
+		return 1
+	case RoleWriter:
+		return 2
+	case RoleAdmin:
+		return 3
+	}
+	return 0
+}
+
+// Allows reports whether r grants what required does.
+func (r Role) Allows(required Role) bool {
+	return r.rank() >= required.rank()
+}
+
+// Principal is an authenticated caller.
+type Principal struct {
+	// Subject identifies the caller in logs, e.g. "apikey:<id>" or
+	// "jwt:<sub>".
+	Subject string
+	Role    Role
+	// Tenant is the organisation the caller acts for, if its credential
+	// names one.
+	Tenant string
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying p.
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal stored in ctx.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(Principal)
+	return p, ok
+}
+
+// Authorize returns ErrUnauthenticated if ctx carries no principal and
+// ErrForbidden if its role does not allow required. RolePublic is always
+// allowed.
+func Authorize(ctx context.Context, required Role) error {
+	if required == RolePublic {
+		return nil
+	}
+	p, ok := FromContext(ctx)
+	if !ok {
+		return ErrUnauthenticated
+	}
+	if !p.Role.Allows(required) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// Policy is the role every class of operation requires.
+type Policy struct {
+	// Reads covers view counts, rankings and live streams.
+	Reads     Role
+	Increment Role
+	Metrics   Role
+	Admin     Role
+}
+
+// DefaultPolicy keeps reads public and closes everything else.
+var DefaultPolicy = Policy{
+	Reads:     RolePublic,
+	Increment: RoleWriter,
+	Metrics:   RoleReader,
+	Admin:     RoleAdmin,
+}
@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"view_count/model"
+	"view_count/problem"
+	"view_count/repository/apikeyrepository"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createKey(t *testing.T, repo apikeyrepository.Repository, role Role) (string, model.APIKey) {
+	t.Helper()
+	key, err := GenerateKey()
+	require.NoError(t, err)
+	k, err := repo.CreateAPIKey(context.Background(), model.APIKey{Name: string(role), Role: string(role), Hash: HashKey(key)})
+	require.NoError(t, err)
+	return key, k
+}
+
+func TestRole(t *testing.T) {
+	assert.True(t, RoleAdmin.Allows(RoleWriter))
+	assert.True(t, RoleWriter.Allows(RoleReader))
+	assert.True(t, RoleReader.Allows(RolePublic))
+	assert.False(t, RoleReader.Allows(RoleWriter))
+	assert.False(t, RoleWriter.Allows(RoleAdmin))
+
+	_, err := ParseRole("root")
+	assert.Error(t, err)
+	r, err := ParseRole("writer")
+	require.NoError(t, err)
+	assert.Equal(t, RoleWriter, r)
+}
+
+func TestAuthenticator(t *testing.T) {
+	ctx := context.Background()
+	repo := apikeyrepository.NewInmemoryRepo()
+	a := NewAuthenticator(repo, log.NewNopLogger())
+	key, k := createKey(t, repo, RoleWriter)
+
+	assert.True(t, strings.HasPrefix(key, keyPrefix))
+
+	p, err := a.Authenticate(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, Principal{Subject: "apikey:" + k.Id, Role: RoleWriter}, p)
+
+	_, err = a.Authenticate(ctx, "vck_unknown")
+	assert.Equal(t, ErrUnauthenticated, err)
+	_, err = a.Authenticate(ctx, "")
+	assert.Equal(t, ErrUnauthenticated, err)
+
+	t.Run("Last use is recorded by Run", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			a.Run(ctx)
+			close(done)
+		}()
+		defer func() {
+			cancel()
+			<-done
+		}()
+
+		assert.Eventually(t, func() bool {
+			k, err := repo.GetAPIKeyByHash(ctx, HashKey(key))
+			return err == nil && !k.LastUsedAt.IsZero()
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Queued last uses are written when Run stops", func(t *testing.T) {
+		repo := apikeyrepository.NewInmemoryRepo()
+		a := NewAuthenticator(repo, log.NewNopLogger())
+		key, _ := createKey(t, repo, RoleReader)
+		_, err := a.Authenticate(ctx, key)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		assert.ErrorIs(t, a.Run(ctx), context.Canceled)
+
+		k, err := repo.GetAPIKeyByHash(ctx, HashKey(key))
+		require.NoError(t, err)
+		assert.False(t, k.LastUsedAt.IsZero())
+	})
+
+	t.Run("Revoked keys are rejected", func(t *testing.T) {
+		key, k := createKey(t, repo, RoleAdmin)
+		require.NoError(t, repo.RevokeAPIKey(ctx, k.Id))
+
+		_, err := a.Authenticate(ctx, key)
+		assert.Equal(t, ErrUnauthenticated, err)
+	})
+}
+
+func TestRequire(t *testing.T) {
+	repo := apikeyrepository.NewInmemoryRepo()
+	a := NewAuthenticator(repo, log.NewNopLogger())
+	reader, _ := createKey(t, repo, RoleReader)
+	writer, _ := createKey(t, repo, RoleWriter)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := a.Middleware(Require(RoleWriter)(ok))
+
+	for _, tc := range []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{"no key", "", "", http.StatusUnauthorized},
+		{"unknown key", APIKeyHeader, "vck_unknown", http.StatusUnauthorized},
+		{"insufficient role", APIKeyHeader, reader, http.StatusForbidden},
+		{"header", APIKeyHeader, writer, http.StatusOK},
+		{"bearer", "Authorization", "Bearer " + writer, http.StatusOK},
+		{"other scheme", "Authorization", "Basic " + writer, http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/increment/video1", nil)
+			if tc.header != "" {
+				r.Header.Set(tc.header, tc.value)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			assert.Equal(t, tc.want, rec.Code)
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	a.Middleware(Require(RolePublic)(ok)).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	t.Run("problem details", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		problem.Middleware("/v1/")(h).ServeHTTP(rec, httptest.NewRequest("POST", "/v1/videos/video1/views", nil))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, problem.ContentType, rec.Header().Get("Content-Type"))
+		assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+	})
+}
+
+func TestAudit(t *testing.T) {
+	repo := apikeyrepository.NewInmemoryRepo()
+	a := NewAuthenticator(repo, log.NewNopLogger())
+	admin, k := createKey(t, repo, RoleAdmin)
+
+	var buf bytes.Buffer
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	h := a.Middleware(Audit(log.NewLogfmtLogger(&buf))(Require(RoleAdmin)(ok)))
+
+	r := httptest.NewRequest("DELETE", "/admin/webhooks/wh1", nil)
+	r.Header.Set(APIKeyHeader, admin)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/admin/webhooks/wh1", nil))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "subject=apikey:"+k.Id+" role=admin method=DELETE path=/admin/webhooks/wh1 status=204")
+	assert.Contains(t, lines[1], "subject= role= method=DELETE path=/admin/webhooks/wh1 status=401")
+}
+
+func TestEndpointMiddleware(t *testing.T) {
+	e := EndpointMiddleware(RoleAdmin)(func(ctx context.Context, request any) (any, error) {
+		return "ok", nil
+	})
+
+	_, err := e(context.Background(), nil)
+	assert.Equal(t, ErrUnauthenticated, err)
+	_, err = e(NewContext(context.Background(), Principal{Role: RoleWriter}), nil)
+	assert.Equal(t, ErrForbidden, err)
+	res, err := e(NewContext(context.Background(), Principal{Role: RoleAdmin}), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", res)
+}
+
+func TestWebSocket(t *testing.T) {
+	repo := apikeyrepository.NewInmemoryRepo()
+	a := NewAuthenticator(repo, log.NewNopLogger())
+	reader, _ := createKey(t, repo, RoleReader)
+	allow := a.WebSocket(RoleReader)
+
+	assert.False(t, allow(httptest.NewRequest("GET", "/ws", nil)))
+	assert.True(t, allow(httptest.NewRequest("GET", "/ws?access_token="+reader, nil)))
+	assert.False(t, allow(httptest.NewRequest("GET", "/ws?access_token=wrong", nil)))
+
+	r := httptest.NewRequest("GET", "/ws", nil)
+	r = r.WithContext(NewContext(r.Context(), Principal{Role: RoleReader}))
+	assert.True(t, allow(r))
+}
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+	"view_count/model"
+	"view_count/repository/apikeyrepository"
+
+	"github.com/go-kit/log"
+)
+
+const (
+	// cacheTTL is how long a looked up key is trusted without asking the
+	// repository again, and so how long a revocation can take to apply.
+	cacheTTL = 30 * time.Second
+	// touchInterval is how often at most a key's last use is written.
+	touchInterval = time.Minute
+	// flushTimeout is how long Run may spend writing queued last uses
+	// once its context is done.
+	flushTimeout = 5 * time.Second
+)
+
+type cachedKey struct {
+	key     model.APIKey
+	expires time.Time
+}
+
+type touch struct {
+	id     string
+	usedAt time.Time
+}
+
+// Authenticator resolves API keys and, once SetJWTVerifier was called,
+// JWTs to principals. Last use of keys is written in the background by
+// Run, so it never slows requests down.
+type Authenticator struct {
+	repo   apikeyrepository.Repository
+	jwt    *JWTVerifier
+	logger log.Logger
+
+	mu      sync.Mutex
+	cache   map[string]cachedKey // by hash
+	touched map[string]time.Time // by key id
+	touches chan touch
+}
+
+func NewAuthenticator(repo apikeyrepository.Repository, logger log.Logger) *Authenticator {
+	return &Authenticator{
+		repo:    repo,
+		logger:  logger,
+		cache:   make(map[string]cachedKey),
+		touched: make(map[string]time.Time),
+		touches: make(chan touch, 256),
+	}
+}
+
+// SetJWTVerifier makes Authenticate accept JWTs verified by v. It must be
+// called before the Authenticator is used.
+func (a *Authenticator) SetJWTVerifier(v *JWTVerifier) {
+	a.jwt = v
+}
+
+// Authenticate returns the principal of key, an API key or a JWT. Unknown
+// and revoked keys, keys with a role this version does not know and
+// invalid JWTs are ErrUnauthenticated.
+func (a *Authenticator) Authenticate(ctx context.Context, key string) (Principal, error) {
+	if key == "" {
+		return Principal{}, ErrUnauthenticated
+	}
+	if IsJWT(key) {
+		if a.jwt == nil {
+			return Principal{}, ErrUnauthenticated
+		}
+		return a.jwt.Verify(ctx, key)
+	}
+	k, err := a.lookup(ctx, HashKey(key))
+	if errors.Is(err, apikeyrepository.ErrAPIKeyNotFound) {
+		return Principal{}, ErrUnauthenticated
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+	role, err := ParseRole(k.Role)
+	if err != nil || k.Revoked() {
+		return Principal{}, ErrUnauthenticated
+	}
+	a.touch(k.Id)
+	return Principal{Subject: "apikey:" + k.Id, Role: role}, nil
+}
+
+func (a *Authenticator) lookup(ctx context.Context, hash string) (model.APIKey, error) {
+	now := time.Now()
+	a.mu.Lock()
+	c, ok := a.cache[hash]
+	a.mu.Unlock()
+	if ok && now.Before(c.expires) {
+		return c.key, nil
+	}
+
+	k, err := a.repo.GetAPIKeyByHash(ctx, hash)
+	if err != nil {
+		return model.APIKey{}, err
+	}
+	a.mu.Lock()
+	a.cache[hash] = cachedKey{key: k, expires: now.Add(cacheTTL)}
+	a.mu.Unlock()
+	return k, nil
+}
+
+// touch queues a write of the key's last use unless one was queued within
+// touchInterval. When Run is behind the write is dropped.
+func (a *Authenticator) touch(id string) {
+	now := time.Now()
+	a.mu.Lock()
+	if now.Sub(a.touched[id]) < touchInterval {
+		a.mu.Unlock()
+		return
+	}
+	a.touched[id] = now
+	a.mu.Unlock()
+
+	select {
+	case a.touches <- touch{id: id, usedAt: now.UTC()}:
+	default:
+	}
+}
+
+// Run writes the last use of keys until ctx is done, then writes those
+// still queued within flushTimeout.
+func (a *Authenticator) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			a.flush(ctx)
+			return ctx.Err()
+		case t := <-a.touches:
+			a.write(ctx, t)
+		}
+	}
+}
+
+// flush writes the queued last uses without waiting for new ones.
+func (a *Authenticator) flush(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), flushTimeout)
+	defer cancel()
+	for {
+		select {
+		case t := <-a.touches:
+			a.write(ctx, t)
+		default:
+			return
+		}
+	}
+}
+
+func (a *Authenticator) write(ctx context.Context, t touch) {
+	if err := a.repo.TouchAPIKey(ctx, t.id, t.usedAt); err != nil {
+		a.logger.Log("msg", "recording api key use failed", "key_id", t.id, "err", err)
+	}
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// KeyFromMetadata is KeyFromRequest for gRPC metadata, whose keys are
+// lower case.
+func KeyFromMetadata(md metadata.MD) string {
+	if k := md.Get(strings.ToLower(APIKeyHeader)); len(k) > 0 && k[0] != "" {
+		return k[0]
+	}
+	if a := md.Get("authorization"); len(a) > 0 {
+		if k, ok := strings.CutPrefix(a[0], "Bearer "); ok {
+			return k
+		}
+	}
+	return ""
+}
+
+// grpcContext stores the principal of the call's credentials in ctx, as
+// Middleware does for HTTP requests.
+func (a *Authenticator) grpcContext(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return a.contextWithKey(ctx, KeyFromMetadata(md))
+}
+
+// UnaryServerInterceptor authenticates unary calls. Like Middleware it
+// only stores the principal; endpoints wrapped by EndpointMiddleware
+// decide whether it is enough.
+func (a *Authenticator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(a.grpcContext(ctx), req)
+	}
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming calls.
+func (a *Authenticator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, authenticatedStream{ss, a.grpcContext(ss.Context())})
+	}
+}
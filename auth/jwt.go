@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTConfig configures how bearer JWTs are verified and mapped to
+// principals.
+type JWTConfig struct {
+	// Issuer and Audience, when set, must match the iss and aud claims.
+	Issuer   string
+	Audience string
+	// RoleClaim names the claim holding the caller's roles, either a list
+	// or a space separated string. The highest role found is used.
+	RoleClaim string
+	// Roles maps claim values to roles. Values not in it are ignored,
+	// except that reader, writer and admin map to themselves when it is
+	// empty.
+	Roles map[string]Role
+	// TenantClaim names the claim holding the caller's tenant.
+	TenantClaim string
+	// Leeway is the clock skew tolerated for exp, nbf and iat.
+	Leeway time.Duration
+}
+
+// JWTVerifier verifies bearer JWTs signed with keys of a KeySet.
+type JWTVerifier struct {
+	keys   *KeySet
+	cfg    JWTConfig
+	parser *jwt.Parser
+}
+
+func NewJWTVerifier(keys *KeySet, cfg JWTConfig) *JWTVerifier {
+	opts := []jwt.ParserOption{
+		// asymmetric algorithms only, so a public key can never be used
+		// as an HMAC secret.
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	return &JWTVerifier{keys: keys, cfg: cfg, parser: jwt.NewParser(opts...)}
+}
+
+// IsJWT reports whether token looks like a compact JWT rather than an API
+// key, which never contains dots.
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Verify returns the principal of token. A valid token without a known
+// role yields a principal with RolePublic, which only public operations
+// allow. Every verification failure is ErrUnauthenticated.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (Principal, error) {
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.Key(ctx, kid)
+	})
+	if err != nil {
+		return Principal{}, ErrUnauthenticated
+	}
+
+	sub, _ := claims.GetSubject()
+	if sub == "" {
+		return Principal{}, ErrUnauthenticated
+	}
+	tenant, _ := claims[v.cfg.TenantClaim].(string)
+	return Principal{
+		Subject: "jwt:" + sub,
+		Role:    v.role(claims[v.cfg.RoleClaim]),
+		Tenant:  tenant,
+	}, nil
+}
+
+func (v *JWTVerifier) role(claim any) Role {
+	var values []string
+	switch c := claim.(type) {
+	case string:
+		values = strings.Fields(c)
+	case []any:
+		for _, e := range c {
+			if s, ok := e.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	best := RolePublic
+	for _, s := range values {
+		r, ok := v.cfg.Roles[s]
+		if len(v.cfg.Roles) == 0 {
+			r, ok = Role(s), Role(s).rank() > 0
+		}
+		if ok && r.rank() > best.rank() {
+			best = r
+		}
+	}
+	return best
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jwksServer stands in for the gateway's JWKS endpoint.
+type jwksServer struct {
+	mu   sync.Mutex
+	keys []map[string]string
+	*httptest.Server
+}
+
+func newJWKSServer(t *testing.T) *jwksServer {
+	s := &jwksServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{"keys": s.keys})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) addRSA(kid string, key *rsa.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, map[string]string{
+		"kty": "RSA", "kid": kid, "use": "sig",
+		"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	})
+}
+
+func (s *jwksServer) addEC(kid string, key *ecdsa.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, map[string]string{
+		"kty": "EC", "kid": kid, "crv": "P-256",
+		"x": base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y": base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	})
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	s, err := token.SignedString(key)
+	require.NoError(t, err)
+	return s
+}
+
+func TestJWTVerifier(t *testing.T) {
+	ctx := context.Background()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	server := newJWKSServer(t)
+	server.addRSA("rsa1", &rsaKey.PublicKey)
+	keys, err := NewKeySet(ctx, server.URL, time.Hour, log.NewNopLogger())
+	require.NoError(t, err)
+
+	v := NewJWTVerifier(keys, JWTConfig{
+		Issuer:      "https://gateway.internal",
+		Audience:    "view_count",
+		RoleClaim:   "roles",
+		Roles:       map[string]Role{"counter:read": RoleReader, "counter:admin": RoleAdmin},
+		TenantClaim: "tenant",
+	})
+	claims := func(extra jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss": "https://gateway.internal",
+			"aud": "view_count",
+			"sub": "alice",
+			"exp": time.Now().Add(time.Minute).Unix(),
+		}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	t.Run("Roles and tenant", func(t *testing.T) {
+		token := sign(t, jwt.SigningMethodRS256, "rsa1", rsaKey, claims(jwt.MapClaims{
+			"roles":  []string{"counter:read", "counter:admin", "other"},
+			"tenant": "acme",
+		}))
+
+		p, err := v.Verify(ctx, token)
+		require.NoError(t, err)
+		assert.Equal(t, Principal{Subject: "jwt:alice", Role: RoleAdmin, Tenant: "acme"}, p)
+	})
+
+	t.Run("Unmapped roles are public", func(t *testing.T) {
+		token := sign(t, jwt.SigningMethodRS256, "rsa1", rsaKey, claims(jwt.MapClaims{"roles": "admin"}))
+
+		p, err := v.Verify(ctx, token)
+		require.NoError(t, err)
+		assert.Equal(t, RolePublic, p.Role)
+	})
+
+	for name, token := range map[string]string{
+		"expired":      sign(t, jwt.SigningMethodRS256, "rsa1", rsaKey, claims(jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()})),
+		"no expiry":    sign(t, jwt.SigningMethodRS256, "rsa1", rsaKey, jwt.MapClaims{"iss": "https://gateway.internal", "aud": "view_count", "sub": "alice"}),
+		"wrong issuer": sign(t, jwt.SigningMethodRS256, "rsa1", rsaKey, claims(jwt.MapClaims{"iss": "https://evil.example"})),
+		"wrong aud":    sign(t, jwt.SigningMethodRS256, "rsa1", rsaKey, claims(jwt.MapClaims{"aud": "other"})),
+		"no subject":   sign(t, jwt.SigningMethodRS256, "rsa1", rsaKey, claims(jwt.MapClaims{"sub": ""})),
+		"hmac":         sign(t, jwt.SigningMethodHS256, "rsa1", []byte("secret"), claims(nil)),
+		"unknown key":  sign(t, jwt.SigningMethodES256, "ec1", ecKey, claims(nil)),
+	} {
+		t.Run("Rejects "+name, func(t *testing.T) {
+			_, err := v.Verify(ctx, token)
+			assert.Equal(t, ErrUnauthenticated, err)
+		})
+	}
+
+	t.Run("Rotated keys are fetched", func(t *testing.T) {
+		server.addEC("ec2", &ecKey.PublicKey)
+		token := sign(t, jwt.SigningMethodES256, "ec2", ecKey, claims(nil))
+
+		// the key set was fetched moments ago, so it is not fetched again yet.
+		_, err := v.Verify(ctx, token)
+		assert.Equal(t, ErrUnauthenticated, err)
+
+		keys.mu.Lock()
+		keys.fetched = time.Now().Add(-minJWKSRefresh)
+		keys.mu.Unlock()
+		p, err := v.Verify(ctx, token)
+		require.NoError(t, err)
+		assert.Equal(t, "jwt:alice", p.Subject)
+	})
+}
+
+func TestAuthenticatorJWT(t *testing.T) {
+	ctx := context.Background()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	// a JWKS file works like a URL.
+	server := newJWKSServer(t)
+	server.addRSA("k1", &key.PublicKey)
+	res, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	var jwks json.RawMessage
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&jwks))
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(file, jwks, 0o600))
+
+	keys, err := NewKeySet(ctx, file, time.Hour, log.NewNopLogger())
+	require.NoError(t, err)
+	token := sign(t, jwt.SigningMethodRS256, "k1", key, jwt.MapClaims{
+		"sub":   "svc-ingest",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"roles": "writer",
+	})
+
+	a := NewAuthenticator(nil, log.NewNopLogger())
+	_, err = a.Authenticate(ctx, token)
+	assert.Equal(t, ErrUnauthenticated, err, "JWTs are rejected until a verifier is set")
+
+	a.SetJWTVerifier(NewJWTVerifier(keys, JWTConfig{RoleClaim: "roles"}))
+	p, err := a.Authenticate(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, Principal{Subject: "jwt:svc-ingest", Role: RoleWriter}, p)
+}
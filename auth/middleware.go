@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"view_count/problem"
+	"view_count/requestid"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/go-kit/kit/endpoint"
+	kitlog "github.com/go-kit/log"
+	"github.com/gorilla/mux"
+)
+
+// Middleware stores the principal of the request's API key in its context.
+// Requests without a valid key pass through unauthenticated; Require
+// decides whether that is enough.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(a.HTTPToContext(r.Context(), r)))
+	})
+}
+
+// HTTPToContext is a go-kit RequestFunc doing what Middleware does, for
+// handlers built with viewservice.MakeHandler.
+func (a *Authenticator) HTTPToContext(ctx context.Context, r *http.Request) context.Context {
+	return a.contextWithKey(ctx, KeyFromRequest(r))
+}
+
+// contextWithKey returns ctx with the principal of key, or ctx itself when
+// key is empty or not valid.
+func (a *Authenticator) contextWithKey(ctx context.Context, key string) context.Context {
+	if key == "" {
+		return ctx
+	}
+	p, err := a.Authenticate(ctx, key)
+	if err != nil {
+		if !errors.Is(err, ErrUnauthenticated) {
+			a.logger.Log("msg", "authenticating api key failed", "err", err)
+		}
+		return ctx
+	}
+	return NewContext(ctx, p)
+}
+
+// Require rejects requests whose principal does not have role with 401 if
+// there is none and 403 otherwise.
+func Require(role Role) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if role == RolePublic {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := Authorize(r.Context(), role); err != nil {
+				WriteError(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Audit logs who made every request it wraps, including those Require
+// turns away, for routes such as the admin API whose changes should be
+// traceable to a caller.
+func Audit(logger kitlog.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			m := httpsnoop.CaptureMetrics(next, w, r)
+			p, _ := FromContext(r.Context())
+			logger.Log(
+				"msg", "admin request",
+				"subject", p.Subject,
+				"role", p.Role,
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", m.Code,
+				"request_id", requestid.FromContext(r.Context()),
+			)
+		})
+	}
+}
+
+// WriteError replies with the status of an error returned by Authorize, as
+// problem details if r wants them.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusForbidden
+	if !errors.Is(err, ErrForbidden) {
+		status = http.StatusUnauthorized
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	if problem.Wanted(r) {
+		problem.Write(w, r, problem.New("", status, err.Error()))
+		return
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// EndpointMiddleware applies the check of Require to a go-kit endpoint.
+func EndpointMiddleware(role Role) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request any) (any, error) {
+			if err := Authorize(ctx, role); err != nil {
+				return nil, err
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// RequireWebSocket is Require for WebSocket upgrades, which may carry the
+// key in the access_token query parameter as accepted by WebSocket.
+func (a *Authenticator) RequireWebSocket(role Role) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if role == RolePublic {
+			return next
+		}
+		allow := a.WebSocket(role)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !allow(r) {
+				WriteError(w, r, ErrUnauthenticated)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// WebSocket returns an authenticator for live.WebSocketConfig that accepts
+// upgrade requests whose principal has role. Browsers cannot set headers
+// on WebSocket requests, so the key may also come in the access_token
+// query parameter.
+func (a *Authenticator) WebSocket(role Role) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		if Authorize(r.Context(), role) == nil {
+			return true
+		}
+		key := r.URL.Query().Get("access_token")
+		if key == "" {
+			return false
+		}
+		p, err := a.Authenticate(r.Context(), key)
+		return err == nil && p.Role.Allows(role)
+	}
+}
@@ -17,12 +17,33 @@ func Execute(svc viewservice.Service) error {
 	return rootCmd.Execute()
 }
 
+// AddCommand registers commands that are defined outside this package,
+// such as the server, on the root command.
+func AddCommand(cmds ...*cobra.Command) {
+	rootCmd.AddCommand(cmds...)
+}
+
+var getViewBatchSize int
+
 var getViewCmd = &cobra.Command{
-	Use:   "get-view [id]",
-	Short: "Get a specific view",
+	Use:   "get-view [id...]",
+	Short: "Get the views of one or more videos",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 1 {
+			getView(args[0])
+			return
+		}
+		getViews(args, getViewBatchSize)
+	},
+}
+
+var getRankCmd = &cobra.Command{
+	Use:   "get-rank [id]",
+	Short: "Get a video's place in the all-time leaderboard",
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		getView(args[0])
+		getRank(args[0])
 	},
 }
 
@@ -60,7 +81,9 @@ var getRecentCmd = &cobra.Command{
 }
 
 func init() {
+	getViewCmd.Flags().IntVar(&getViewBatchSize, "batch-size", viewservice.DefaultMaxBatchSize, "number of ids looked up at once")
 	rootCmd.AddCommand(getViewCmd)
+	rootCmd.AddCommand(getRankCmd)
 	rootCmd.AddCommand(getAllViewsCmd)
 	rootCmd.AddCommand(incrementViewCmd)
 	rootCmd.AddCommand(getTopTenCmd)
@@ -79,6 +102,34 @@ func getView(id string) {
 	fmt.Printf("View count for ID %s: %d\n", id, views)
 }
 
+// getViews looks the ids up batchSize at a time and prints their views in
+// the order given.
+func getViews(ids []string, batchSize int) {
+	ctx := context.Background()
+	batchSize = max(batchSize, 1)
+	for start := 0; start < len(ids); start += batchSize {
+		batch := ids[start:min(start+batchSize, len(ids))]
+		views, err := viewService.GetViews(ctx, batch)
+		if err != nil {
+			fmt.Printf("Error getting views for IDs: %v, error: %v\n", batch, err)
+			return
+		}
+		for _, id := range batch {
+			fmt.Printf("View count for ID %s: %d\n", id, views[id])
+		}
+	}
+}
+
+func getRank(id string) {
+	ctx := context.Background()
+	rank, err := viewService.GetRank(ctx, id)
+	if err != nil {
+		fmt.Printf("Error getting rank for ID: %s, error: %v\n", id, err)
+		return
+	}
+	fmt.Printf("Rank of ID %s: #%d with %d views, tied with %d other videos\n", id, rank.Position, rank.Views, rank.Ties)
+}
+
 func getAllViews() {
 	ctx := context.Background()
 	videos, err := viewService.GetAllViews(ctx)
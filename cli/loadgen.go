@@ -0,0 +1,471 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+	"view_count/auth"
+	"view_count/repository/viewrepository"
+	"view_count/viewservice"
+	"view_count/viewtoken"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	opIncrement = "increment"
+	opGetView   = "get-view"
+	opTop       = "top"
+
+	loadgenUserAgent = "view_count-loadgen/1"
+)
+
+var loadgenOpts struct {
+	duration    time.Duration
+	concurrency int
+	rps         float64
+	videos      uint64
+	zipfS       float64
+	mix         string
+	topN        int
+	remote      string
+	apiKey      string
+	tokenKeys   string
+	tokenViewer string
+	inmemory    bool
+	output      string
+	seed        int64
+}
+
+var loadgenCmd = &cobra.Command{
+	Use:   "loadgen",
+	Short: "Generate synthetic traffic and report throughput and latency",
+	Long: `Drives Increment, GetView and GetTopVideos with Zipf-distributed video IDs.
+
+By default the configured service is exercised in-process. Use --inmemory to
+run against a fresh in-memory repository instead, or --remote to send HTTP
+requests to a running server.
+
+A view token counts one view, so against servers that require them pass
+the server's --view-token-keys-file: every increment then carries a fresh
+token signed for the video and --view-token-viewer, which must be the
+address the server sees the requests coming from.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runLoadgen(cmd.Context(), cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	f := loadgenCmd.Flags()
+	f.DurationVar(&loadgenOpts.duration, "duration", 10*time.Second, "how long to generate load")
+	f.IntVar(&loadgenOpts.concurrency, "concurrency", 8, "number of concurrent workers")
+	f.Float64Var(&loadgenOpts.rps, "rps", 0, "target requests per second across all workers, 0 for unlimited")
+	f.Uint64Var(&loadgenOpts.videos, "videos", 1000, "number of distinct video IDs")
+	f.Float64Var(&loadgenOpts.zipfS, "zipf-s", 1.1, "Zipf exponent for video popularity, must be > 1")
+	f.StringVar(&loadgenOpts.mix, "mix", "increment=70,get-view=25,top=5", "operation weights")
+	f.IntVar(&loadgenOpts.topN, "top-n", 10, "n passed to GetTopVideos")
+	f.StringVar(&loadgenOpts.remote, "remote", "", "base URL of a running server, e.g. http://localhost:8080")
+	f.StringVar(&loadgenOpts.apiKey, "api-key", "", "API key sent with --remote requests")
+	f.StringVar(&loadgenOpts.tokenKeys, "view-token-keys-file", "", "file of \"<id> <secret>\" view token keys to sign --remote increments with")
+	f.StringVar(&loadgenOpts.tokenViewer, "view-token-viewer", "127.0.0.1", "client IP view tokens are signed for")
+	f.BoolVar(&loadgenOpts.inmemory, "inmemory", false, "run against a fresh in-memory repository")
+	f.StringVar(&loadgenOpts.output, "output", "table", "report format: table or json")
+	f.Int64Var(&loadgenOpts.seed, "seed", 0, "random seed, 0 picks one from the clock")
+	rootCmd.AddCommand(loadgenCmd)
+}
+
+// loadTarget is what the generator drives. It is satisfied in-process by a
+// viewservice.Service and remotely by the HTTP routes.
+type loadTarget interface {
+	Increment(ctx context.Context, videoId string) error
+	GetView(ctx context.Context, videoId string) error
+	GetTopVideos(ctx context.Context, n int) error
+}
+
+type serviceTarget struct {
+	svc viewservice.Service
+}
+
+func (t serviceTarget) Increment(ctx context.Context, videoId string) error {
+	return t.svc.Increment(ctx, videoId)
+}
+
+func (t serviceTarget) GetView(ctx context.Context, videoId string) error {
+	_, err := t.svc.GetView(ctx, videoId)
+	return err
+}
+
+func (t serviceTarget) GetTopVideos(ctx context.Context, n int) error {
+	_, err := t.svc.GetTopVideos(ctx, n)
+	return err
+}
+
+type httpTarget struct {
+	base   string
+	client *http.Client
+	apiKey string
+	// tokenKey signs a view token for every increment when it has an ID.
+	tokenKey    viewtoken.Key
+	tokenViewer string
+}
+
+// newHTTPClient returns a client keeping an idle connection per worker, as
+// the default of two per host would make the others dial for every request.
+func newHTTPClient(concurrency int) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = concurrency
+	transport.MaxIdleConnsPerHost = concurrency
+	return &http.Client{Transport: transport, Timeout: 10 * time.Second}
+}
+
+func (t httpTarget) do(ctx context.Context, method, path, viewToken string) error {
+	req, err := http.NewRequestWithContext(ctx, method, t.base+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", loadgenUserAgent)
+	if t.apiKey != "" {
+		req.Header.Set(auth.APIKeyHeader, t.apiKey)
+	}
+	if viewToken != "" {
+		req.Header.Set(viewservice.ViewTokenHeader, viewToken)
+	}
+	res, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%s %s: %s", method, path, res.Status)
+	}
+	return nil
+}
+
+func (t httpTarget) Increment(ctx context.Context, videoId string) error {
+	var token string
+	if t.tokenKey.Id != "" {
+		var err error
+		if token, err = viewtoken.Issue(t.tokenKey, videoId, t.tokenViewer, time.Minute); err != nil {
+			return err
+		}
+	}
+	return t.do(ctx, http.MethodPost, "/increment/"+url.PathEscape(videoId), token)
+}
+
+func (t httpTarget) GetView(ctx context.Context, videoId string) error {
+	return t.do(ctx, http.MethodGet, "/views/"+url.PathEscape(videoId), "")
+}
+
+func (t httpTarget) GetTopVideos(ctx context.Context, n int) error {
+	return t.do(ctx, http.MethodGet, "/top/"+strconv.Itoa(n), "")
+}
+
+type opWeight struct {
+	op     string
+	weight int
+}
+
+// parseMix parses "increment=70,get-view=25,top=5" into cumulative weights.
+func parseMix(s string) ([]opWeight, int, error) {
+	var (
+		mix   []opWeight
+		total int
+	)
+	for _, part := range strings.Split(s, ",") {
+		name, w, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, 0, fmt.Errorf("invalid mix entry %q", part)
+		}
+		switch name {
+		case opIncrement, opGetView, opTop:
+		default:
+			return nil, 0, fmt.Errorf("unknown operation %q in mix", name)
+		}
+		weight, err := strconv.Atoi(w)
+		if err != nil || weight < 0 {
+			return nil, 0, fmt.Errorf("invalid weight for %q", name)
+		}
+		total += weight
+		mix = append(mix, opWeight{op: name, weight: total})
+	}
+	if total == 0 {
+		return nil, 0, fmt.Errorf("mix has no weight")
+	}
+	return mix, total, nil
+}
+
+type opStats struct {
+	latencies []time.Duration
+	errors    int
+}
+
+// OpReport is the summary of one operation in the loadgen report.
+type OpReport struct {
+	Op         string  `json:"op"`
+	Requests   int     `json:"requests"`
+	Errors     int     `json:"errors"`
+	Throughput float64 `json:"throughput_rps"`
+	MeanMs     float64 `json:"mean_ms"`
+	P50Ms      float64 `json:"p50_ms"`
+	P90Ms      float64 `json:"p90_ms"`
+	P99Ms      float64 `json:"p99_ms"`
+	MaxMs      float64 `json:"max_ms"`
+}
+
+// LoadReport is the result of a loadgen run.
+type LoadReport struct {
+	Target      string     `json:"target"`
+	Duration    float64    `json:"duration_seconds"`
+	Concurrency int        `json:"concurrency"`
+	Operations  []OpReport `json:"operations"`
+}
+
+func runLoadgen(ctx context.Context, out io.Writer) error {
+	o := loadgenOpts
+	if o.concurrency < 1 {
+		return fmt.Errorf("concurrency must be positive, got %d", o.concurrency)
+	}
+	if o.videos < 1 {
+		return fmt.Errorf("videos must be positive, got %d", o.videos)
+	}
+	if o.zipfS <= 1 {
+		return fmt.Errorf("zipf-s must be greater than 1, got %v", o.zipfS)
+	}
+	if o.output != "table" && o.output != "json" {
+		return fmt.Errorf("unknown output %q, expected table or json", o.output)
+	}
+	if o.remote != "" && o.inmemory {
+		return fmt.Errorf("--remote and --inmemory cannot be used together")
+	}
+	if o.remote == "" && (o.apiKey != "" || o.tokenKeys != "") {
+		return fmt.Errorf("--api-key and --view-token-keys-file need --remote")
+	}
+	mix, total, err := parseMix(o.mix)
+	if err != nil {
+		return err
+	}
+
+	var (
+		target     loadTarget
+		targetName string
+	)
+	switch {
+	case o.remote != "":
+		t := httpTarget{
+			base:        strings.TrimSuffix(o.remote, "/"),
+			client:      newHTTPClient(o.concurrency),
+			apiKey:      o.apiKey,
+			tokenViewer: o.tokenViewer,
+		}
+		if o.tokenKeys != "" {
+			keys, err := viewtoken.LoadKeyFile(o.tokenKeys)
+			if err != nil {
+				return err
+			}
+			t.tokenKey = keys[0]
+		}
+		target = t
+		targetName = o.remote
+	case o.inmemory:
+		target = serviceTarget{svc: viewservice.NewService(viewrepository.NewInmemoryRepo())}
+		targetName = "inmemory"
+	default:
+		target = serviceTarget{svc: viewService}
+		targetName = "service"
+	}
+
+	seed := o.seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, o.duration)
+	defer cancel()
+
+	var tokens <-chan struct{}
+	if o.rps > 0 {
+		tokens = pace(ctx, o.rps, o.concurrency)
+	}
+
+	stats := make([]map[string]*opStats, o.concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < o.concurrency; w++ {
+		stats[w] = map[string]*opStats{opIncrement: {}, opGetView: {}, opTop: {}}
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed + int64(w)))
+			zipf := rand.NewZipf(r, o.zipfS, 1, o.videos-1)
+			for {
+				if tokens != nil {
+					select {
+					case <-ctx.Done():
+						return
+					case <-tokens:
+					}
+				} else if ctx.Err() != nil {
+					return
+				}
+
+				op := pickOp(mix, r.Intn(total))
+				id := fmt.Sprintf("video-%d", zipf.Uint64())
+
+				begin := time.Now()
+				var err error
+				switch op {
+				case opIncrement:
+					err = target.Increment(ctx, id)
+				case opGetView:
+					err = target.GetView(ctx, id)
+				case opTop:
+					err = target.GetTopVideos(ctx, o.topN)
+				}
+				// Requests cut short by the end of the run are not counted.
+				if ctx.Err() != nil {
+					return
+				}
+				s := stats[w][op]
+				s.latencies = append(s.latencies, time.Since(begin))
+				if err != nil {
+					s.errors++
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	report := buildReport(stats, elapsed)
+	report.Target = targetName
+	report.Concurrency = o.concurrency
+
+	if o.output == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	return writeReportTable(out, report)
+}
+
+// pace emits rps tokens per second. Tokens that no worker is ready to take
+// are dropped so that a stalled target does not cause a burst afterwards.
+func pace(ctx context.Context, rps float64, burst int) <-chan struct{} {
+	tokens := make(chan struct{}, burst)
+	go func() {
+		const tick = 10 * time.Millisecond
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		var (
+			pending float64
+			last    = time.Now()
+		)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				pending += rps * now.Sub(last).Seconds()
+				last = now
+				for ; pending >= 1; pending-- {
+					select {
+					case tokens <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}
+	}()
+	return tokens
+}
+
+func pickOp(mix []opWeight, x int) string {
+	for _, m := range mix {
+		if x < m.weight {
+			return m.op
+		}
+	}
+	return mix[len(mix)-1].op
+}
+
+func buildReport(stats []map[string]*opStats, elapsed time.Duration) LoadReport {
+	report := LoadReport{Duration: elapsed.Seconds()}
+	for _, op := range []string{opIncrement, opGetView, opTop} {
+		merged := opStats{}
+		for _, s := range stats {
+			merged.latencies = append(merged.latencies, s[op].latencies...)
+			merged.errors += s[op].errors
+		}
+		if len(merged.latencies) == 0 {
+			continue
+		}
+		sort.Slice(merged.latencies, func(i, j int) bool { return merged.latencies[i] < merged.latencies[j] })
+
+		var sum time.Duration
+		for _, l := range merged.latencies {
+			sum += l
+		}
+		n := len(merged.latencies)
+		report.Operations = append(report.Operations, OpReport{
+			Op:         op,
+			Requests:   n,
+			Errors:     merged.errors,
+			Throughput: float64(n) / elapsed.Seconds(),
+			MeanMs:     ms(sum / time.Duration(n)),
+			P50Ms:      ms(percentile(merged.latencies, 0.50)),
+			P90Ms:      ms(percentile(merged.latencies, 0.90)),
+			P99Ms:      ms(percentile(merged.latencies, 0.99)),
+			MaxMs:      ms(merged.latencies[n-1]),
+		})
+	}
+	return report
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func writeReportTable(out io.Writer, report LoadReport) error {
+	fmt.Fprintf(out, "target=%s concurrency=%d duration=%.1fs\n\n", report.Target, report.Concurrency, report.Duration)
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "OP\tREQUESTS\tERRORS\tRPS\tMEAN ms\tP50 ms\tP90 ms\tP99 ms\tMAX ms\t")
+	for _, r := range report.Operations {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%.3f\t%.3f\t%.3f\t%.3f\t%.3f\t\n",
+			r.Op, r.Requests, r.Errors, r.Throughput, r.MeanMs, r.P50Ms, r.P90Ms, r.P99Ms, r.MaxMs)
+	}
+	return tw.Flush()
+}
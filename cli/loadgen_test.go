@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"view_count/auth"
+	"view_count/viewservice"
+	"view_count/viewtoken"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMix(t *testing.T) {
+	mix, total, err := parseMix("increment=70,get-view=25,top=5")
+	require.NoError(t, err)
+	assert.Equal(t, 100, total)
+	assert.Equal(t, opIncrement, pickOp(mix, 0))
+	assert.Equal(t, opGetView, pickOp(mix, 70))
+	assert.Equal(t, opTop, pickOp(mix, 99))
+
+	_, _, err = parseMix("delete=1")
+	assert.Error(t, err)
+	_, _, err = parseMix("increment=0")
+	assert.Error(t, err)
+}
+
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	assert.Equal(t, 50*time.Millisecond, percentile(latencies, 0.50))
+	assert.Equal(t, 99*time.Millisecond, percentile(latencies, 0.99))
+	assert.Equal(t, time.Duration(0), percentile(nil, 0.5))
+}
+
+func TestRunLoadgenInmemory(t *testing.T) {
+	saved := loadgenOpts
+	defer func() { loadgenOpts = saved }()
+
+	loadgenOpts.duration = 200 * time.Millisecond
+	loadgenOpts.concurrency = 2
+	loadgenOpts.videos = 50
+	loadgenOpts.zipfS = 1.2
+	loadgenOpts.mix = "increment=1,top=1"
+	loadgenOpts.topN = 5
+	loadgenOpts.inmemory = true
+	loadgenOpts.output = "json"
+	loadgenOpts.seed = 1
+
+	var out bytes.Buffer
+	require.NoError(t, runLoadgen(context.Background(), &out))
+
+	var report LoadReport
+	require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	assert.Equal(t, "inmemory", report.Target)
+	require.Len(t, report.Operations, 2)
+	for _, op := range report.Operations {
+		assert.Positive(t, op.Requests)
+		assert.Zero(t, op.Errors)
+	}
+}
+
+func TestRunLoadgenRemote(t *testing.T) {
+	saved := loadgenOpts
+	defer func() { loadgenOpts = saved }()
+
+	keysFile := filepath.Join(t.TempDir(), "keys")
+	require.NoError(t, os.WriteFile(keysFile, []byte("k1 0123456789abcdef0123456789abcdef\n"), 0o600))
+	keys, err := viewtoken.LoadKeyFile(keysFile)
+	require.NoError(t, err)
+	verifier := viewtoken.NewVerifier(keys, time.Minute, viewtoken.NewMemoryCache())
+
+	var (
+		mu       sync.Mutex
+		problems []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if ua := r.UserAgent(); ua != loadgenUserAgent {
+			problems = append(problems, "user agent "+ua)
+		}
+		if key := r.Header.Get(auth.APIKeyHeader); key != "secret-key" {
+			problems = append(problems, "api key "+key)
+		}
+		if videoId, ok := strings.CutPrefix(r.URL.Path, "/increment/"); ok {
+			token := r.Header.Get(viewservice.ViewTokenHeader)
+			if err := verifier.Verify(r.Context(), token, videoId, "127.0.0.1", ""); err != nil {
+				problems = append(problems, "view token: "+err.Error())
+			}
+		}
+	}))
+	defer server.Close()
+
+	loadgenOpts.duration = 100 * time.Millisecond
+	loadgenOpts.concurrency = 2
+	loadgenOpts.videos = 5
+	loadgenOpts.zipfS = 1.2
+	loadgenOpts.mix = "increment=3,get-view=1"
+	loadgenOpts.remote = server.URL
+	loadgenOpts.apiKey = "secret-key"
+	loadgenOpts.tokenKeys = keysFile
+	loadgenOpts.tokenViewer = "127.0.0.1"
+	loadgenOpts.output = "json"
+
+	var out bytes.Buffer
+	require.NoError(t, runLoadgen(context.Background(), &out))
+	var report LoadReport
+	require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	for _, op := range report.Operations {
+		assert.Positive(t, op.Requests)
+		assert.Zero(t, op.Errors)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Empty(t, problems)
+
+	t.Run("Remote and inmemory are exclusive", func(t *testing.T) {
+		loadgenOpts.inmemory = true
+		assert.Error(t, runLoadgen(context.Background(), &out))
+	})
+}
@@ -0,0 +1,318 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"view_count/model"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+const (
+	viewTop    = "top"
+	viewRecent = "recent"
+
+	ansiClear      = "\033[H\033[2J"
+	ansiAltScreen  = "\033[?1049h\033[?25l"
+	ansiMainScreen = "\033[?25h\033[?1049l"
+	ansiReset      = "\033[0m"
+	ansiBold       = "\033[1m"
+	ansiDim        = "\033[2m"
+	ansiGreen      = "\033[32m"
+	ansiRed        = "\033[31m"
+	ansiYellow     = "\033[33m"
+)
+
+var (
+	watchInterval time.Duration
+	watchN        int
+	watchView     string
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Live-refreshing leaderboard of top and recent videos",
+	Long: `Renders a full-screen leaderboard that refreshes on an interval.
+
+Keys: t top view, r recent view, tab toggle view, +/- change N,
+space refresh now, q quit.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if watchView != viewTop && watchView != viewRecent {
+			return fmt.Errorf("unknown view %q, expected %q or %q", watchView, viewTop, viewRecent)
+		}
+		if watchN < 1 {
+			return fmt.Errorf("n must be positive, got %d", watchN)
+		}
+		if watchInterval <= 0 {
+			return fmt.Errorf("interval must be positive, got %s", watchInterval)
+		}
+		return watch(cmd.Context())
+	},
+}
+
+func init() {
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", 2*time.Second, "refresh interval")
+	watchCmd.Flags().IntVarP(&watchN, "n", "n", 10, "number of videos to show")
+	watchCmd.Flags().StringVar(&watchView, "view", viewTop, "initial view: top or recent")
+	rootCmd.AddCommand(watchCmd)
+}
+
+// leaderboardRow is one rendered line of the watch screen.
+type leaderboardRow struct {
+	Rank       int
+	Id         string
+	Views      int
+	Delta      int
+	PerSecond  float64
+	RankChange int // positive when the video moved up since the last refresh
+	New        bool
+}
+
+type leaderboardEntry struct {
+	rank  int
+	views int
+}
+
+// leaderboard keeps the previous snapshot of one view so that each refresh
+// can be rendered as deltas against it.
+type leaderboard struct {
+	prev   map[string]leaderboardEntry
+	prevAt time.Time
+}
+
+// update diffs videos against the previous snapshot and replaces it.
+// The first snapshot has no baseline, so deltas and rates are zero.
+func (lb *leaderboard) update(videos []model.VideoInfo, now time.Time) []leaderboardRow {
+	rows, cur := lb.diff(videos, now)
+	lb.prev = cur
+	lb.prevAt = now
+	return rows
+}
+
+// peek diffs videos against the previous snapshot without replacing it, so
+// that out-of-band refreshes leave the rate baseline in place. Without a
+// snapshot it behaves like update.
+func (lb *leaderboard) peek(videos []model.VideoInfo, now time.Time) []leaderboardRow {
+	if lb.prev == nil {
+		return lb.update(videos, now)
+	}
+	rows, _ := lb.diff(videos, now)
+	return rows
+}
+
+func (lb *leaderboard) diff(videos []model.VideoInfo, now time.Time) ([]leaderboardRow, map[string]leaderboardEntry) {
+	rows := make([]leaderboardRow, len(videos))
+	cur := make(map[string]leaderboardEntry, len(videos))
+	elapsed := now.Sub(lb.prevAt).Seconds()
+
+	for i, v := range videos {
+		row := leaderboardRow{Rank: i + 1, Id: v.Id, Views: v.Views}
+		if lb.prev != nil {
+			if p, ok := lb.prev[v.Id]; ok {
+				row.Delta = v.Views - p.views
+				row.RankChange = p.rank - row.Rank
+				if elapsed > 0 {
+					row.PerSecond = float64(row.Delta) / elapsed
+				}
+			} else {
+				row.New = true
+			}
+		}
+		rows[i] = row
+		cur[v.Id] = leaderboardEntry{rank: row.Rank, views: v.Views}
+	}
+	return rows, cur
+}
+
+type watchState struct {
+	view  string
+	n     int
+	board leaderboard
+	rows  []leaderboardRow
+	err   error
+	at    time.Time
+}
+
+// handleKey applies a keypress and reports whether it quits the watch.
+// Switching views drops the snapshot, which belongs to the previous view.
+func (s *watchState) handleKey(k byte) (quit bool) {
+	view := s.view
+	switch k {
+	case 'q', 'Q', 3: // 3 is Ctrl-C in raw mode
+		return true
+	case 't':
+		view = viewTop
+	case 'r':
+		view = viewRecent
+	case '\t':
+		if view == viewTop {
+			view = viewRecent
+		} else {
+			view = viewTop
+		}
+	case '+', '=':
+		s.n++
+	case '-', '_':
+		if s.n > 1 {
+			s.n--
+		}
+	}
+	if view != s.view {
+		s.view = view
+		s.board = leaderboard{}
+	}
+	return false
+}
+
+// refresh fetches the current view. Only scheduled refreshes advance the
+// snapshot; the others are diffed against it without moving the baseline.
+func (s *watchState) refresh(ctx context.Context, scheduled bool) {
+	var (
+		videos []model.VideoInfo
+		err    error
+	)
+	if s.view == viewRecent {
+		videos, err = viewService.GetRecentVideos(ctx, s.n)
+	} else {
+		videos, err = viewService.GetTopVideos(ctx, s.n)
+	}
+	s.at = time.Now()
+	s.err = err
+	if err != nil {
+		return
+	}
+	if scheduled {
+		s.rows = s.board.update(videos, s.at)
+	} else {
+		s.rows = s.board.peek(videos, s.at)
+	}
+}
+
+func watch(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	out := bufio.NewWriter(os.Stdout)
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		oldState, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer term.Restore(fd, oldState)
+	}
+	fmt.Fprint(out, ansiAltScreen)
+	defer func() {
+		fmt.Fprint(out, ansiMainScreen)
+		out.Flush()
+	}()
+
+	keys := make(chan byte, 8)
+	go readKeys(os.Stdin, keys)
+
+	state := &watchState{view: watchView, n: watchN}
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	scheduled := true
+	for {
+		state.refresh(ctx, scheduled)
+		renderWatch(out, state, terminalWidth())
+		out.Flush()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			scheduled = true
+		case k, ok := <-keys:
+			if !ok {
+				keys = nil
+				scheduled = false
+				continue
+			}
+			if state.handleKey(k) {
+				return nil
+			}
+			scheduled = false
+		}
+	}
+}
+
+func readKeys(r io.Reader, keys chan<- byte) {
+	defer close(keys)
+	buf := make([]byte, 1)
+	for {
+		if _, err := r.Read(buf); err != nil {
+			return
+		}
+		keys <- buf[0]
+	}
+}
+
+func terminalWidth() int {
+	w, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || w <= 0 {
+		return 80
+	}
+	return w
+}
+
+// renderWatch draws a full frame. Lines end in \r\n because the terminal
+// is in raw mode while watching.
+func renderWatch(w io.Writer, s *watchState, width int) {
+	fmt.Fprint(w, ansiClear)
+
+	title := "Top videos"
+	if s.view == viewRecent {
+		title = "Recently viewed videos"
+	}
+	fmt.Fprintf(w, "%s%s (n=%d)%s  refreshed %s every %s\r\n", ansiBold, title, s.n, ansiReset, s.at.Format("15:04:05"), watchInterval)
+	fmt.Fprintf(w, "%s[t] top  [r] recent  [tab] toggle  [+/-] n  [space] refresh  [q] quit%s\r\n\r\n", ansiDim, ansiReset)
+
+	if s.err != nil {
+		fmt.Fprintf(w, "%serror: %v%s\r\n", ansiRed, s.err, ansiReset)
+		return
+	}
+	if len(s.rows) == 0 {
+		fmt.Fprint(w, "No videos available\r\n")
+		return
+	}
+
+	idWidth := width - 44
+	if idWidth < 8 {
+		idWidth = 8
+	}
+	fmt.Fprintf(w, "%s%5s %-6s %-*s %10s %8s %9s%s\r\n", ansiBold, "RANK", "MOVE", idWidth, "VIDEO", "VIEWS", "DELTA", "VIEWS/S", ansiReset)
+	for _, row := range s.rows {
+		color, move := "", ""
+		switch {
+		case row.New:
+			color, move = ansiYellow, "new"
+		case row.RankChange > 0:
+			color, move = ansiGreen, fmt.Sprintf("▲%d", row.RankChange)
+		case row.RankChange < 0:
+			color, move = ansiRed, fmt.Sprintf("▼%d", -row.RankChange)
+		}
+		fmt.Fprintf(w, "%s%5d %-6s %-*s %10d %+8d %9.2f%s\r\n",
+			color, row.Rank, move, idWidth, truncate(row.Id, idWidth), row.Views, row.Delta, row.PerSecond, ansiReset)
+	}
+}
+
+func truncate(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max-1]) + "…"
+}
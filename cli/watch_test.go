@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"testing"
+	"time"
+	"view_count/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeaderboardUpdate(t *testing.T) {
+	lb := &leaderboard{}
+	start := time.Now()
+
+	rows := lb.update([]model.VideoInfo{
+		{Id: "video1", Views: 10},
+		{Id: "video2", Views: 5},
+	}, start)
+
+	assert.Equal(t, []leaderboardRow{
+		{Rank: 1, Id: "video1", Views: 10},
+		{Rank: 2, Id: "video2", Views: 5},
+	}, rows)
+
+	rows = lb.update([]model.VideoInfo{
+		{Id: "video2", Views: 15},
+		{Id: "video1", Views: 12},
+		{Id: "video3", Views: 1},
+	}, start.Add(2*time.Second))
+
+	assert.Equal(t, []leaderboardRow{
+		{Rank: 1, Id: "video2", Views: 15, Delta: 10, PerSecond: 5, RankChange: 1},
+		{Rank: 2, Id: "video1", Views: 12, Delta: 2, PerSecond: 1, RankChange: -1},
+		{Rank: 3, Id: "video3", Views: 1, New: true},
+	}, rows)
+}
+
+func TestLeaderboardPeek(t *testing.T) {
+	lb := &leaderboard{}
+	start := time.Now()
+
+	// without a snapshot, peek takes one.
+	lb.peek([]model.VideoInfo{{Id: "video1", Views: 10}}, start)
+
+	rows := lb.peek([]model.VideoInfo{{Id: "video1", Views: 11}}, start.Add(time.Second))
+	assert.Equal(t, []leaderboardRow{
+		{Rank: 1, Id: "video1", Views: 11, Delta: 1, PerSecond: 1},
+	}, rows)
+
+	// the baseline is still the first snapshot.
+	rows = lb.update([]model.VideoInfo{{Id: "video1", Views: 14}}, start.Add(2*time.Second))
+	assert.Equal(t, []leaderboardRow{
+		{Rank: 1, Id: "video1", Views: 14, Delta: 4, PerSecond: 2},
+	}, rows)
+}
+
+func TestWatchStateHandleKey(t *testing.T) {
+	snapshot := func(s *watchState) {
+		s.board.update([]model.VideoInfo{{Id: "video1", Views: 10}}, time.Now())
+	}
+
+	t.Run("Quit keys", func(t *testing.T) {
+		for _, k := range []byte{'q', 'Q', 3} {
+			s := &watchState{view: viewTop, n: 10}
+			assert.True(t, s.handleKey(k), "key %q", k)
+		}
+	})
+
+	t.Run("Switching views drops the snapshot", func(t *testing.T) {
+		s := &watchState{view: viewTop, n: 10}
+		snapshot(s)
+
+		assert.False(t, s.handleKey('r'))
+		assert.Equal(t, viewRecent, s.view)
+		assert.Nil(t, s.board.prev)
+
+		snapshot(s)
+		assert.False(t, s.handleKey('\t'))
+		assert.Equal(t, viewTop, s.view)
+		assert.Nil(t, s.board.prev)
+
+		snapshot(s)
+		assert.False(t, s.handleKey('\t'))
+		assert.Equal(t, viewRecent, s.view)
+		assert.Nil(t, s.board.prev)
+	})
+
+	t.Run("Selecting the current view keeps the snapshot", func(t *testing.T) {
+		s := &watchState{view: viewTop, n: 10}
+		snapshot(s)
+
+		assert.False(t, s.handleKey('t'))
+		assert.Equal(t, viewTop, s.view)
+		assert.NotNil(t, s.board.prev)
+	})
+
+	t.Run("N stays positive", func(t *testing.T) {
+		s := &watchState{view: viewTop, n: 1}
+		s.handleKey('+')
+		s.handleKey('=')
+		assert.Equal(t, 3, s.n)
+		for i := 0; i < 5; i++ {
+			s.handleKey('-')
+		}
+		assert.Equal(t, 1, s.n)
+	})
+
+	t.Run("Other keys only refresh", func(t *testing.T) {
+		s := &watchState{view: viewTop, n: 10}
+		snapshot(s)
+
+		assert.False(t, s.handleKey(' '))
+		assert.Equal(t, viewTop, s.view)
+		assert.Equal(t, 10, s.n)
+		assert.NotNil(t, s.board.prev)
+	})
+}
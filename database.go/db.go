@@ -53,6 +53,59 @@ func CreateDB(dbName string) error {
             views INT NOT NULL,
             last_updated TIMESTAMP NOT NULL
         );
+        CREATE INDEX IF NOT EXISTS videos_views_idx ON videos (views);
+        CREATE TABLE IF NOT EXISTS idempotency_keys (
+            key TEXT PRIMARY KEY,
+            video_id TEXT NOT NULL,
+            expires_at TIMESTAMP NOT NULL
+        );
+        CREATE TABLE IF NOT EXISTS webhooks (
+            id TEXT PRIMARY KEY,
+            url TEXT NOT NULL,
+            secret TEXT NOT NULL,
+            video_id TEXT NOT NULL DEFAULT '',
+            thresholds INT[] NOT NULL,
+            created_at TIMESTAMP NOT NULL
+        );
+        CREATE TABLE IF NOT EXISTS webhook_milestones (
+            webhook_id TEXT NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+            video_id TEXT NOT NULL,
+            threshold INT NOT NULL,
+            fired_at TIMESTAMP NOT NULL,
+            PRIMARY KEY (webhook_id, video_id, threshold)
+        );
+        CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+            id TEXT PRIMARY KEY,
+            webhook_id TEXT NOT NULL,
+            payload TEXT NOT NULL,
+            attempts INT NOT NULL,
+            last_error TEXT NOT NULL,
+            failed_at TIMESTAMP NOT NULL
+        );
+        CREATE TABLE IF NOT EXISTS invalid_views (
+            video_id TEXT NOT NULL,
+            reason TEXT NOT NULL,
+            views INT NOT NULL,
+            PRIMARY KEY (video_id, reason)
+        );
+        CREATE TABLE IF NOT EXISTS quarantined_views (
+            id BIGSERIAL PRIMARY KEY,
+            video_id TEXT NOT NULL,
+            reason TEXT NOT NULL,
+            ip TEXT NOT NULL,
+            user_agent TEXT NOT NULL,
+            viewed_at TIMESTAMP NOT NULL
+        );
+        CREATE INDEX IF NOT EXISTS quarantined_views_viewed_at_idx ON quarantined_views (viewed_at);
+        CREATE TABLE IF NOT EXISTS api_keys (
+            id TEXT PRIMARY KEY,
+            name TEXT NOT NULL,
+            role TEXT NOT NULL,
+            key_hash TEXT NOT NULL UNIQUE,
+            created_at TIMESTAMP NOT NULL,
+            last_used_at TIMESTAMP,
+            revoked_at TIMESTAMP
+        );
     `)
 	if err != nil {
 		return err
@@ -0,0 +1,91 @@
+package gql
+
+import (
+	"strconv"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// defaultListSize is the n assumed for list fields whose n is not given.
+const defaultListSize = 10
+
+// complexity estimates what executing op costs: every field counts one,
+// and the fields selected below a list count once per item the list can
+// hold. Introspection is counted the same way, so the playground's schema
+// query fits a limit of a few hundred.
+func complexity(op *ast.OperationDefinition, fragments map[string]*ast.FragmentDefinition, vars map[string]interface{}) int {
+	return selectionCost(op.SelectionSet, fragments, vars)
+}
+
+func selectionCost(set *ast.SelectionSet, fragments map[string]*ast.FragmentDefinition, vars map[string]interface{}) int {
+	if set == nil {
+		return 0
+	}
+	cost := 0
+	for _, sel := range set.Selections {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			cost += 1 + listSize(sel, vars)*selectionCost(sel.SelectionSet, fragments, vars)
+		case *ast.InlineFragment:
+			cost += selectionCost(sel.SelectionSet, fragments, vars)
+		case *ast.FragmentSpread:
+			// Validation has rejected unknown and cyclic fragments.
+			if f := fragments[sel.Name.Value]; f != nil {
+				cost += selectionCost(f.SelectionSet, fragments, vars)
+			}
+		}
+	}
+	return cost
+}
+
+// listSize is how many items field can return: n for the leaderboards and
+// the number of ids for videos. Other fields count as one.
+func listSize(field *ast.Field, vars map[string]interface{}) int {
+	switch field.Name.Value {
+	case "topVideos", "recentVideos":
+		if n, ok := argument(field, "n", vars).(int); ok && n > 0 {
+			return n
+		}
+		return defaultListSize
+	case "videos":
+		if ids, ok := argument(field, "ids", vars).([]interface{}); ok {
+			return max(len(ids), 1)
+		}
+	}
+	return 1
+}
+
+// argument returns the value of the named argument of field as an int, a
+// []interface{} or nil.
+func argument(field *ast.Field, name string, vars map[string]interface{}) interface{} {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value == name {
+			return value(arg.Value, vars)
+		}
+	}
+	return nil
+}
+
+func value(v ast.Value, vars map[string]interface{}) interface{} {
+	switch v := v.(type) {
+	case *ast.IntValue:
+		n, _ := strconv.Atoi(v.Value)
+		return n
+	case *ast.ListValue:
+		items := make([]interface{}, len(v.Values))
+		for i, item := range v.Values {
+			items[i] = value(item, vars)
+		}
+		return items
+	case *ast.Variable:
+		switch val := vars[v.Name.Value].(type) {
+		case float64: // variables decoded from JSON
+			return int(val)
+		case int:
+			return val
+		case []interface{}:
+			return val
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package gql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"view_count/model"
+	"view_count/repository/viewrepository"
+	"view_count/viewservice"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingService counts the lookups the loader makes.
+type countingService struct {
+	getView, getViews, getAllViews int
+	viewservice.Service
+}
+
+func (s *countingService) GetView(ctx context.Context, videoId string) (int, error) {
+	s.getView++
+	return s.Service.GetView(ctx, videoId)
+}
+
+func (s *countingService) GetViews(ctx context.Context, ids []string) (map[string]int, error) {
+	s.getViews++
+	return s.Service.GetViews(ctx, ids)
+}
+
+func (s *countingService) GetAllViews(ctx context.Context) ([]model.VideoInfo, error) {
+	s.getAllViews++
+	return s.Service.GetAllViews(ctx)
+}
+
+var testConfig = Config{MaxComplexity: 100, MaxN: 20, Playground: true}
+
+func newTestHandler(t *testing.T, cfg Config) (*Handler, *countingService) {
+	t.Helper()
+	svc := &countingService{Service: viewservice.NewService(viewrepository.NewInmemoryRepo())}
+	for _, id := range []string{"video1", "video1", "video1", "video2", "video2", "video3"} {
+		require.NoError(t, svc.Increment(context.Background(), id))
+	}
+	h, err := NewHandler(svc, cfg)
+	require.NoError(t, err)
+	return h, svc
+}
+
+type response struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func post(t *testing.T, h http.Handler, query string, vars map[string]interface{}) (int, response) {
+	t.Helper()
+	body, _ := json.Marshal(request{Query: query, Variables: vars})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body))))
+
+	var res response
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	return rec.Code, res
+}
+
+func TestQuery(t *testing.T) {
+	h, _ := newTestHandler(t, testConfig)
+
+	code, res := post(t, h, `{
+		video(id: "video2") { id views }
+		topVideos(n: 2) { id views }
+		recentVideos { id }
+	}`, nil)
+	require.Equal(t, http.StatusOK, code)
+	require.Empty(t, res.Errors)
+	assert.JSONEq(t, `{"id":"video2","views":2}`, string(res.Data["video"]))
+	assert.JSONEq(t, `[{"id":"video1","views":3},{"id":"video2","views":2}]`, string(res.Data["topVideos"]))
+	assert.JSONEq(t, `[{"id":"video3"},{"id":"video2"},{"id":"video1"}]`, string(res.Data["recentVideos"]))
+
+	t.Run("Variables", func(t *testing.T) {
+		code, res := post(t, h, `query($ids: [ID!]!) { videos(ids: $ids) { id views } }`, map[string]interface{}{"ids": []string{"video3", "unseen"}})
+		require.Equal(t, http.StatusOK, code)
+		assert.JSONEq(t, `[{"id":"video3","views":1},{"id":"unseen","views":0}]`, string(res.Data["videos"]))
+	})
+
+	t.Run("GET", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/graphql?query="+url.QueryEscape(`{ video(id: "video1") { views } }`), nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"data":{"video":{"views":3}}}`, rec.Body.String())
+	})
+
+	t.Run("Invalid arguments", func(t *testing.T) {
+		code, res := post(t, h, `{ topVideos(n: 21) { id } }`, nil)
+		assert.Equal(t, http.StatusOK, code)
+		require.Len(t, res.Errors, 1)
+		assert.Contains(t, res.Errors[0].Message, "n must be between 1 and 20")
+	})
+}
+
+func TestLoaderBatches(t *testing.T) {
+	h, svc := newTestHandler(t, testConfig)
+
+	_, res := post(t, h, `{
+		a: video(id: "video1") { views }
+		b: video(id: "video2") { views }
+		c: video(id: "video3") { views }
+		d: video(id: "video1") { views }
+	}`, nil)
+	require.Empty(t, res.Errors)
+	assert.JSONEq(t, `{"views":1}`, string(res.Data["c"]))
+	assert.Equal(t, 1, svc.getViews)
+	assert.Equal(t, 0, svc.getView+svc.getAllViews)
+
+	t.Run("Primed by leaderboards", func(t *testing.T) {
+		svc.getView, svc.getViews, svc.getAllViews = 0, 0, 0
+		_, res := post(t, h, `{ topVideos(n: 3) { id } video(id: "video2") { views } }`, nil)
+		require.Empty(t, res.Errors)
+		assert.JSONEq(t, `{"views":2}`, string(res.Data["video"]))
+		assert.Equal(t, 0, svc.getView+svc.getViews+svc.getAllViews)
+	})
+}
+
+func TestComplexity(t *testing.T) {
+	h, svc := newTestHandler(t, testConfig)
+
+	for name, query := range map[string]string{
+		"literal":  `{ a: topVideos(n: 20) { id views } b: topVideos(n: 20) { id views } recentVideos(n: 20) { id views } }`,
+		"fragment": `{ a: topVideos(n: 20) { ...f } b: topVideos(n: 20) { ...f } recentVideos(n: 20) { ...f } } fragment f on Video { id views }`,
+		"default":  `{ a: topVideos { id views } b: topVideos { id views } c: topVideos { id views } d: topVideos { id views } e: topVideos { id views } }`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			code, res := post(t, h, query, nil)
+			assert.Equal(t, http.StatusBadRequest, code)
+			require.Len(t, res.Errors, 1)
+			assert.Contains(t, res.Errors[0].Message, "exceeds the limit of 100")
+		})
+	}
+
+	t.Run("Variables", func(t *testing.T) {
+		code, _ := post(t, h, `query($n: Int) { a: topVideos(n: $n) { id views } b: topVideos(n: $n) { id views } c: topVideos(n: $n) { id views } }`, map[string]interface{}{"n": 20})
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	assert.Equal(t, 0, svc.getView+svc.getViews+svc.getAllViews, "rejected queries run no resolver")
+}
+
+func TestPlayground(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		cfg := testConfig
+		cfg.Playground = enabled
+		h, _ := newTestHandler(t, cfg)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/graphql", nil))
+		if enabled {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Contains(t, rec.Body.String(), "graphiql")
+		} else {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Package gql serves a GraphQL API over viewservice.Service, so clients
+// can fetch a video's count together with the leaderboards in one request.
+package gql
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"view_count/viewservice"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// maxBodySize bounds POST bodies.
+const maxBodySize = 1 << 20
+
+//go:embed playground.html
+var playground []byte
+
+// Config configures a Handler.
+type Config struct {
+	// MaxComplexity bounds the estimated cost of a query; see complexity.
+	MaxComplexity int
+	// MaxN bounds n of topVideos and recentVideos and the ids of videos.
+	MaxN int
+	// Playground serves a GraphiQL page to browsers that GET the endpoint
+	// without a query.
+	Playground bool
+}
+
+// Handler serves GraphQL queries sent as GET parameters or POSTed JSON.
+type Handler struct {
+	svc    viewservice.Service
+	schema graphql.Schema
+	cfg    Config
+}
+
+func NewHandler(svc viewservice.Service, cfg Config) (*Handler, error) {
+	schema, err := newSchema(&resolver{svc: svc, maxN: cfg.MaxN})
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{svc: svc, schema: schema, cfg: cfg}, nil
+}
+
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		if req.Query == "" && h.cfg.Playground {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(playground)
+			return
+		}
+		req.OperationName = q.Get("operationName")
+		if vars := q.Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				writeResult(w, http.StatusBadRequest, requestError("variables must be a JSON object"))
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&req); err != nil {
+			writeResult(w, http.StatusBadRequest, requestError("body must be a JSON object with a query"))
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if req.Query == "" {
+		writeResult(w, http.StatusBadRequest, requestError("query is required"))
+		return
+	}
+
+	status, res := h.execute(r.Context(), req)
+	writeResult(w, status, res)
+}
+
+// execute runs req. Queries that do not parse, validate or fit
+// MaxComplexity are rejected with 400 before any resolver runs.
+func (h *Handler) execute(ctx context.Context, req request) (int, *graphql.Result) {
+	doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+	if err != nil {
+		return http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+	if v := graphql.ValidateDocument(&h.schema, doc, graphql.SpecifiedRules); !v.IsValid {
+		return http.StatusBadRequest, &graphql.Result{Errors: v.Errors}
+	}
+	if op, fragments := operation(doc, req.OperationName); op != nil {
+		if c := complexity(op, fragments, req.Variables); c > h.cfg.MaxComplexity {
+			return http.StatusBadRequest, requestError(fmt.Sprintf("query complexity %d exceeds the limit of %d", c, h.cfg.MaxComplexity))
+		}
+	}
+
+	return http.StatusOK, graphql.Execute(graphql.ExecuteParams{
+		Schema:        h.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       newLoaderContext(ctx, newViewLoader(h.svc)),
+	})
+}
+
+// operation returns the operation of doc that will be executed, or nil
+// when there is none, which Execute reports.
+func operation(doc *ast.Document, name string) (*ast.OperationDefinition, map[string]*ast.FragmentDefinition) {
+	var op *ast.OperationDefinition
+	var ops int
+	fragments := make(map[string]*ast.FragmentDefinition)
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.OperationDefinition:
+			ops++
+			if name == "" || (def.Name != nil && def.Name.Value == name) {
+				op = def
+			}
+		case *ast.FragmentDefinition:
+			fragments[def.Name.Value] = def
+		}
+	}
+	if name == "" && ops > 1 {
+		return nil, fragments
+	}
+	return op, fragments
+}
+
+func requestError(msg string) *graphql.Result {
+	return &graphql.Result{Errors: []gqlerrors.FormattedError{gqlerrors.NewFormattedError(msg)}}
+}
+
+func writeResult(w http.ResponseWriter, status int, res *graphql.Result) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,104 @@
+package gql
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"view_count/model"
+	"view_count/viewservice"
+)
+
+// viewLoader collects the videos a query asks for while its fields are
+// resolved and reads all of them with one lookup once the first of them is
+// needed. The executor resolves every field of a level before it evaluates
+// their thunks, so a query naming fifty videos costs one lookup, not fifty.
+// A loader lives for one request.
+type viewLoader struct {
+	svc viewservice.Service
+
+	mu      sync.Mutex
+	pending []string
+	views   map[string]int
+	errs    map[string]error
+}
+
+func newViewLoader(svc viewservice.Service) *viewLoader {
+	return &viewLoader{
+		svc:   svc,
+		views: make(map[string]int),
+		errs:  make(map[string]error),
+	}
+}
+
+type loaderKey struct{}
+
+func newLoaderContext(ctx context.Context, l *viewLoader) context.Context {
+	return context.WithValue(ctx, loaderKey{}, l)
+}
+
+func loaderFromContext(ctx context.Context) *viewLoader {
+	l, _ := ctx.Value(loaderKey{}).(*viewLoader)
+	return l
+}
+
+// prime records views that a list field has already read. Fields of a
+// level resolve in no particular order, so those already queued are taken
+// off the pending lookup.
+func (l *viewLoader) prime(videos []model.VideoInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, v := range videos {
+		l.views[v.Id] = v.Views
+	}
+	l.pending = slices.DeleteFunc(l.pending, l.known)
+}
+
+// load queues ids and returns a thunk yielding their videos in order.
+func (l *viewLoader) load(ctx context.Context, ids ...string) func() ([]model.VideoInfo, error) {
+	l.mu.Lock()
+	for _, id := range ids {
+		if !l.known(id) && !slices.Contains(l.pending, id) {
+			l.pending = append(l.pending, id)
+		}
+	}
+	l.mu.Unlock()
+
+	return func() ([]model.VideoInfo, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if len(l.pending) > 0 {
+			l.dispatch(ctx)
+		}
+		videos := make([]model.VideoInfo, len(ids))
+		for i, id := range ids {
+			if err := l.errs[id]; err != nil {
+				return nil, err
+			}
+			videos[i] = model.VideoInfo{Id: id, Views: l.views[id]}
+		}
+		return videos, nil
+	}
+}
+
+func (l *viewLoader) known(id string) bool {
+	_, ok := l.views[id]
+	if !ok {
+		_, ok = l.errs[id]
+	}
+	return ok
+}
+
+// dispatch reads every pending video with one GetViews.
+func (l *viewLoader) dispatch(ctx context.Context) {
+	ids := l.pending
+	l.pending = nil
+
+	views, err := l.svc.GetViews(ctx, ids)
+	for _, id := range ids {
+		if err != nil {
+			l.errs[id] = err
+		} else {
+			l.views[id] = views[id]
+		}
+	}
+}
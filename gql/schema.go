@@ -0,0 +1,161 @@
+package gql
+
+import (
+	"errors"
+	"fmt"
+	"view_count/model"
+	"view_count/viewservice"
+
+	"github.com/graphql-go/graphql"
+)
+
+// errServer replaces errors that are not the caller's fault, so queries
+// do not leak database errors.
+var errServer = errors.New("server error")
+
+type resolver struct {
+	svc  viewservice.Service
+	maxN int
+}
+
+func newSchema(r *resolver) (graphql.Schema, error) {
+	video := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Video",
+		Description: "A video and its all-time view count.",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.ID),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(model.VideoInfo).Id, nil
+				},
+			},
+			"views": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(model.VideoInfo).Views, nil
+				},
+			},
+		},
+	})
+	videoList := graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(video)))
+	n := graphql.FieldConfigArgument{
+		"n": &graphql.ArgumentConfig{
+			Type:         graphql.Int,
+			DefaultValue: defaultListSize,
+			Description:  fmt.Sprintf("Number of videos, at most %d.", r.maxN),
+		},
+	}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"video": &graphql.Field{
+				Type:        graphql.NewNonNull(video),
+				Description: "A video by id. Videos never viewed have 0 views.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: r.video,
+			},
+			"videos": &graphql.Field{
+				Type:        videoList,
+				Description: "Several videos by id, in the order asked for.",
+				Args: graphql.FieldConfigArgument{
+					"ids": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.ID)))},
+				},
+				Resolve: r.videos,
+			},
+			"topVideos": &graphql.Field{
+				Type:        videoList,
+				Description: "The most viewed videos, most viewed first.",
+				Args:        n,
+				Resolve:     r.topVideos,
+			},
+			"recentVideos": &graphql.Field{
+				Type:        videoList,
+				Description: "The most recently viewed videos, latest first.",
+				Args:        n,
+				Resolve:     r.recentVideos,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+func (r *resolver) video(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["id"].(string)
+	if id == "" {
+		return nil, viewservice.ErrInvalidArgument
+	}
+	load := loaderFromContext(p.Context).load(p.Context, id)
+	return func() (interface{}, error) {
+		videos, err := load()
+		if err != nil {
+			return nil, publicError(err)
+		}
+		return videos[0], nil
+	}, nil
+}
+
+func (r *resolver) videos(p graphql.ResolveParams) (interface{}, error) {
+	args, _ := p.Args["ids"].([]interface{})
+	if len(args) > r.maxN {
+		return nil, fmt.Errorf("at most %d ids may be asked for", r.maxN)
+	}
+	ids := make([]string, len(args))
+	for i, arg := range args {
+		if ids[i], _ = arg.(string); ids[i] == "" {
+			return nil, viewservice.ErrInvalidArgument
+		}
+	}
+	load := loaderFromContext(p.Context).load(p.Context, ids...)
+	return func() (interface{}, error) {
+		videos, err := load()
+		if err != nil {
+			return nil, publicError(err)
+		}
+		return videos, nil
+	}, nil
+}
+
+func (r *resolver) topVideos(p graphql.ResolveParams) (interface{}, error) {
+	n, err := r.n(p)
+	if err != nil {
+		return nil, err
+	}
+	videos, err := r.svc.GetTopVideos(p.Context, n)
+	if err != nil {
+		return nil, publicError(err)
+	}
+	loaderFromContext(p.Context).prime(videos)
+	return videos, nil
+}
+
+func (r *resolver) recentVideos(p graphql.ResolveParams) (interface{}, error) {
+	n, err := r.n(p)
+	if err != nil {
+		return nil, err
+	}
+	videos, err := r.svc.GetRecentVideos(p.Context, n)
+	if err != nil {
+		return nil, publicError(err)
+	}
+	loaderFromContext(p.Context).prime(videos)
+	return videos, nil
+}
+
+func (r *resolver) n(p graphql.ResolveParams) (int, error) {
+	n, _ := p.Args["n"].(int)
+	if n < 1 || n > r.maxN {
+		return 0, fmt.Errorf("n must be between 1 and %d", r.maxN)
+	}
+	return n, nil
+}
+
+func publicError(err error) error {
+	if errors.Is(err, viewservice.ErrInvalidArgument) {
+		return err
+	}
+	return errServer
+}
@@ -4,8 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
+	"view_count/model"
+	"view_count/ratelimit"
 	"view_count/viewservice"
 
 	"github.com/gorilla/mux"
@@ -13,42 +17,52 @@ import (
 
 type handler struct {
 	viewService viewservice.Service
+	// idempotencyTTL is how long Idempotency-Key values are remembered.
+	idempotencyTTL time.Duration
+	// maxBatchSize caps the video ids of one bulk lookup.
+	maxBatchSize int
 }
 
-func NewHandler(viewservice viewservice.Service) *handler {
+func NewHandler(vs viewservice.Service) *handler {
 	return &handler{
-		viewService: viewservice,
+		viewService:  vs,
+		maxBatchSize: viewservice.DefaultMaxBatchSize,
 	}
 }
 
-// Job of transport Routing, Encoding, Decoding : Done
-func (h *handler) handleIndex(w http.ResponseWriter, r *http.Request) {
+// listEncoders encode the lists of the index, top and recent routes: as
+// the HTML page unless the client prefers another format, with JSON as a
+// bare array.
+var listEncoders = append(viewservice.Encoders{{ContentType: "text/html; charset=utf-8", Encode: encodeHTML}},
+	viewservice.ListEncoders(viewservice.Encoder{ContentType: "application/json", Encode: func(w io.Writer, videos []model.VideoInfo) error {
+		return json.NewEncoder(w).Encode(videos)
+	}})...)
 
-	acceptHeader := r.Header.Get("Accept")
-	videos, err := h.viewService.GetAllViews(r.Context())
+func encodeHTML(w io.Writer, videos []model.VideoInfo) error {
+	templ, err := template.ParseFiles("templates/index.gohtml")
 	if err != nil {
-		http.Error(w, "server error.", http.StatusInternalServerError)
-		return
+		return err
 	}
+	return templ.Execute(w, videos)
+}
 
-	if acceptHeader == "application/json" {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(videos)
-		return
+// writeList replies with videos in the format r prefers.
+func writeList(w http.ResponseWriter, r *http.Request, videos []model.VideoInfo) {
+	if err := listEncoders.Write(w, r.Header.Get("Accept"), videos); err != nil {
+		http.Error(w, "server error.", http.StatusInternalServerError)
 	}
+}
 
-	templ, err := template.ParseFiles("templates/index.gohtml")
-	if err != nil {
-		http.Error(w, "Template error", http.StatusInternalServerError)
-		return
-	}
-	err = templ.Execute(w, videos)
+// Job of transport Routing, Encoding, Decoding : Done
+func (h *handler) handleIndex(w http.ResponseWriter, r *http.Request) {
+
+	videos, err := h.viewService.GetAllViews(r.Context())
 	if err != nil {
-		http.Error(w, "Error executing template", http.StatusInternalServerError)
-		fmt.Println("Template execution error:", err)
+		http.Error(w, "server error.", http.StatusInternalServerError)
 		return
 	}
 
+	writeList(w, r, videos)
 }
 
 func (h *handler) handleViews(w http.ResponseWriter, r *http.Request) {
@@ -70,22 +84,98 @@ func (h *handler) handleViews(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "Number of views for video#%s: %d", videoID, views)
 }
 
+// viewsBatchRequest is the body of POST /views:batch.
+type viewsBatchRequest struct {
+	Ids []string `json:"ids"`
+}
+
+type viewsResponse struct {
+	Views map[string]int `json:"views"`
+}
+
+// handleViewsQuery looks up the videos of the repeated id query parameter.
+func (h *handler) handleViewsQuery(w http.ResponseWriter, r *http.Request) {
+	h.writeViews(w, r, r.URL.Query()["id"])
+}
+
+// handleViewsBatch looks up the videos listed in a JSON body, for lists
+// too long for a URL.
+func (h *handler) handleViewsBatch(w http.ResponseWriter, r *http.Request) {
+	var req viewsBatchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	h.writeViews(w, r, req.Ids)
+}
+
+func (h *handler) writeViews(w http.ResponseWriter, r *http.Request, ids []string) {
+	if len(ids) == 0 || len(ids) > h.maxBatchSize {
+		http.Error(w, fmt.Sprintf("between 1 and %d video ids are required", h.maxBatchSize), http.StatusBadRequest)
+		return
+	}
+	views, err := h.viewService.GetViews(r.Context(), ids)
+	switch err {
+	case nil:
+	case viewservice.ErrInvalidArgument:
+		http.Error(w, "VideoIDs must not be empty.", http.StatusBadRequest)
+		return
+	default:
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(viewsResponse{Views: views})
+}
+
 func (h *handler) handleIncrement(w http.ResponseWriter, r *http.Request) {
 	// TODO: use gorilla mux : done
 	vars := mux.Vars(r)
 	videoID := vars["vID"]
 
-	err := h.viewService.Increment(r.Context(), videoID)
+	ctx := r.Context()
+	key := r.Header.Get("Idempotency-Key")
+	if key != "" && !viewservice.ValidIdempotencyKey(key) {
+		http.Error(w, "Idempotency-Key must be 1 to 255 printable ASCII characters.", http.StatusBadRequest)
+		return
+	}
+	if token := viewservice.ViewTokenFromRequest(r); token != "" {
+		ctx = viewservice.NewViewTokenContext(ctx, token)
+	}
+
+	var (
+		replayed bool
+		err      error
+	)
+	if key != "" {
+		replayed, err = h.viewService.IncrementOnce(ctx, videoID, key, h.idempotencyTTL)
+	} else {
+		err = h.viewService.Increment(ctx, videoID)
+	}
+	if retryAfter, limited := ratelimit.RetryAfter(err); limited {
+		ratelimit.WriteTooManyRequests(w, r, retryAfter)
+		return
+	}
 	switch err {
 	case nil:
 	case viewservice.ErrInvalidArgument:
 		http.Error(w, "VideoID is Required.", http.StatusBadRequest)
 		return
+	case viewservice.ErrIdempotencyKeyReused:
+		http.Error(w, "Idempotency-Key was already used for another video.", http.StatusUnprocessableEntity)
+		return
+	case viewservice.ErrViewTokenRequired, viewservice.ErrViewTokenInvalid, viewservice.ErrViewTokenReplayed:
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
 	default:
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
 
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
 	fmt.Fprintf(w, "Success#%s", videoID)
 }
 
@@ -96,32 +186,16 @@ func (h *handler) handleTopVideos(w http.ResponseWriter, r *http.Request) {
 	n, err := strconv.Atoi(nStr)
 	if err != nil {
 		http.Error(w, "Invalid n parameter", http.StatusBadRequest)
+		return
 	}
 
-	acceptHeader := r.Header.Get("Accept")
 	videos, err := h.viewService.GetTopVideos(r.Context(), n)
 	if err != nil {
 		http.Error(w, "server error.", http.StatusInternalServerError)
 		return
 	}
 
-	if acceptHeader == "application/json" {
-		w.Header().Set("content-type", "application/json")
-		json.NewEncoder(w).Encode(videos)
-		return
-	}
-
-	templ, err := template.ParseFiles("templates/index.gohtml")
-	if err != nil {
-		http.Error(w, "Template error", http.StatusInternalServerError)
-		return
-	}
-	err = templ.Execute(w, videos)
-	if err != nil {
-		http.Error(w, "Error executing template", http.StatusInternalServerError)
-		fmt.Println("Template execution error:", err)
-		return
-	}
+	writeList(w, r, videos)
 }
 
 func (h *handler) handleRecentVideos(w http.ResponseWriter, r *http.Request) {
@@ -130,6 +204,7 @@ func (h *handler) handleRecentVideos(w http.ResponseWriter, r *http.Request) {
 	n, err := strconv.Atoi(nStr)
 	if err != nil {
 		http.Error(w, "Invalid n parameter", http.StatusBadRequest)
+		return
 	}
 
 	videos, err := h.viewService.GetRecentVideos(r.Context(), n)
@@ -138,17 +213,5 @@ func (h *handler) handleRecentVideos(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	acceptHeader := r.Header.Get("Accept")
-	if acceptHeader == "application/json" {
-		w.Header().Set("content-type", "application/json")
-		json.NewEncoder(w).Encode(videos)
-		return
-	}
-
-	templ, err := template.ParseFiles("templates/index.gohtml")
-	if err != nil {
-		http.Error(w, "Template error", http.StatusInternalServerError)
-		return
-	}
-	templ.Execute(w, videos)
+	writeList(w, r, videos)
 }
@@ -0,0 +1,128 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK       = "ok"
+	StatusDown     = "down"
+	StatusDegraded = "degraded"
+	StatusDraining = "draining"
+)
+
+// Check reports whether a dependency is usable. A nil error means healthy.
+type Check func(ctx context.Context) error
+
+// Checker serves liveness and readiness probes. Readiness runs every
+// registered Check and fails once SetDraining has been called, so load
+// balancers stop routing traffic before the server shuts down.
+type Checker struct {
+	mu       sync.RWMutex
+	checks   map[string]Check
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{
+		checks:  make(map[string]Check),
+		timeout: timeout,
+	}
+}
+
+// AddCheck registers a dependency check under name, replacing any
+// existing check with the same name.
+func (c *Checker) AddCheck(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// SetDraining makes readiness fail from now on.
+func (c *Checker) SetDraining() {
+	c.draining.Store(true)
+}
+
+type checkResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type report struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks,omitempty"`
+}
+
+// Liveness reports that the process is up and able to serve HTTP.
+func (c *Checker) Liveness(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, http.StatusOK, report{Status: StatusOK})
+}
+
+// Readiness reports whether every dependency is reachable. It responds with
+// 503 and the failing dependencies when any check fails or while draining.
+func (c *Checker) Readiness(w http.ResponseWriter, r *http.Request) {
+	rep := c.run(r.Context())
+	status := http.StatusOK
+	if rep.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeReport(w, status, rep)
+}
+
+func (c *Checker) run(ctx context.Context) report {
+	c.mu.RLock()
+	names := make([]string, 0, len(c.checks))
+	for name := range c.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checks := make([]Check, len(names))
+	for i, name := range names {
+		checks[i] = c.checks[name]
+	}
+	c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make([]checkResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			if err := check(ctx); err != nil {
+				results[i] = checkResult{Status: StatusDown, Error: err.Error()}
+				return
+			}
+			results[i] = checkResult{Status: StatusOK}
+		}(i, check)
+	}
+	wg.Wait()
+
+	rep := report{Status: StatusOK, Checks: make(map[string]checkResult, len(names))}
+	for i, name := range names {
+		rep.Checks[name] = results[i]
+		if results[i].Status != StatusOK {
+			rep.Status = StatusDegraded
+		}
+	}
+	if c.draining.Load() {
+		rep.Status = StatusDraining
+	}
+	return rep
+}
+
+func writeReport(w http.ResponseWriter, status int, rep report) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(rep)
+}
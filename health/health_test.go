@@ -0,0 +1,63 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLiveness(t *testing.T) {
+	c := NewChecker(time.Second)
+	c.AddCheck("postgres", func(ctx context.Context) error { return errors.New("unreachable") })
+
+	rec := httptest.NewRecorder()
+	c.Liveness(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestReadiness(t *testing.T) {
+	var pingErr error
+	c := NewChecker(time.Second)
+	c.AddCheck("postgres", func(ctx context.Context) error { return pingErr })
+
+	readiness := func() (int, report) {
+		rec := httptest.NewRecorder()
+		c.Readiness(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var rep report
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&rep))
+		return rec.Code, rep
+	}
+
+	t.Run("Ready", func(t *testing.T) {
+		code, rep := readiness()
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, StatusOK, rep.Status)
+		assert.Equal(t, StatusOK, rep.Checks["postgres"].Status)
+	})
+
+	t.Run("Degraded dependency", func(t *testing.T) {
+		pingErr = errors.New("connection refused")
+		defer func() { pingErr = nil }()
+
+		code, rep := readiness()
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, StatusDegraded, rep.Status)
+		assert.Equal(t, checkResult{Status: StatusDown, Error: "connection refused"}, rep.Checks["postgres"])
+	})
+
+	t.Run("Draining", func(t *testing.T) {
+		c.SetDraining()
+
+		code, rep := readiness()
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, StatusDraining, rep.Status)
+	})
+}
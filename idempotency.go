@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"time"
+	"view_count/repository/viewrepository"
+
+	kitlog "github.com/go-kit/log"
+)
+
+// expireIdempotencyKeysWorker deletes expired idempotency keys every
+// interval so the table does not grow without bound.
+func expireIdempotencyKeysWorker(repo viewrepository.IdempotencyKeyExpirer, interval time.Duration, logger kitlog.Logger) worker {
+	return func(ctx context.Context) error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+
+			n, err := repo.ExpireIdempotencyKeys(ctx)
+			if err != nil && ctx.Err() == nil {
+				logger.Log("msg", "expiring idempotency keys failed", "err", err)
+			} else if n > 0 {
+				logger.Log("msg", "expired idempotency keys", "deleted", n)
+			}
+		}
+	}
+}
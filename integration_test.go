@@ -14,24 +14,29 @@ import (
 )
 
 var (
+	// pool is nil when Docker is unavailable, so only the tests that need
+	// it are skipped.
 	pool *dockertest.Pool
 )
 
 func TestMain(m *testing.M) {
 	var err error
 	pool, err = dockertest.NewPool("")
-	if err != nil {
-		log.Fatalf("Could not construct pool: %s", err)
+	if err == nil {
+		err = pool.Client.Ping()
 	}
-	err = pool.Client.Ping()
 	if err != nil {
-		log.Fatalf("Could not connect to Docker: %s", err)
+		log.Printf("Could not connect to Docker, skipping integration tests: %s", err)
+		pool = nil
 	}
 	code := m.Run()
 	os.Exit(code)
 }
 
 func TestPostgres(t *testing.T) {
+	if pool == nil {
+		t.Skip("Docker is unavailable")
+	}
 	resource, err := pool.Run("postgres", "latest", []string{
 		"POSTGRES_USER=postgres",
 		"POSTGRES_PASSWORD=secret",
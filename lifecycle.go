@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	kitlog "github.com/go-kit/log"
+	"github.com/oklog/run"
+	"google.golang.org/grpc"
+)
+
+// worker is a long-running background task. It must return once ctx is
+// cancelled.
+type worker func(ctx context.Context) error
+
+// server is a listener-backed actor. Its listener is opened by run.
+type server struct {
+	name           string
+	addr           string
+	serve          func(ln net.Listener) error
+	beforeShutdown func()
+	shutdown       func(ctx context.Context) error
+}
+
+// lifecycle runs the servers and workers of the process as a run group.
+// The first actor to return, usually the signal handler, interrupts all
+// others. Shutdown hooks then run and, after drainDelay, servers stop
+// accepting connections and drain in-flight requests. All servers share
+// a single deadline of shutdownTimeout after the drain delay. Workers are
+// cancelled only once every server has drained, since in-flight requests
+// depend on them.
+type lifecycle struct {
+	group           run.Group
+	logger          kitlog.Logger
+	drainDelay      time.Duration
+	shutdownTimeout time.Duration
+	servers         []server
+	workers         []worker
+	onShutdown      []func()
+
+	shutdownOnce sync.Once
+	shutdownCtx  context.Context
+	cancel       context.CancelFunc
+
+	mu   sync.Mutex
+	errs []error
+}
+
+func newLifecycle(logger kitlog.Logger, drainDelay, shutdownTimeout time.Duration) *lifecycle {
+	return &lifecycle{
+		logger:          logger,
+		drainDelay:      drainDelay,
+		shutdownTimeout: shutdownTimeout,
+	}
+}
+
+func (l *lifecycle) fail(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errs = append(l.errs, err)
+}
+
+// addShutdownHook runs f once when the group is interrupted, before the
+// drain delay and before any server stops accepting connections.
+func (l *lifecycle) addShutdownHook(f func()) {
+	l.onShutdown = append(l.onShutdown, f)
+}
+
+// shutdownContext runs the shutdown hooks and waits out the drain delay
+// on its first call. It returns the context every server drains within.
+func (l *lifecycle) shutdownContext() context.Context {
+	l.shutdownOnce.Do(func() {
+		l.logger.Log("msg", "shutdown begins", "drain_delay", l.drainDelay)
+		for _, f := range l.onShutdown {
+			f()
+		}
+		time.Sleep(l.drainDelay)
+		l.shutdownCtx, l.cancel = context.WithTimeout(context.Background(), l.shutdownTimeout)
+	})
+	return l.shutdownCtx
+}
+
+// addSignalHandler stops the group on SIGINT or SIGTERM.
+func (l *lifecycle) addSignalHandler(ctx context.Context) {
+	l.group.Add(run.SignalHandler(ctx, os.Interrupt, syscall.SIGTERM))
+}
+
+// addServer serves srv on its address. beforeShutdown, if not nil, runs
+// when the group is interrupted and before srv stops accepting connections.
+func (l *lifecycle) addServer(name string, srv *http.Server, beforeShutdown func()) {
+	l.servers = append(l.servers, server{
+		name: name,
+		addr: srv.Addr,
+		serve: func(ln net.Listener) error {
+			if err := srv.Serve(ln); err != http.ErrServerClosed {
+				return err
+			}
+			return nil
+		},
+		beforeShutdown: beforeShutdown,
+		shutdown:       srv.Shutdown,
+	})
+}
+
+// addGRPCServer serves srv on addr. beforeShutdown, if not nil, runs when
+// the group is interrupted and before srv stops gracefully. Calls still
+// running at the shutdown deadline are cancelled.
+func (l *lifecycle) addGRPCServer(name, addr string, srv *grpc.Server, beforeShutdown func()) {
+	l.servers = append(l.servers, server{
+		name:           name,
+		addr:           addr,
+		serve:          srv.Serve,
+		beforeShutdown: beforeShutdown,
+		shutdown: func(ctx context.Context) error {
+			stopped := make(chan struct{})
+			go func() {
+				srv.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+				return nil
+			case <-ctx.Done():
+				srv.Stop()
+				return errors.New(name + " server: graceful stop timed out")
+			}
+		},
+	})
+}
+
+// addWorker runs w until the group is interrupted and the servers have
+// drained.
+func (l *lifecycle) addWorker(name string, w worker) {
+	l.workers = append(l.workers, w)
+}
+
+// listen opens the listeners of every server. If one fails, those already
+// opened are closed.
+func (l *lifecycle) listen() ([]net.Listener, error) {
+	lns := make([]net.Listener, 0, len(l.servers))
+	for _, s := range l.servers {
+		ln, err := net.Listen("tcp", s.addr)
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return nil, err
+		}
+		lns = append(lns, ln)
+	}
+	return lns, nil
+}
+
+// run opens the server listeners and blocks until every actor has
+// returned. It returns nil when the process was stopped by a signal and
+// shut down cleanly.
+func (l *lifecycle) run() error {
+	lns, err := l.listen()
+	if err != nil {
+		return err
+	}
+	for i, s := range l.servers {
+		s, ln := s, lns[i]
+		l.group.Add(func() error {
+			l.logger.Log("msg", "server started", "server", s.name, "addr", ln.Addr().String())
+			return s.serve(ln)
+		}, func(error) {
+			ctx := l.shutdownContext()
+			if s.beforeShutdown != nil {
+				s.beforeShutdown()
+			}
+			if err := s.shutdown(ctx); err != nil {
+				l.fail(err)
+				l.logger.Log("msg", "server shutdown failed", "server", s.name, "err", err)
+				return
+			}
+			l.logger.Log("msg", "server closed gracefully", "server", s.name)
+		})
+	}
+
+	// run interrupts actors in the order they were added, so the servers
+	// drain before the workers they call into are cancelled.
+	for _, w := range l.workers {
+		w := w
+		ctx, cancel := context.WithCancel(context.Background())
+		l.group.Add(func() error {
+			err := w(ctx)
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+			return err
+		}, func(error) {
+			cancel()
+		})
+	}
+
+	err = l.group.Run()
+	if l.cancel != nil {
+		l.cancel()
+	}
+	var sig run.SignalError
+	if errors.As(err, &sig) {
+		l.logger.Log("msg", "shutdown complete", "signal", sig.Signal)
+		err = nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return errors.Join(append([]error{err}, l.errs...)...)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kitlog "github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// freeAddr returns a local address nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+	return addr
+}
+
+func TestLifecycle(t *testing.T) {
+	logger := kitlog.NewNopLogger()
+
+	t.Run("A failed listen closes the listeners already opened", func(t *testing.T) {
+		busy, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer busy.Close()
+		addr := freeAddr(t)
+
+		lc := newLifecycle(logger, 0, time.Second)
+		lc.addServer("first", &http.Server{Addr: addr}, nil)
+		lc.addServer("second", &http.Server{Addr: busy.Addr().String()}, nil)
+		require.Error(t, lc.run())
+
+		ln, err := net.Listen("tcp", addr)
+		require.NoError(t, err)
+		ln.Close()
+	})
+
+	t.Run("Servers share one shutdown deadline", func(t *testing.T) {
+		const timeout = 300 * time.Millisecond
+		entered := make(chan struct{}, 2)
+		release := make(chan struct{})
+		defer close(release)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			entered <- struct{}{}
+			<-release
+		})
+
+		var hooks int
+		stop := make(chan struct{})
+		lc := newLifecycle(logger, 0, timeout)
+		lc.addShutdownHook(func() { hooks++ })
+		addrs := []string{freeAddr(t), freeAddr(t)}
+		for _, addr := range addrs {
+			lc.addServer(addr, &http.Server{Addr: addr, Handler: handler}, nil)
+		}
+		lc.addWorker("stopper", func(ctx context.Context) error {
+			select {
+			case <-stop:
+				return errors.New("stop")
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+
+		done := make(chan error, 1)
+		go func() { done <- lc.run() }()
+		for _, addr := range addrs {
+			addr := addr
+			go func() {
+				for {
+					resp, err := http.Get("http://" + addr)
+					if err == nil {
+						resp.Body.Close()
+						return
+					}
+					select {
+					case <-release:
+						return
+					case <-time.After(10 * time.Millisecond):
+					}
+				}
+			}()
+		}
+		<-entered
+		<-entered
+
+		start := time.Now()
+		close(stop)
+		select {
+		case err := <-done:
+			assert.Error(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("run did not return")
+		}
+		assert.Less(t, time.Since(start), 2*timeout)
+		assert.Equal(t, 1, hooks)
+	})
+
+	t.Run("Workers run until the servers have drained", func(t *testing.T) {
+		entered := make(chan struct{})
+		release := make(chan struct{})
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(entered)
+			<-release
+		})
+
+		var cancelled atomic.Bool
+		draining := make(chan struct{})
+		stop := make(chan struct{})
+		lc := newLifecycle(logger, 0, 5*time.Second)
+		lc.addShutdownHook(func() { close(draining) })
+		lc.addWorker("worker", func(ctx context.Context) error {
+			<-ctx.Done()
+			cancelled.Store(true)
+			return ctx.Err()
+		})
+		lc.addWorker("stopper", func(ctx context.Context) error {
+			select {
+			case <-stop:
+				return errors.New("stop")
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		addr := freeAddr(t)
+		lc.addServer("http", &http.Server{Addr: addr, Handler: handler}, nil)
+
+		done := make(chan error, 1)
+		go func() { done <- lc.run() }()
+		status := make(chan int, 1)
+		go func() {
+			for {
+				resp, err := http.Get("http://" + addr)
+				if err == nil {
+					resp.Body.Close()
+					status <- resp.StatusCode
+					return
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}()
+		<-entered
+
+		close(stop)
+		<-draining
+		time.Sleep(50 * time.Millisecond)
+		assert.False(t, cancelled.Load(), "worker cancelled while a request drains")
+		close(release)
+
+		assert.Equal(t, http.StatusOK, <-status)
+		select {
+		case err := <-done:
+			assert.EqualError(t, err, "stop")
+		case <-time.After(5 * time.Second):
+			t.Fatal("run did not return")
+		}
+		assert.True(t, cancelled.Load())
+	})
+}
@@ -0,0 +1,306 @@
+// Package live pushes view count changes to connected clients. A Hub is fed
+// with the IDs of incremented videos, periodically recomputes the topics
+// that clients subscribed to and fans the results out to them.
+package live
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"view_count/model"
+	"view_count/viewservice"
+
+	"github.com/go-kit/log"
+)
+
+const (
+	KindVideo  = "video"
+	KindTop    = "top"
+	KindRecent = "recent"
+)
+
+var ErrInvalidTopic = errors.New("invalid topic")
+
+// Topic is something clients can subscribe to: the count of one video, or
+// the top or most recently viewed n videos.
+type Topic struct {
+	Kind    string
+	VideoID string
+	N       int
+}
+
+func VideoTopic(videoId string) Topic { return Topic{Kind: KindVideo, VideoID: videoId} }
+func TopTopic(n int) Topic            { return Topic{Kind: KindTop, N: n} }
+func RecentTopic(n int) Topic         { return Topic{Kind: KindRecent, N: n} }
+
+// String formats t as video:<id>, top:<n> or recent:<n>.
+func (t Topic) String() string {
+	if t.Kind == KindVideo {
+		return KindVideo + ":" + t.VideoID
+	}
+	return t.Kind + ":" + strconv.Itoa(t.N)
+}
+
+// ParseTopic parses the format produced by Topic.String. n must be between
+// 1 and maxN.
+func ParseTopic(s string, maxN int) (Topic, error) {
+	kind, arg, ok := strings.Cut(s, ":")
+	if !ok || arg == "" {
+		return Topic{}, fmt.Errorf("%w: %q", ErrInvalidTopic, s)
+	}
+	switch kind {
+	case KindVideo:
+		return VideoTopic(arg), nil
+	case KindTop, KindRecent:
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 || n > maxN {
+			return Topic{}, fmt.Errorf("%w: n must be between 1 and %d", ErrInvalidTopic, maxN)
+		}
+		return Topic{Kind: kind, N: n}, nil
+	}
+	return Topic{}, fmt.Errorf("%w: unknown kind %q", ErrInvalidTopic, kind)
+}
+
+// Message is the current state of a topic. Views is set for video topics
+// and Videos for top and recent topics.
+type Message struct {
+	Topic  Topic
+	Views  int
+	Videos []model.VideoInfo
+}
+
+// Subscription receives messages for one topic on C. C is closed when the
+// subscription is closed or when the subscriber was evicted for not keeping
+// up; Evicted tells the two apart.
+type Subscription struct {
+	C       <-chan Message
+	c       chan Message
+	topic   Topic
+	hub     *Hub
+	once    sync.Once
+	evicted atomic.Bool
+}
+
+// Close unsubscribes. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.hub.remove(s)
+}
+
+// Evicted reports whether C was closed because the subscriber was too slow.
+func (s *Subscription) Evicted() bool {
+	return s.evicted.Load()
+}
+
+// HubConfig configures a Hub.
+type HubConfig struct {
+	// Interval is how often pending changes are flushed to subscribers.
+	Interval time.Duration
+	// Buffer is the number of messages buffered per subscriber before it
+	// is evicted.
+	Buffer int
+	// MaxN bounds n for top and recent topics.
+	MaxN int
+}
+
+type Hub struct {
+	svc     viewservice.Service
+	cfg     HubConfig
+	logger  log.Logger
+	changes chan string
+
+	// overflow is set when changes was full, so the next flush refreshes
+	// every topic instead of only those with known changes.
+	overflow atomic.Bool
+
+	mu   sync.Mutex
+	subs map[Topic]map[*Subscription]struct{}
+	last map[Topic]Message
+}
+
+// NewHub returns a Hub that reads current counts from svc. Run must be
+// running for subscribers to receive updates.
+func NewHub(svc viewservice.Service, cfg HubConfig, logger log.Logger) *Hub {
+	return &Hub{
+		svc:     svc,
+		cfg:     cfg,
+		logger:  logger,
+		changes: make(chan string, 4096),
+		subs:    make(map[Topic]map[*Subscription]struct{}),
+		last:    make(map[Topic]Message),
+	}
+}
+
+// MaxN is the largest n accepted for top and recent topics.
+func (h *Hub) MaxN() int {
+	return h.cfg.MaxN
+}
+
+// Publish records that videoId was viewed. It never blocks.
+func (h *Hub) Publish(videoId string) {
+	select {
+	case h.changes <- videoId:
+	default:
+		h.overflow.Store(true)
+	}
+}
+
+// Subscribe starts delivering messages for t.
+func (h *Hub) Subscribe(t Topic) *Subscription {
+	c := make(chan Message, h.cfg.Buffer)
+	s := &Subscription{C: c, c: c, topic: t, hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[t] == nil {
+		h.subs[t] = make(map[*Subscription]struct{})
+	}
+	h.subs[t][s] = struct{}{}
+	return s
+}
+
+func (h *Hub) remove(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(s)
+}
+
+func (h *Hub) removeLocked(s *Subscription) {
+	s.once.Do(func() {
+		delete(h.subs[s.topic], s)
+		if len(h.subs[s.topic]) == 0 {
+			delete(h.subs, s.topic)
+			delete(h.last, s.topic)
+		}
+		close(s.c)
+	})
+}
+
+// Snapshot returns the current state of t straight from the service.
+func (h *Hub) Snapshot(ctx context.Context, t Topic) (Message, error) {
+	m := Message{Topic: t}
+	var err error
+	switch t.Kind {
+	case KindVideo:
+		m.Views, err = h.svc.GetView(ctx, t.VideoID)
+	case KindTop:
+		m.Videos, err = h.svc.GetTopVideos(ctx, t.N)
+	case KindRecent:
+		m.Videos, err = h.svc.GetRecentVideos(ctx, t.N)
+	default:
+		err = ErrInvalidTopic
+	}
+	return m, err
+}
+
+// Run flushes changes to subscribers every Interval until ctx is done.
+func (h *Hub) Run(ctx context.Context) error {
+	ticker := time.NewTicker(h.cfg.Interval)
+	defer ticker.Stop()
+
+	dirty := make(map[string]struct{})
+	for {
+		select {
+		case <-ctx.Done():
+			h.DisconnectAll()
+			return ctx.Err()
+		case id := <-h.changes:
+			dirty[id] = struct{}{}
+		case <-ticker.C:
+			all := h.overflow.Swap(false)
+			if len(dirty) > 0 || all {
+				h.flush(ctx, dirty, all)
+				dirty = make(map[string]struct{})
+			}
+		}
+	}
+}
+
+// flush recomputes every subscribed topic affected by dirty, or all of
+// them, and sends the ones whose state changed.
+func (h *Hub) flush(ctx context.Context, dirty map[string]struct{}, all bool) {
+	h.mu.Lock()
+	topics := make([]Topic, 0, len(h.subs))
+	for t := range h.subs {
+		if _, ok := dirty[t.VideoID]; t.Kind != KindVideo || ok || all {
+			topics = append(topics, t)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, t := range topics {
+		m, err := h.Snapshot(ctx, t)
+		if err != nil {
+			if ctx.Err() == nil {
+				h.logger.Log("msg", "refreshing live topic failed", "topic", t, "err", err)
+			}
+			continue
+		}
+		h.broadcast(m)
+	}
+}
+
+func (h *Hub) broadcast(m Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if last, ok := h.last[m.Topic]; ok && reflect.DeepEqual(last, m) {
+		return
+	}
+	if _, ok := h.subs[m.Topic]; !ok {
+		return
+	}
+	h.last[m.Topic] = m
+
+	for s := range h.subs[m.Topic] {
+		select {
+		case s.c <- m:
+		default:
+			s.evicted.Store(true)
+			h.removeLocked(s)
+			h.logger.Log("msg", "evicted slow live subscriber", "topic", m.Topic)
+		}
+	}
+}
+
+// DisconnectAll closes every subscription, ending open streams so that the
+// HTTP server can shut down.
+func (h *Hub) DisconnectAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, subs := range h.subs {
+		for s := range subs {
+			h.removeLocked(s)
+		}
+	}
+}
+
+type publishingService struct {
+	hub *Hub
+	viewservice.Service
+}
+
+// NewPublishingService returns a Service that publishes every successful
+// Increment to hub.
+func NewPublishingService(hub *Hub, s viewservice.Service) viewservice.Service {
+	return &publishingService{hub, s}
+}
+
+func (s *publishingService) Increment(ctx context.Context, videoId string) (err error) {
+	if err = s.Service.Increment(ctx, videoId); err == nil {
+		s.hub.Publish(videoId)
+	}
+	return err
+}
+
+func (s *publishingService) IncrementOnce(ctx context.Context, videoId, key string, ttl time.Duration) (replayed bool, err error) {
+	if replayed, err = s.Service.IncrementOnce(ctx, videoId, key, ttl); err == nil && !replayed {
+		s.hub.Publish(videoId)
+	}
+	return replayed, err
+}
@@ -0,0 +1,149 @@
+package live
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"view_count/model"
+	"view_count/repository/viewrepository"
+	"view_count/viewservice"
+
+	"github.com/go-kit/log"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHub(t *testing.T, buffer int) (*Hub, viewservice.Service) {
+	t.Helper()
+	base := viewservice.NewService(viewrepository.NewInmemoryRepo())
+	hub := NewHub(base, HubConfig{Interval: 10 * time.Millisecond, Buffer: buffer, MaxN: 100}, log.NewNopLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		hub.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return hub, NewPublishingService(hub, base)
+}
+
+func receive(t *testing.T, sub *Subscription) Message {
+	t.Helper()
+	select {
+	case m, ok := <-sub.C:
+		require.True(t, ok, "subscription closed")
+		return m
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+		return Message{}
+	}
+}
+
+func TestParseTopic(t *testing.T) {
+	topic, err := ParseTopic("top:10", 100)
+	require.NoError(t, err)
+	assert.Equal(t, TopTopic(10), topic)
+	assert.Equal(t, "top:10", topic.String())
+
+	topic, err = ParseTopic("video:a:b", 100)
+	require.NoError(t, err)
+	assert.Equal(t, VideoTopic("a:b"), topic)
+
+	for _, s := range []string{"", "top", "top:0", "top:101", "recent:x", "other:1", "video:"} {
+		_, err := ParseTopic(s, 100)
+		assert.ErrorIs(t, err, ErrInvalidTopic, s)
+	}
+}
+
+func TestHub(t *testing.T) {
+	hub, svc := newTestHub(t, 16)
+	ctx := context.Background()
+
+	video := hub.Subscribe(VideoTopic("video1"))
+	defer video.Close()
+	top := hub.Subscribe(TopTopic(2))
+	defer top.Close()
+
+	require.NoError(t, svc.Increment(ctx, "video1"))
+	require.NoError(t, svc.Increment(ctx, "video1"))
+
+	m := receive(t, video)
+	assert.Equal(t, 2, m.Views)
+
+	m = receive(t, top)
+	assert.Equal(t, []model.VideoInfo{{Id: "video1", Views: 2}}, m.Videos)
+
+	t.Run("Other videos only update list topics", func(t *testing.T) {
+		require.NoError(t, svc.Increment(ctx, "video2"))
+
+		m := receive(t, top)
+		assert.Equal(t, []model.VideoInfo{{Id: "video1", Views: 2}, {Id: "video2", Views: 1}}, m.Videos)
+		select {
+		case m := <-video.C:
+			t.Fatalf("unexpected message %v", m)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+}
+
+func TestHubEvictsSlowSubscribers(t *testing.T) {
+	hub, svc := newTestHub(t, 1)
+	ctx := context.Background()
+
+	sub := hub.Subscribe(VideoTopic("video1"))
+	for i := 0; i < 3; i++ {
+		require.NoError(t, svc.Increment(ctx, "video1"))
+		time.Sleep(30 * time.Millisecond)
+	}
+
+	require.Eventually(t, sub.Evicted, time.Second, 10*time.Millisecond)
+	<-sub.C
+	_, ok := <-sub.C
+	assert.False(t, ok)
+}
+
+func TestServeVideo(t *testing.T) {
+	hub, svc := newTestHub(t, 16)
+	svc.Increment(context.Background(), "video1")
+
+	r := mux.NewRouter()
+	r.HandleFunc("/stream/views/{vID}", hub.ServeVideo)
+	r.HandleFunc("/stream/top/{n}", hub.ServeTop)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	t.Run("Rejects invalid n", func(t *testing.T) {
+		res, err := http.Get(server.URL + "/stream/top/1000")
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	res, err := http.Get(server.URL + "/stream/views/video1")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	lines := bufio.NewScanner(res.Body)
+	next := func() string {
+		var event []string
+		for lines.Scan() && lines.Text() != "" {
+			event = append(event, lines.Text())
+		}
+		return strings.Join(event, "\n")
+	}
+
+	assert.Equal(t, "event: views\ndata: {\"id\":\"video1\",\"views\":1}", next())
+
+	svc.Increment(context.Background(), "video1")
+	assert.Equal(t, "event: views\ndata: {\"id\":\"video1\",\"views\":2}", next())
+}
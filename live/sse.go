@@ -0,0 +1,128 @@
+package live
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"view_count/model"
+	"view_count/viewservice"
+
+	"github.com/gorilla/mux"
+)
+
+// HeartbeatInterval is how often an SSE comment is sent on idle streams so
+// that proxies do not close them.
+var HeartbeatInterval = 15 * time.Second
+
+type viewsEvent struct {
+	Id    string `json:"id"`
+	Views int    `json:"views"`
+}
+
+type videosEvent struct {
+	N      int               `json:"n"`
+	Videos []model.VideoInfo `json:"videos"`
+}
+
+// ServeVideo streams the view count of the video in the vID route variable
+// as Server-Sent Events named "views".
+func (h *Hub) ServeVideo(w http.ResponseWriter, r *http.Request) {
+	videoId := mux.Vars(r)["vID"]
+	if videoId == "" {
+		http.Error(w, "VideoID is Required.", http.StatusBadRequest)
+		return
+	}
+	h.serveSSE(w, r, VideoTopic(videoId))
+}
+
+// ServeTop streams the top n videos, n being the route variable, as
+// Server-Sent Events named "top".
+func (h *Hub) ServeTop(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(mux.Vars(r)["n"])
+	if err != nil || n < 1 || n > h.cfg.MaxN {
+		http.Error(w, fmt.Sprintf("n must be between 1 and %d", h.cfg.MaxN), http.StatusBadRequest)
+		return
+	}
+	h.serveSSE(w, r, TopTopic(n))
+}
+
+func (h *Hub) serveSSE(w http.ResponseWriter, r *http.Request, t Topic) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	// subscribe before taking the snapshot so no change in between is lost.
+	sub := h.Subscribe(t)
+	defer sub.Close()
+
+	initial, err := h.Snapshot(r.Context(), t)
+	switch err {
+	case nil:
+	case viewservice.ErrInvalidArgument:
+		http.Error(w, "invalid argument", http.StatusBadRequest)
+		return
+	default:
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := writeEvent(w, initial); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(HeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case m, ok := <-sub.C:
+			if !ok {
+				if sub.Evicted() {
+					fmt.Fprint(w, "event: evicted\ndata: {}\n\n")
+					flusher.Flush()
+				}
+				return
+			}
+			if err := writeEvent(w, m); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, m Message) error {
+	var (
+		name string
+		data any
+	)
+	switch m.Topic.Kind {
+	case KindVideo:
+		name, data = "views", viewsEvent{Id: m.Topic.VideoID, Views: m.Views}
+	default:
+		name, data = m.Topic.Kind, videosEvent{N: m.Topic.N, Videos: m.Videos}
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, b)
+	return err
+}
@@ -0,0 +1,418 @@
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+	"view_count/model"
+
+	"github.com/go-kit/log"
+	"github.com/gorilla/websocket"
+)
+
+// WebSocketConfig configures a WebSocketHandler.
+type WebSocketConfig struct {
+	// MinInterval is the minimum time between two batches of updates sent
+	// to one client. Changes in between are coalesced into the next batch.
+	MinInterval time.Duration
+	// WriteTimeout bounds every write. Clients that cannot keep up are
+	// disconnected.
+	WriteTimeout time.Duration
+	// PingInterval is how often the server pings. A client that sends
+	// nothing, not even a pong, for twice as long is disconnected.
+	PingInterval time.Duration
+	// MaxTopics bounds the subscriptions of one connection.
+	MaxTopics int
+	// PrivateKinds are the topic kinds that need an authenticated
+	// connection.
+	PrivateKinds []string
+	// Authenticate reports whether the upgrade request is authenticated.
+	// When nil, no connection is.
+	Authenticate func(r *http.Request) bool
+}
+
+// clientMessage is sent by clients to change their subscriptions.
+type clientMessage struct {
+	Action string `json:"action"`
+	Topic  string `json:"topic"`
+}
+
+// RankedVideo is a video with its 1-based position in a list. PrevRank is
+// the position in the previous update, 0 if it was not listed.
+type RankedVideo struct {
+	Id       string `json:"id"`
+	Views    int    `json:"views"`
+	Rank     int    `json:"rank"`
+	PrevRank int    `json:"prev_rank,omitempty"`
+}
+
+// serverMessage is sent to clients. Type is one of
+//
+//	snapshot  full state of Topic, the first message after subscribing
+//	diff      Changed and Removed videos of a list topic
+//	views     new count of a video topic
+//	error     a request of the client failed
+type serverMessage struct {
+	Type    string        `json:"type"`
+	Topic   string        `json:"topic,omitempty"`
+	Views   *int          `json:"views,omitempty"`
+	Videos  []RankedVideo `json:"videos,omitempty"`
+	Changed []RankedVideo `json:"changed,omitempty"`
+	Removed []string      `json:"removed,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// WebSocketHandler lets clients subscribe to several topics over one
+// WebSocket connection and receive diffs of list topics as they change.
+type WebSocketHandler struct {
+	hub      *Hub
+	cfg      WebSocketConfig
+	logger   log.Logger
+	private  map[string]bool
+	upgrader websocket.Upgrader
+}
+
+func NewWebSocketHandler(hub *Hub, cfg WebSocketConfig, logger log.Logger) *WebSocketHandler {
+	private := make(map[string]bool)
+	for _, kind := range cfg.PrivateKinds {
+		private[kind] = true
+	}
+	return &WebSocketHandler{
+		hub:     hub,
+		cfg:     cfg,
+		logger:  logger,
+		private: private,
+	}
+}
+
+func (h *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	authenticated := h.cfg.Authenticate != nil && h.cfg.Authenticate(r)
+
+	ws, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade already replied with an error.
+		return
+	}
+	c := &wsConn{
+		h:             h,
+		ws:            ws,
+		ctx:           r.Context(),
+		authenticated: authenticated,
+		subs:          make(map[Topic]*Subscription),
+		pending:       make(map[Topic]Message),
+		sent:          make(map[Topic]Message),
+		wake:          make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+	go c.writeLoop()
+	c.readLoop()
+}
+
+// wsConn is one client connection. readLoop owns reads, writeLoop all
+// data writes; pump goroutines move hub messages into pending.
+type wsConn struct {
+	h             *WebSocketHandler
+	ws            *websocket.Conn
+	ctx           context.Context
+	authenticated bool
+
+	mu      sync.Mutex
+	subs    map[Topic]*Subscription
+	pending map[Topic]Message
+	// sent is the last message written per topic, which diffs are computed
+	// against.
+	sent    map[Topic]Message
+	replies []serverMessage
+
+	wake      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *wsConn) readLoop() {
+	defer func() {
+		c.close(websocket.CloseNormalClosure, "")
+		c.mu.Lock()
+		subs := c.subs
+		c.subs = nil
+		c.mu.Unlock()
+		for _, sub := range subs {
+			sub.Close()
+		}
+	}()
+
+	c.ws.SetReadLimit(4096)
+	c.extendReadDeadline()
+	c.ws.SetPongHandler(func(string) error {
+		c.extendReadDeadline()
+		return nil
+	})
+
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		c.extendReadDeadline()
+
+		var msg clientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.reply(serverMessage{Type: "error", Error: "invalid message"})
+			continue
+		}
+
+		switch msg.Action {
+		case "subscribe":
+			c.subscribe(msg.Topic)
+		case "unsubscribe":
+			c.unsubscribe(msg.Topic)
+		default:
+			c.reply(serverMessage{Type: "error", Topic: msg.Topic, Error: "unknown action"})
+		}
+	}
+}
+
+func (c *wsConn) extendReadDeadline() {
+	if c.h.cfg.PingInterval > 0 {
+		c.ws.SetReadDeadline(time.Now().Add(2 * c.h.cfg.PingInterval))
+	}
+}
+
+func (c *wsConn) subscribe(s string) {
+	t, err := ParseTopic(s, c.h.hub.MaxN())
+	if err != nil {
+		c.reply(serverMessage{Type: "error", Topic: s, Error: err.Error()})
+		return
+	}
+	if c.h.private[t.Kind] && !c.authenticated {
+		c.reply(serverMessage{Type: "error", Topic: s, Error: "authentication required"})
+		return
+	}
+
+	c.mu.Lock()
+	_, dup := c.subs[t]
+	full := len(c.subs) >= c.h.cfg.MaxTopics
+	c.mu.Unlock()
+	if dup {
+		return
+	}
+	if full {
+		c.reply(serverMessage{Type: "error", Topic: s, Error: "too many subscriptions"})
+		return
+	}
+
+	// as for SSE, subscribe before the snapshot so no change is lost.
+	sub := c.h.hub.Subscribe(t)
+	c.mu.Lock()
+	c.subs[t] = sub
+	c.mu.Unlock()
+	go c.pump(sub)
+
+	m, err := c.h.hub.Snapshot(c.ctx, t)
+	if err != nil {
+		c.unsubscribe(s)
+		c.reply(serverMessage{Type: "error", Topic: s, Error: "server error"})
+		c.h.logger.Log("msg", "live snapshot failed", "topic", t, "err", err)
+		return
+	}
+	c.mu.Lock()
+	if _, ok := c.pending[t]; !ok && c.subs[t] == sub {
+		c.pending[t] = m
+	}
+	c.mu.Unlock()
+	c.notify()
+}
+
+func (c *wsConn) unsubscribe(s string) {
+	t, err := ParseTopic(s, c.h.hub.MaxN())
+	if err != nil {
+		c.reply(serverMessage{Type: "error", Topic: s, Error: err.Error()})
+		return
+	}
+	c.mu.Lock()
+	sub := c.subs[t]
+	delete(c.subs, t)
+	delete(c.pending, t)
+	delete(c.sent, t)
+	c.mu.Unlock()
+	if sub != nil {
+		sub.Close()
+	}
+}
+
+// pump coalesces the messages of sub into pending. When the hub closes sub
+// on its own, because the client was too slow or the server is shutting
+// down, the connection is closed too.
+func (c *wsConn) pump(sub *Subscription) {
+	for m := range sub.C {
+		c.mu.Lock()
+		if c.subs[sub.topic] == sub {
+			c.pending[sub.topic] = m
+		}
+		c.mu.Unlock()
+		c.notify()
+	}
+
+	c.mu.Lock()
+	ours := c.subs[sub.topic] == sub
+	c.mu.Unlock()
+	switch {
+	case !ours:
+	case sub.Evicted():
+		c.close(websocket.ClosePolicyViolation, "too slow")
+	default:
+		c.close(websocket.CloseGoingAway, "server shutting down")
+	}
+}
+
+func (c *wsConn) reply(m serverMessage) {
+	c.mu.Lock()
+	c.replies = append(c.replies, m)
+	c.mu.Unlock()
+	c.notify()
+}
+
+func (c *wsConn) notify() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// writeLoop sends pending changes in batches at most every MinInterval.
+func (c *wsConn) writeLoop() {
+	var ping <-chan time.Time
+	if c.h.cfg.PingInterval > 0 {
+		ticker := time.NewTicker(c.h.cfg.PingInterval)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ping:
+			deadline := time.Now().Add(c.h.cfg.WriteTimeout)
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				c.close(websocket.CloseGoingAway, "")
+				return
+			}
+			continue
+		case <-c.wake:
+		}
+
+		for _, m := range c.batch() {
+			c.ws.SetWriteDeadline(time.Now().Add(c.h.cfg.WriteTimeout))
+			if err := c.ws.WriteJSON(m); err != nil {
+				c.close(websocket.ClosePolicyViolation, "too slow")
+				return
+			}
+		}
+
+		select {
+		case <-c.done:
+			return
+		case <-time.After(c.h.cfg.MinInterval):
+		}
+	}
+}
+
+// batch takes the queued replies and turns pending hub messages into
+// snapshots, diffs or view updates.
+func (c *wsConn) batch() []serverMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := c.replies
+	c.replies = nil
+	for t, m := range c.pending {
+		last, seen := c.sent[t]
+		if msg, ok := encode(t, last, m, seen); ok {
+			out = append(out, msg)
+		}
+		c.sent[t] = m
+	}
+	c.pending = make(map[Topic]Message)
+	return out
+}
+
+func encode(t Topic, last, m Message, seen bool) (serverMessage, bool) {
+	msg := serverMessage{Topic: t.String()}
+	switch {
+	case t.Kind == KindVideo:
+		if seen && last.Views == m.Views {
+			return msg, false
+		}
+		views := m.Views
+		msg.Type, msg.Views = "views", &views
+		if !seen {
+			msg.Type = "snapshot"
+		}
+	case !seen:
+		msg.Type, msg.Videos = "snapshot", Rank(nil, m.Videos)
+		if msg.Videos == nil {
+			msg.Videos = []RankedVideo{}
+		}
+	default:
+		msg.Type = "diff"
+		msg.Changed, msg.Removed = Diff(last.Videos, m.Videos)
+		if len(msg.Changed) == 0 && len(msg.Removed) == 0 {
+			return msg, false
+		}
+	}
+	return msg, true
+}
+
+// Rank numbers videos by position and records their rank in prev.
+func Rank(prev, videos []model.VideoInfo) []RankedVideo {
+	prevRank := ranks(prev)
+	var out []RankedVideo
+	for i, v := range videos {
+		out = append(out, RankedVideo{Id: v.Id, Views: v.Views, Rank: i + 1, PrevRank: prevRank[v.Id]})
+	}
+	return out
+}
+
+// Diff returns the videos of next that are new or whose count or rank
+// differs from prev, and the IDs of videos that dropped out of the list.
+func Diff(prev, next []model.VideoInfo) (changed []RankedVideo, removed []string) {
+	prevViews := make(map[string]int, len(prev))
+	for _, v := range prev {
+		prevViews[v.Id] = v.Views
+	}
+
+	for _, v := range Rank(prev, next) {
+		if v.Rank != v.PrevRank || v.Views != prevViews[v.Id] {
+			changed = append(changed, v)
+		}
+	}
+	nextRank := ranks(next)
+	for _, v := range prev {
+		if _, ok := nextRank[v.Id]; !ok {
+			removed = append(removed, v.Id)
+		}
+	}
+	return changed, removed
+}
+
+func ranks(videos []model.VideoInfo) map[string]int {
+	r := make(map[string]int, len(videos))
+	for i, v := range videos {
+		r[v.Id] = i + 1
+	}
+	return r
+}
+
+// close sends a close frame with code and reason and closes the
+// connection, which stops both loops.
+func (c *wsConn) close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		deadline := time.Now().Add(time.Second)
+		c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+		c.ws.Close()
+	})
+}
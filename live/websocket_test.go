@@ -0,0 +1,129 @@
+package live
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"view_count/model"
+
+	"github.com/go-kit/log"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	prev := []model.VideoInfo{{Id: "a", Views: 5}, {Id: "b", Views: 3}, {Id: "c", Views: 1}}
+	next := []model.VideoInfo{{Id: "b", Views: 6}, {Id: "a", Views: 5}, {Id: "d", Views: 2}}
+
+	changed, removed := Diff(prev, next)
+	assert.Equal(t, []RankedVideo{
+		{Id: "b", Views: 6, Rank: 1, PrevRank: 2},
+		{Id: "a", Views: 5, Rank: 2, PrevRank: 1},
+		{Id: "d", Views: 2, Rank: 3},
+	}, changed)
+	assert.Equal(t, []string{"c"}, removed)
+
+	changed, removed = Diff(next, next)
+	assert.Empty(t, changed)
+	assert.Empty(t, removed)
+}
+
+func dialWebSocket(t *testing.T, hub *Hub, header http.Header) *websocket.Conn {
+	t.Helper()
+	handler := NewWebSocketHandler(hub, WebSocketConfig{
+		MinInterval:  10 * time.Millisecond,
+		WriteTimeout: time.Second,
+		PingInterval: time.Second,
+		MaxTopics:    2,
+		PrivateKinds: []string{KindRecent},
+		Authenticate: func(r *http.Request) bool {
+			return r.Header.Get("Authorization") == "Bearer secret"
+		},
+	}, log.NewNopLogger())
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	require.NoError(t, err)
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func send(t *testing.T, ws *websocket.Conn, action, topic string) {
+	t.Helper()
+	require.NoError(t, ws.WriteJSON(clientMessage{Action: action, Topic: topic}))
+}
+
+func next(t *testing.T, ws *websocket.Conn) serverMessage {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	var m serverMessage
+	require.NoError(t, ws.ReadJSON(&m))
+	return m
+}
+
+func TestWebSocket(t *testing.T) {
+	hub, svc := newTestHub(t, 16)
+	ctx := context.Background()
+	svc.Increment(ctx, "a")
+
+	ws := dialWebSocket(t, hub, nil)
+
+	send(t, ws, "subscribe", "top:2")
+	m := next(t, ws)
+	assert.Equal(t, "snapshot", m.Type)
+	assert.Equal(t, []RankedVideo{{Id: "a", Views: 1, Rank: 1}}, m.Videos)
+
+	svc.Increment(ctx, "b")
+	svc.Increment(ctx, "b")
+	m = next(t, ws)
+	assert.Equal(t, "diff", m.Type)
+	assert.Equal(t, "top:2", m.Topic)
+	assert.Equal(t, []RankedVideo{
+		{Id: "b", Views: 2, Rank: 1},
+		{Id: "a", Views: 1, Rank: 2, PrevRank: 1},
+	}, m.Changed)
+
+	t.Run("Video topics send counts", func(t *testing.T) {
+		send(t, ws, "subscribe", "video:a")
+		m := next(t, ws)
+		assert.Equal(t, "snapshot", m.Type)
+		require.NotNil(t, m.Views)
+		assert.Equal(t, 1, *m.Views)
+	})
+
+	t.Run("Private topics need authentication", func(t *testing.T) {
+		send(t, ws, "unsubscribe", "video:a")
+		send(t, ws, "subscribe", "recent:5")
+		m := next(t, ws)
+		assert.Equal(t, serverMessage{Type: "error", Topic: "recent:5", Error: "authentication required"}, m)
+
+		authed := dialWebSocket(t, hub, http.Header{"Authorization": {"Bearer secret"}})
+		send(t, authed, "subscribe", "recent:5")
+		assert.Equal(t, "snapshot", next(t, authed).Type)
+	})
+
+	t.Run("Subscriptions are limited", func(t *testing.T) {
+		send(t, ws, "subscribe", "top:1")
+		assert.Equal(t, "snapshot", next(t, ws).Type)
+		send(t, ws, "subscribe", "top:3")
+		assert.Equal(t, "too many subscriptions", next(t, ws).Error)
+	})
+
+	t.Run("Invalid topics are rejected", func(t *testing.T) {
+		send(t, ws, "unsubscribe", "top:1")
+		send(t, ws, "subscribe", "top:0")
+		assert.Equal(t, "error", next(t, ws).Type)
+	})
+
+	t.Run("Shutdown closes the connection", func(t *testing.T) {
+		hub.DisconnectAll()
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		_, _, err := ws.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err)
+	})
+}
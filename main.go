@@ -1,48 +1,109 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
 	"time"
+	"view_count/auth"
 	"view_count/cli"
 	"view_count/database.go"
+	"view_count/health"
+	"view_count/live"
+	"view_count/repository/apikeyrepository"
+	"view_count/repository/invalidviewrepository"
 	"view_count/repository/viewrepository"
+	"view_count/repository/webhookrepository"
+	"view_count/viewfilter"
 	"view_count/viewservice"
+	"view_count/webhook"
 
 	"github.com/go-kit/kit/metrics/prometheus"
 	kitlog "github.com/go-kit/log"
 	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"go.opentelemetry.io/otel"
 
 	_ "github.com/lib/pq"
 )
 
+// slowQueryThreshold is the repository call duration above which the call
+// is logged with its arguments.
+const slowQueryThreshold = 250 * time.Millisecond
+
 func main() {
 
 	var vs viewservice.Service // concrete vs interface type declaration
 
 	// viewRepo := viewrepository.NewInmemoryRepo()
 
-	// TODO: add logging mw @abhishekAK/@abhishekGupta/Rishu
-	// TODO: add instumenting mw
 	database.CreateDB("view_count")
-	database, err := database.Connect("view_count")
+	db, err := database.Connect("view_count")
 	if err != nil {
 		log.Fatal("Error in database connection: ", err)
 	}
 
-	viewRepo := viewrepository.NewPostgresRepo(database)
+	viewRepo := viewrepository.NewPostgresRepo(db)
 
-	// TODO: add logging mw : Done
-	// TODO: add instumenting mw : Done
+	logger := kitlog.NewLogfmtLogger(kitlog.NewSyncWriter(os.Stdout))
 
-	vs = viewservice.NewService(viewRepo)
+	repoLatency := prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "video_service",
+		Subsystem: "repository",
+		Name:      "latency_seconds",
+		Help:      "Duration of repository calls in seconds.",
+		Buckets:   stdprometheus.DefBuckets,
+	}, []string{"backend", "method"})
+	repoErrors := prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "video_service",
+		Subsystem: "repository",
+		Name:      "errors_total",
+		Help:      "Number of failed repository calls.",
+	}, []string{"backend", "method"})
+	repoRows := prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "video_service",
+		Subsystem: "repository",
+		Name:      "rows",
+		Help:      "Number of rows returned by repository calls.",
+		Buckets:   stdprometheus.ExponentialBuckets(1, 4, 8),
+	}, []string{"backend", "method"})
+
+	var repo viewrepository.Repository = viewrepository.NewInstrumentedRepo(viewRepo,
+		repoLatency.With("backend", "postgres"),
+		repoErrors.With("backend", "postgres"),
+		repoRows.With("backend", "postgres"),
+		slowQueryThreshold,
+		logger,
+	)
+
+	vs = viewservice.NewService(repo)
+
+	// the hub reads current counts from the plain service and is fed by
+	// the publishing decorator on every successful increment.
+	hub := live.NewHub(vs, live.HubConfig{
+		Interval: 500 * time.Millisecond,
+		Buffer:   16,
+		MaxN:     100,
+	}, logger)
+	vs = live.NewPublishingService(hub, vs)
+
+	invalidViewRepo := invalidviewrepository.NewPostgresRepo(db)
+	apiKeyRepo := apikeyrepository.NewPostgresRepo(db)
+	authn := auth.NewAuthenticator(apiKeyRepo, logger)
+
+	webhookRepo := webhookrepository.NewPostgresRepo(db)
+	dispatcher := webhook.NewDispatcher(webhookRepo, viewservice.NewService(repo), webhook.Config{
+		Workers:         4,
+		MaxAttempts:     6,
+		Backoff:         time.Second,
+		MaxBackoff:      time.Minute,
+		Timeout:         10 * time.Second,
+		Interval:        500 * time.Millisecond,
+		RefreshInterval: 30 * time.Second,
+	}, logger)
+	vs = webhook.NewMilestoneService(dispatcher, vs)
+	vs = viewservice.NewServiceTracing(otel.Tracer("view_count/viewservice"), vs)
 
-	logger := kitlog.NewLogfmtLogger(kitlog.NewSyncWriter(os.Stdout))
 	vs = viewservice.NewServiceLogging(logger, vs)
 
 	requestCount := prometheus.NewCounterFrom(stdprometheus.CounterOpts{
@@ -50,70 +111,97 @@ func main() {
 		Subsystem: "view_service",
 		Name:      "request_count",
 		Help:      "Number of requests received.",
-	}, []string{"method"})
-	requestLatency := prometheus.NewSummaryFrom(stdprometheus.SummaryOpts{
+	}, []string{"method", "outcome"})
+	requestLatency := prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
 		Namespace: "video_service",
 		Subsystem: "view_service",
 		Name:      "request_latency_seconds",
 		Help:      "Total duration of requests in seconds.",
-	}, []string{"method"})
-
-	vs = viewservice.NewInstrumentingService(requestCount, requestLatency, logger, vs)
-
-	// endpoints := viewservice.MakeEndpoints(vs)
-
-	// r := viewservice.MakeHandler(endpoints, logger)
+		Buckets:   stdprometheus.DefBuckets,
+	}, []string{"method", "outcome"})
+	viewsIngested := prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "video_service",
+		Name:      "views_ingested_total",
+		Help:      "Number of views successfully counted.",
+	}, []string{})
+	distinctVideos := prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "video_service",
+		Name:      "distinct_videos",
+		Help:      "Number of distinct videos with a view count.",
+	}, []string{})
+	httpDuration := prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "video_service",
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of HTTP requests by route, method and status.",
+		Buckets:   stdprometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+	rateLimitRejections := prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "video_service",
+		Subsystem: "rate_limit",
+		Name:      "rejections_total",
+		Help:      "Number of requests rejected by rate limits, by scope and route.",
+	}, []string{"scope", "route"})
+	invalidViews := prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "video_service",
+		Name:      "invalid_views_total",
+		Help:      "Number of views that failed qualification, by reason.",
+	}, []string{"reason"})
+	viewTokenRejections := prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "video_service",
+		Subsystem: "view_token",
+		Name:      "rejections_total",
+		Help:      "Number of increments rejected for a missing, invalid or replayed view token.",
+	}, []string{"reason"})
+	stdprometheus.MustRegister(collectors.NewDBStatsCollector(db, "view_count"))
 
-	h := NewHandler(vs)
+	vs = viewservice.NewInstrumentingService(requestCount, requestLatency, viewsIngested, logger, vs)
 
-	r := routeIntialiser(*h)
+	// endpoints := viewservice.AuthorizeEndpoints(viewservice.MakeEndpoints(vs), auth.DefaultPolicy)
 
-	// TODO: handle intrupt gracefully
+	// r := viewservice.MakeHandler(endpoints, logger, kithttp.ServerBefore(authn.HTTPToContext))
 
-	server := http.Server{
-		Addr:    ":8080",
-		Handler: r,
+	hc := health.NewChecker(2 * time.Second)
+	// the instrumented wrapper hides optional interfaces, so check the
+	// backend itself.
+	if p, ok := interface{}(viewRepo).(viewrepository.Pinger); ok {
+		hc.AddCheck("postgres", p.PingContext)
 	}
 
-	sigs := make(chan os.Signal, 1)
-	done := make(chan bool)
-
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-
-	go func() {
-		sig := <-sigs
-		fmt.Printf("Recieved signal %s. Shutdown begins \n", sig)
-		// close the db
-		// if database != nil {
-		// 	log.Println("Closing Database connection...")
-		// 	if err := database.Close(); err != nil {
-		// 		log.Fatalf("Error closing database %s\n", err)
-		// 	}
-		// }
-		done <- true
-	}()
-
-	// TODO: create command line tool -> inc vid, viewall, view vid : Done
-
-	// TODO: run this with postgress in local machine : Done
-
-	// go func() {
-	// 	log.Println("Server started on :8080")
-	// 	log.Fatal(http.ListenAndServe(":8080", r))
-	// }()
-
-	<-done
-	fmt.Println("Shutting the system now.")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	// background workers run alongside the server and stop with it.
+	workers := map[string]worker{
+		"distinct-videos": distinctVideosWorker(repo, distinctVideos, 15*time.Second, logger),
+		"live-hub":        hub.Run,
+		"webhooks":        dispatcher.Run,
+		"api-keys":        authn.Run,
+	}
+	if e, ok := interface{}(viewRepo).(viewrepository.IdempotencyKeyExpirer); ok {
+		workers["idempotency-keys"] = expireIdempotencyKeysWorker(e, time.Hour, logger)
+	}
 
-	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server Shutdown Failed: %s", err)
+	cli.AddCommand(newServeCmd(vs, routeDeps{
+		health:              hc,
+		httpDuration:        httpDuration,
+		live:                hub,
+		webhooks:            webhook.NewAdminHandler(webhookRepo, dispatcher),
+		rateLimitRejections: rateLimitRejections,
+		invalidViewRepo:     invalidViewRepo,
+		invalidViews:        invalidViews,
+		viewReports:         viewfilter.NewReportHandler(vs, invalidViewRepo),
+		viewTokenRejections: viewTokenRejections,
+		auth:                authn,
+	}, logger, workers), newAPIKeyCmd(apiKeyRepo))
+	err = cli.Execute(vs)
+
+	logger.Log("msg", "closing database connection")
+	if cerr := db.Close(); cerr != nil {
+		logger.Log("msg", "error closing database", "err", cerr)
+		if err == nil {
+			err = cerr
+		}
 	}
-	fmt.Println("Server closed gracefully!!")
 
-	if err := cli.Execute(vs); err != nil {
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"time"
+	"view_count/repository/viewrepository"
+
+	"github.com/go-kit/kit/metrics"
+	kitlog "github.com/go-kit/log"
+)
+
+// distinctVideosWorker periodically sets gauge to the number of distinct
+// videos in repo. Repositories that are not a VideoCounter are counted
+// through GetAllViews.
+func distinctVideosWorker(repo viewrepository.Repository, gauge metrics.Gauge, interval time.Duration, logger kitlog.Logger) worker {
+	count := func(ctx context.Context) (int, error) {
+		if c, ok := repo.(viewrepository.VideoCounter); ok {
+			return c.CountVideos(ctx)
+		}
+		videos, err := repo.GetAllViews(ctx)
+		return len(videos), err
+	}
+
+	return func(ctx context.Context) error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			n, err := count(ctx)
+			if err != nil && ctx.Err() == nil {
+				logger.Log("msg", "counting distinct videos failed", "err", err)
+			} else if err == nil {
+				gauge.Set(float64(n))
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+		}
+	}
+}
@@ -1,17 +1,143 @@
 package middleware
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
 	"net/http"
+	"strings"
 	"time"
+	"view_count/requestid"
+
+	"github.com/felixge/httpsnoop"
+	kitlog "github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/peer"
 )
 
-func LoggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		startTime := time.Now()
-		// log.Printf("Started %s %s", r.Method, r.RequestURI)
-		next.ServeHTTP(w, r)
-		log.Printf("%s %s in %v", r.Method, r.RequestURI, time.Since(startTime))
-		// TODO: structured logging and only 1 line with took and error and all req and res param, method name
-	})
+// LoggingConfig configures the request logger.
+type LoggingConfig struct {
+	// Level is the minimum level written: debug, info, warn or error.
+	Level string
+	// Format is logfmt or json.
+	Format string
+	// SampleRate is the fraction of successful requests that are logged.
+	// Client and server errors are always logged.
+	SampleRate float64
+	// TrustProxy takes the client IP from X-Forwarded-For and X-Real-IP.
+	TrustProxy bool
+}
+
+// NewLogger returns a go-kit logger writing to w in the configured format
+// and filtered to the configured level.
+func NewLogger(w io.Writer, cfg LoggingConfig) (kitlog.Logger, error) {
+	var logger kitlog.Logger
+	switch cfg.Format {
+	case "", "logfmt":
+		logger = kitlog.NewLogfmtLogger(kitlog.NewSyncWriter(w))
+	case "json":
+		logger = kitlog.NewJSONLogger(kitlog.NewSyncWriter(w))
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	var allow level.Option
+	switch cfg.Level {
+	case "debug":
+		allow = level.AllowDebug()
+	case "", "info":
+		allow = level.AllowInfo()
+	case "warn":
+		allow = level.AllowWarn()
+	case "error":
+		allow = level.AllowError()
+	default:
+		return nil, fmt.Errorf("unknown log level %q", cfg.Level)
+	}
+
+	logger = kitlog.With(logger, "ts", kitlog.DefaultTimestampUTC)
+	return level.NewFilter(logger, allow), nil
+}
+
+// Logging writes one structured line per request with the matched route
+// template, status, response size and latency. 5xx responses are logged at
+// error level, 4xx at warn and everything else at info, subject to sampling.
+func Logging(logger kitlog.Logger, cfg LoggingConfig) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			m := httpsnoop.CaptureMetrics(next, w, r)
+
+			var lvl kitlog.Logger
+			switch {
+			case m.Code >= http.StatusInternalServerError:
+				lvl = level.Error(logger)
+			case m.Code >= http.StatusBadRequest:
+				lvl = level.Warn(logger)
+			default:
+				if cfg.SampleRate < 1 && rand.Float64() >= cfg.SampleRate {
+					return
+				}
+				lvl = level.Info(logger)
+			}
+
+			lvl.Log(
+				"method", r.Method,
+				"route", RouteTemplate(r),
+				"status", m.Code,
+				"bytes", m.Written,
+				"took", m.Duration.Round(time.Microsecond),
+				"client_ip", ClientIP(r, cfg.TrustProxy),
+				"user_agent", r.UserAgent(),
+				"request_id", requestid.FromContext(r.Context()),
+			)
+		})
+	}
+}
+
+// RouteTemplate returns the path template of the matched mux route, such as
+// /views/{vID}, falling back to the raw path when no route matched.
+func RouteTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return r.URL.Path
+}
+
+// ClientIP returns the address of the client that sent r. Proxy headers are
+// only honoured when trustProxy is set, since clients can forge them.
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			first, _, _ := strings.Cut(xff, ",")
+			return strings.TrimSpace(first)
+		}
+		if ip := r.Header.Get("X-Real-IP"); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// PeerIP returns the address of the peer of the gRPC call ctx belongs to,
+// or "" outside of one.
+func PeerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	addr := p.Addr.String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
 }
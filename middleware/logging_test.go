@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"view_count/requestid"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/peer"
+)
+
+func TestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := LoggingConfig{Level: "info", Format: "json", SampleRate: 1}
+	logger, err := NewLogger(&buf, cfg)
+	require.NoError(t, err)
+
+	r := mux.NewRouter()
+	r.Use(RequestID, Logging(logger, cfg))
+	r.HandleFunc("/views/{vID}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	r.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "server error", http.StatusInternalServerError)
+	})
+
+	t.Run("One line with route template", func(t *testing.T) {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/views/video1", nil)
+		req.Header.Set("User-Agent", "test-agent")
+		req.Header.Set("X-Request-ID", "req-1")
+		req.RemoteAddr = "10.0.0.1:1234"
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		var line map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+		assert.Equal(t, "info", line["level"])
+		assert.Equal(t, "GET", line["method"])
+		assert.Equal(t, "/views/{vID}", line["route"])
+		assert.Equal(t, float64(200), line["status"])
+		assert.Equal(t, float64(5), line["bytes"])
+		assert.Equal(t, "10.0.0.1", line["client_ip"])
+		assert.Equal(t, "test-agent", line["user_agent"])
+		assert.Equal(t, "req-1", line["request_id"])
+	})
+
+	t.Run("Errors are logged at error level", func(t *testing.T) {
+		buf.Reset()
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+
+		var line map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+		assert.Equal(t, "error", line["level"])
+		assert.Equal(t, float64(500), line["status"])
+	})
+}
+
+func TestLoggingSampling(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := LoggingConfig{SampleRate: 0}
+	logger, err := NewLogger(&buf, cfg)
+	require.NoError(t, err)
+
+	r := mux.NewRouter()
+	r.Use(Logging(logger, cfg))
+	r.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	r.HandleFunc("/bad", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	assert.Empty(t, buf.String())
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/bad", nil))
+	assert.Contains(t, buf.String(), "level=warn")
+}
+
+func TestNewLoggerRejectsUnknownOptions(t *testing.T) {
+	_, err := NewLogger(&bytes.Buffer{}, LoggingConfig{Format: "xml"})
+	assert.Error(t, err)
+	_, err = NewLogger(&bytes.Buffer{}, LoggingConfig{Level: "trace"})
+	assert.Error(t, err)
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.2")
+
+	assert.Equal(t, "10.0.0.1", ClientIP(req, false))
+	assert.Equal(t, "203.0.113.7", ClientIP(req, true))
+}
+
+func TestPeerIP(t *testing.T) {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}})
+	assert.Equal(t, "10.0.0.1", PeerIP(ctx))
+	assert.Equal(t, "", PeerIP(context.Background()))
+}
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestid.FromContext(r.Context())
+	}))
+
+	t.Run("Accepted from client", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(requestid.Header, "req-1")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		assert.Equal(t, "req-1", seen)
+		assert.Equal(t, "req-1", rec.Header().Get(requestid.Header))
+	})
+
+	t.Run("Generated when missing or invalid", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(requestid.Header, "bad id */")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		assert.True(t, requestid.Valid(seen))
+		assert.NotEqual(t, "bad id */", seen)
+		assert.Equal(t, seen, rec.Header().Get(requestid.Header))
+	})
+}
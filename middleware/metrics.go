@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/go-kit/kit/metrics"
+	"github.com/gorilla/mux"
+)
+
+// Metrics observes the duration of every request in duration, labelled by
+// route template, method and status code.
+func Metrics(duration metrics.Histogram) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			m := httpsnoop.CaptureMetrics(next, w, r)
+			duration.With(
+				"route", RouteTemplate(r),
+				"method", r.Method,
+				"status", strconv.Itoa(m.Code),
+			).Observe(m.Duration.Seconds())
+		})
+	}
+}
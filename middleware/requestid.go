@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"net/http"
+	"view_count/requestid"
+)
+
+// RequestID stores the request's correlation ID in its context and echoes
+// it in the response. A valid X-Request-ID from the client is kept;
+// otherwise a new ID is generated.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+		w.Header().Set(requestid.Header, id)
+		next.ServeHTTP(w, r.WithContext(requestid.NewContext(r.Context(), id)))
+	})
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Successor marks the responses of a route kept for compatibility with a
+// Link to the route replacing it. The {name} variables of successor are
+// filled in from those of the request.
+func Successor(successor string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			link := successor
+			for name, value := range mux.Vars(r) {
+				link = strings.ReplaceAll(link, "{"+name+"}", value)
+			}
+			w.Header().Add("Link", "<"+link+`>; rel="successor-version"`)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/felixge/httpsnoop"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "view_count/middleware"
+
+// Tracing starts a server span per request, continuing any trace passed in
+// by the caller through the W3C traceparent header. Spans are named after
+// the route template, e.g. "GET /views/{vID}".
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		route := RouteTemplate(r)
+
+		ctx, span := otel.Tracer(tracerName).Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+				semconv.UserAgentOriginal(r.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		m := httpsnoop.CaptureMetrics(next, w, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(m.Code))
+		if m.Code >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(m.Code))
+		}
+	})
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// APIKey is a credential for the HTTP API. Only the SHA-256 hash of the key
+// is stored; the key itself is shown once when it is created. A zero
+// LastUsedAt means the key was never used and a zero RevokedAt that it is
+// still valid.
+type APIKey struct {
+	Id         string
+	Name       string
+	Role       string
+	Hash       string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	RevokedAt  time.Time
+}
+
+// Revoked reports whether k may no longer be used.
+func (k APIKey) Revoked() bool {
+	return !k.RevokedAt.IsZero()
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// QuarantinedView is a view that failed qualification and was kept with
+// its viewer details for review.
+type QuarantinedView struct {
+	VideoId   string
+	Reason    string
+	IP        string
+	UserAgent string
+	ViewedAt  time.Time
+}
@@ -0,0 +1,11 @@
+package model
+
+// Rank is a video's place in the all-time leaderboard. Videos with the
+// same views share a Position, one more than the number of videos with
+// more views; Ties is how many other videos have the same views.
+type Rank struct {
+	Id       string
+	Views    int
+	Position int
+	Ties     int
+}
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// Webhook is a subscription to view count milestones. It fires once per
+// video for every threshold the video's count reaches. An empty VideoId
+// matches every video.
+type Webhook struct {
+	Id         string
+	URL        string
+	Secret     string
+	VideoId    string
+	Thresholds []int
+	CreatedAt  time.Time
+}
+
+// Matches reports whether w watches videoId.
+func (w Webhook) Matches(videoId string) bool {
+	return w.VideoId == "" || w.VideoId == videoId
+}
+
+// DeadLetter is a webhook delivery that was given up on.
+type DeadLetter struct {
+	Id        string
+	WebhookId string
+	Payload   []byte
+	Attempts  int
+	LastError string
+	FailedAt  time.Time
+}
@@ -0,0 +1,111 @@
+// Package negotiate picks response media types from Accept headers as
+// described in RFC 9110, section 12.5.1.
+package negotiate
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MediaRange is one element of an Accept header.
+type MediaRange struct {
+	Type, Subtype string
+	// Params holds the parameters before q, with lower-case names.
+	Params map[string]string
+	Q      float64
+}
+
+// ParseAccept returns the media ranges of an Accept header in order.
+// Malformed ranges are skipped.
+func ParseAccept(header string) []MediaRange {
+	var ranges []MediaRange
+	for _, elem := range strings.Split(header, ",") {
+		if mr, ok := parseRange(elem); ok {
+			ranges = append(ranges, mr)
+		}
+	}
+	return ranges
+}
+
+func parseRange(s string) (MediaRange, bool) {
+	parts := strings.Split(s, ";")
+	typ, subtype, ok := parseMediaType(parts[0])
+	if !ok || (typ == "*" && subtype != "*") {
+		return MediaRange{}, false
+	}
+	mr := MediaRange{Type: typ, Subtype: subtype, Q: 1}
+	for _, param := range parts[1:] {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return MediaRange{}, false
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		if name == "q" {
+			q, err := strconv.ParseFloat(value, 64)
+			if err != nil || q < 0 || q > 1 {
+				return MediaRange{}, false
+			}
+			mr.Q = q
+			// parameters after q are accept extensions, not part of the range.
+			break
+		}
+		if mr.Params == nil {
+			mr.Params = make(map[string]string)
+		}
+		mr.Params[name] = value
+	}
+	return mr, true
+}
+
+func parseMediaType(s string) (typ, subtype string, ok bool) {
+	typ, subtype, ok = strings.Cut(strings.ToLower(strings.TrimSpace(s)), "/")
+	return typ, subtype, ok && typ != "" && subtype != ""
+}
+
+// quality returns the q of the most specific range in ranges matching the
+// media type offer, and 0 if none does. Parameters of both are ignored:
+// they are ones such as charset, which offers do not vary by.
+func quality(ranges []MediaRange, offer string) float64 {
+	offer, _, _ = strings.Cut(offer, ";")
+	typ, subtype, _ := parseMediaType(offer)
+	q, best := 0.0, -1
+	for _, mr := range ranges {
+		var specificity int
+		switch {
+		case mr.Type == "*":
+		case mr.Type == typ && mr.Subtype == "*":
+			specificity = 1
+		case mr.Type == typ && mr.Subtype == subtype:
+			specificity = 2
+		default:
+			continue
+		}
+		if specificity > best {
+			q, best = mr.Q, specificity
+		}
+	}
+	return q
+}
+
+// Best returns the offer that accept gives the highest quality, the
+// earlier one on ties, or "" if accept rules out every offer. An empty
+// accept accepts anything, so the first offer is returned. Offers are
+// media types, possibly with parameters.
+func Best(accept string, offers ...string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+	ranges := ParseAccept(accept)
+	var best string
+	var bestQ float64
+	for _, offer := range offers {
+		if q := quality(ranges, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
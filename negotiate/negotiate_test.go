@@ -0,0 +1,40 @@
+package negotiate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAccept(t *testing.T) {
+	ranges := ParseAccept(`text/html;level=1, application/JSON; q=0.5; ext=1, bogus, */json, text/*;q=2, */*;q="0.1"`)
+	assert.Equal(t, []MediaRange{
+		{Type: "text", Subtype: "html", Params: map[string]string{"level": "1"}, Q: 1},
+		{Type: "application", Subtype: "json", Q: 0.5},
+		{Type: "*", Subtype: "*", Q: 0.1},
+	}, ranges)
+}
+
+func TestBest(t *testing.T) {
+	offers := []string{"text/html", "application/json"}
+	for _, tc := range []struct {
+		accept string
+		want   string
+	}{
+		{"", "text/html"},
+		{"*/*", "text/html"},
+		{"application/json", "application/json"},
+		{"application/json; charset=utf-8", "application/json"},
+		{"text/html;q=0.9, application/json", "application/json"},
+		{"text/*;q=0.5, application/*", "application/json"},
+		{"text/html;q=0, */*", "application/json"},
+		{"*/*;q=0.8, text/html;q=0.1", "application/json"},
+		{"application/json;q=0.5, text/html;q=0.5", "text/html"},
+		{"text/plain", ""},
+		{"application/json;q=0, text/html;q=0", ""},
+	} {
+		assert.Equal(t, tc.want, Best(tc.accept, offers...), tc.accept)
+	}
+	assert.Equal(t, "", Best("*/*"))
+	assert.Equal(t, "text/csv; charset=utf-8", Best("text/csv", "application/json", "text/csv; charset=utf-8"))
+}
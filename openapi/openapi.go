@@ -0,0 +1,37 @@
+// Package openapi holds the hand-maintained OpenAPI documents of the HTTP
+// APIs and serves them with a docs page. Contract tests built on
+// openapitest keep them in step with the routers.
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Server documents the routes of the main server.
+//
+//go:embed server.json
+var Server []byte
+
+// ViewService documents the routes of viewservice.MakeHandler.
+//
+//go:embed viewservice.json
+var ViewService []byte
+
+//go:embed docs.html
+var docs []byte
+
+// Register serves spec at /openapi.json and a Swagger UI page for it at
+// /docs.
+func Register(r *mux.Router, spec []byte) {
+	r.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec)
+	}).Methods("GET")
+	r.HandleFunc("/docs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(docs)
+	}).Methods("GET")
+}
@@ -0,0 +1,34 @@
+package openapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"view_count/openapi/openapitest"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocuments(t *testing.T) {
+	for name, spec := range map[string][]byte{"server": Server, "viewservice": ViewService} {
+		t.Run(name, func(t *testing.T) {
+			openapitest.Load(t, spec)
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	r := mux.NewRouter()
+	Register(r, ViewService)
+
+	for target, contentType := range map[string]string{
+		"/openapi.json": "application/json",
+		"/docs":         "text/html; charset=utf-8",
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusOK, rec.Code, target)
+		assert.Equal(t, contentType, rec.Header().Get("Content-Type"), target)
+	}
+}
@@ -0,0 +1,107 @@
+// Package openapitest checks routers and their responses against an
+// OpenAPI document, for contract tests.
+package openapitest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gorilla/mux"
+)
+
+func init() {
+	// bodies of these types are checked as plain strings.
+	openapi3filter.RegisterBodyDecoder("text/html", openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("text/event-stream", openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("application/x-ndjson", openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("application/xml", openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("application/x-protobuf", openapi3filter.FileBodyDecoder)
+}
+
+// Contract is a validated OpenAPI document.
+type Contract struct {
+	doc    *openapi3.T
+	router routers.Router
+}
+
+// Load parses and validates spec, failing t when it is invalid.
+func Load(t testing.TB, spec []byte) *Contract {
+	t.Helper()
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	if err != nil {
+		t.Fatalf("openapi: %v", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatalf("openapi: invalid document: %v", err)
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatalf("openapi: %v", err)
+	}
+	return &Contract{doc: doc, router: router}
+}
+
+// Undocumented returns the routes of r that have no operation, as
+// "METHOD /path/{var}". A route without methods needs at least one
+// operation on its path.
+func (c *Contract) Undocumented(r *mux.Router) []string {
+	var missing []string
+	r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil || route.GetHandler() == nil {
+			// prefixes of subrouters
+			return nil
+		}
+		item := c.doc.Paths.Find(path)
+		methods, _ := route.GetMethods()
+		if len(methods) == 0 {
+			if item == nil || len(item.Operations()) == 0 {
+				missing = append(missing, "* "+path)
+			}
+			return nil
+		}
+		for _, method := range methods {
+			if item == nil || item.GetOperation(method) == nil {
+				missing = append(missing, method+" "+path)
+			}
+		}
+		return nil
+	})
+	return missing
+}
+
+// Check fails t unless the response rec recorded for req matches the
+// documented operation, its status included.
+func (c *Contract) Check(t testing.TB, req *http.Request, rec *httptest.ResponseRecorder) {
+	t.Helper()
+	name := req.Method + " " + req.URL.Path
+	route, params, err := c.router.FindRoute(req)
+	if err != nil {
+		t.Errorf("%s: %v", name, err)
+		return
+	}
+	err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: params,
+			Route:      route,
+		},
+		Status: rec.Code,
+		Header: rec.Header(),
+		Body:   io.NopCloser(strings.NewReader(rec.Body.String())),
+		Options: &openapi3filter.Options{
+			IncludeResponseStatus: true,
+		},
+	})
+	if err != nil {
+		t.Errorf("%s: response %d does not match the document: %v", name, rec.Code, err)
+	}
+}
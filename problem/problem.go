@@ -0,0 +1,94 @@
+// Package problem writes errors as RFC 7807 problem details, the error
+// format of the versioned API.
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"view_count/requestid"
+
+	"github.com/gorilla/mux"
+)
+
+// ContentType is the media type of problem details.
+const ContentType = "application/problem+json"
+
+// Types of the problems that clients may want to tell apart from others
+// with the same status. Problems that are fully described by their status
+// have type "about:blank".
+const (
+	TypeInvalidArgument       = "/problems/invalid-argument"
+	TypeInvalidIdempotencyKey = "/problems/invalid-idempotency-key"
+	TypeIdempotencyKeyReused  = "/problems/idempotency-key-reused"
+	TypeViewTokenRejected     = "/problems/view-token-rejected"
+	TypeRateLimited           = "/problems/rate-limited"
+)
+
+var titles = map[string]string{
+	TypeInvalidArgument:       "Invalid argument",
+	TypeInvalidIdempotencyKey: "Invalid Idempotency-Key",
+	TypeIdempotencyKeyReused:  "Idempotency-Key reused",
+	TypeViewTokenRejected:     "View token rejected",
+	TypeRateLimited:           "Rate limit exceeded",
+}
+
+// Problem is a problem details object. RequestId is an extension member
+// carrying the request's correlation ID.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestId string `json:"request_id,omitempty"`
+}
+
+// New returns a problem of typ, which is "about:blank" when empty, titled
+// after typ or, for "about:blank", after status.
+func New(typ string, status int, detail string) Problem {
+	if typ == "" {
+		typ = "about:blank"
+	}
+	title, ok := titles[typ]
+	if !ok {
+		title = http.StatusText(status)
+	}
+	return Problem{Type: typ, Title: title, Status: status, Detail: detail}
+}
+
+// Write replies to r with p. The instance defaults to the request path.
+func Write(w http.ResponseWriter, r *http.Request, p Problem) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	p.RequestId = requestid.FromContext(r.Context())
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+type contextKey struct{}
+
+// Middleware marks requests whose path starts with prefix as wanting
+// problem details, so that handlers shared with the unversioned routes,
+// such as those of auth and rate limiting, know which format to reply in.
+// It must come before them.
+func Middleware(prefix string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				r = r.WithContext(context.WithValue(r.Context(), contextKey{}, true))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Wanted reports whether r was marked by Middleware.
+func Wanted(r *http.Request) bool {
+	wanted, _ := r.Context().Value(contextKey{}).(bool)
+	return wanted
+}
@@ -0,0 +1,52 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"view_count/requestid"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	assert.Equal(t, Problem{Type: "about:blank", Title: "Not Found", Status: http.StatusNotFound},
+		New("", http.StatusNotFound, ""))
+	assert.Equal(t, Problem{Type: TypeRateLimited, Title: "Rate limit exceeded", Status: http.StatusTooManyRequests, Detail: "slow down"},
+		New(TypeRateLimited, http.StatusTooManyRequests, "slow down"))
+}
+
+func TestWrite(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v1/videos/video1", nil)
+	req = req.WithContext(requestid.NewContext(req.Context(), "req-1"))
+	rec := httptest.NewRecorder()
+
+	Write(rec, req, New(TypeInvalidArgument, http.StatusBadRequest, "video id is required"))
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, ContentType, rec.Header().Get("Content-Type"))
+	var got Problem
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+	assert.Equal(t, Problem{
+		Type:      TypeInvalidArgument,
+		Title:     "Invalid argument",
+		Status:    http.StatusBadRequest,
+		Detail:    "video id is required",
+		Instance:  "/v1/videos/video1",
+		RequestId: "req-1",
+	}, got)
+}
+
+func TestMiddleware(t *testing.T) {
+	var wanted bool
+	h := Middleware("/v1/")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wanted = Wanted(r)
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/videos", nil))
+	assert.True(t, wanted)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/views/video1", nil))
+	assert.False(t, wanted)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"time"
+	"view_count/repository/invalidviewrepository"
+
+	kitlog "github.com/go-kit/log"
+)
+
+// expireQuarantinedViewsWorker deletes quarantined views older than
+// retention every interval, since they hold viewer IPs and user agents.
+func expireQuarantinedViewsWorker(repo invalidviewrepository.Repository, retention, interval time.Duration, logger kitlog.Logger) worker {
+	return func(ctx context.Context) error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+
+			n, err := repo.DeleteQuarantinedBefore(ctx, time.Now().UTC().Add(-retention))
+			if err != nil && ctx.Err() == nil {
+				logger.Log("msg", "expiring quarantined views failed", "err", err)
+			} else if n > 0 {
+				logger.Log("msg", "expired quarantined views", "deleted", n)
+			}
+		}
+	}
+}
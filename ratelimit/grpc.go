@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"context"
+	"view_count/auth"
+	"view_count/middleware"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// grpcContext records the client of a gRPC call in ctx, as Middleware does
+// for HTTP requests: by API key when the call has one, by peer address
+// otherwise.
+func grpcContext(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if k := auth.KeyFromMetadata(md); k != "" {
+		return NewContext(ctx, "key:"+hashKey(k))
+	}
+	return NewContext(ctx, "ip:"+middleware.PeerIP(ctx))
+}
+
+// UnaryServerInterceptor records the client of unary calls so that the
+// ScopeVideo rules apply to their increments.
+func (l *Limiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(grpcContext(ctx), req)
+	}
+}
+
+type clientStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s clientStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming calls,
+// such as IngestViews.
+func (l *Limiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, clientStream{ss, grpcContext(ss.Context())})
+	}
+}
@@ -0,0 +1,168 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+	"view_count/auth"
+	"view_count/middleware"
+	"view_count/problem"
+	"view_count/viewservice"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/log"
+	"github.com/gorilla/mux"
+)
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx identifying the client that made the
+// request, which keys ScopeVideo buckets.
+func NewContext(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, contextKey{}, client)
+}
+
+// FromContext returns the client stored in ctx, or "" if there is none.
+func FromContext(ctx context.Context) string {
+	client, _ := ctx.Value(contextKey{}).(string)
+	return client
+}
+
+// Limiter applies rules to HTTP requests and increments. Requests are let
+// through when the store fails, so an unavailable store does not take the
+// service down with it.
+type Limiter struct {
+	store      Store
+	rules      []Rule
+	rejections metrics.Counter
+	logger     log.Logger
+}
+
+// NewLimiter returns a Limiter counting rejections by scope and route.
+func NewLimiter(store Store, rules []Rule, rejections metrics.Counter, logger log.Logger) *Limiter {
+	return &Limiter{
+		store:      store,
+		rules:      rules,
+		rejections: rejections,
+		logger:     logger,
+	}
+}
+
+// take takes a token for key from the bucket of the i-th rule. Buckets are
+// keyed by the rule's index, so rules of the same scope do not share them.
+func (l *Limiter) take(ctx context.Context, i int, route, key string) error {
+	rule := l.rules[i]
+	res, err := l.store.Take(ctx, rule.Scope+":"+strconv.Itoa(i)+":"+key, rule.Limit)
+	if err != nil {
+		l.logger.Log("msg", "rate limit store failed, allowing request", "scope", rule.Scope, "err", err)
+		return nil
+	}
+	if res.Allowed {
+		return nil
+	}
+	l.rejections.With("scope", rule.Scope, "route", route).Add(1)
+	return &LimitedError{Scope: rule.Scope, RetryAfter: res.RetryAfter}
+}
+
+// hashKey keeps API keys out of store keys and logs.
+func hashKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Middleware applies the ScopeIP and ScopeAPIKey rules of the matched
+// route and records the client in the request context for ScopeVideo.
+// Client IPs come from proxy headers only when trustProxy is set.
+func (l *Limiter) Middleware(trustProxy bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := middleware.RouteTemplate(r)
+			ip := middleware.ClientIP(r, trustProxy)
+			var apiKey string
+			if k := auth.KeyFromRequest(r); k != "" {
+				apiKey = hashKey(k)
+			}
+
+			for i, rule := range l.rules {
+				if rule.Route != "" && rule.Route != route {
+					continue
+				}
+				var err error
+				switch {
+				case rule.Scope == ScopeIP:
+					err = l.take(r.Context(), i, route, route+":"+ip)
+				case rule.Scope == ScopeAPIKey && apiKey != "":
+					err = l.take(r.Context(), i, route, route+":"+apiKey)
+				}
+				if retryAfter, limited := RetryAfter(err); limited {
+					WriteTooManyRequests(w, r, retryAfter)
+					return
+				}
+			}
+
+			client := "ip:" + ip
+			if apiKey != "" {
+				client = "key:" + apiKey
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), client)))
+		})
+	}
+}
+
+// WriteTooManyRequests replies with 429 and a Retry-After header, as
+// problem details if r wants them.
+func WriteTooManyRequests(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(retryAfter)))
+	if problem.Wanted(r) {
+		problem.Write(w, r, problem.New(problem.TypeRateLimited, http.StatusTooManyRequests, "rate limit exceeded"))
+		return
+	}
+	http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+}
+
+type rateLimitedService struct {
+	limiter *Limiter
+	viewservice.Service
+}
+
+// NewService returns a Service that applies the ScopeVideo rules to
+// Increment and IncrementOnce, keyed by the client in the context, which
+// Middleware and the gRPC interceptors record. Calls without a client,
+// such as those from the CLI, are not limited.
+func NewService(limiter *Limiter, s viewservice.Service) viewservice.Service {
+	return &rateLimitedService{limiter, s}
+}
+
+func (s *rateLimitedService) Increment(ctx context.Context, videoId string) (err error) {
+	if err := s.take(ctx, videoId); err != nil {
+		return err
+	}
+	return s.Service.Increment(ctx, videoId)
+}
+
+func (s *rateLimitedService) IncrementOnce(ctx context.Context, videoId, key string, ttl time.Duration) (replayed bool, err error) {
+	if err := s.take(ctx, videoId); err != nil {
+		return false, err
+	}
+	return s.Service.IncrementOnce(ctx, videoId, key, ttl)
+}
+
+// take applies the ScopeVideo rules to an increment of videoId.
+func (s *rateLimitedService) take(ctx context.Context, videoId string) error {
+	client := FromContext(ctx)
+	if client == "" {
+		return nil
+	}
+	for i, rule := range s.limiter.rules {
+		if rule.Scope != ScopeVideo {
+			continue
+		}
+		if err := s.limiter.take(ctx, i, "Increment", client+":"+videoId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
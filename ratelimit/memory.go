@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// full is how long the bucket takes to refill from empty.
+	full time.Duration
+}
+
+type memoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryStore returns a Store for a single instance. Buckets that have
+// refilled completely are dropped every minute.
+func NewMemoryStore() *memoryStore {
+	return &memoryStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (s *memoryStore) Take(ctx context.Context, key string, l Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		s.sweep(now)
+		s.lastSweep = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{
+			tokens: float64(l.Burst),
+			last:   now,
+			full:   time.Duration(float64(l.Burst) / l.Rate * float64(time.Second)),
+		}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.Burst), b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+		return Result{RetryAfter: wait}, nil
+	}
+	b.tokens--
+	return Result{Allowed: true}, nil
+}
+
+// sweep drops buckets idle long enough to be full again, which makes them
+// indistinguishable from new ones.
+func (s *memoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if now.Sub(b.last) > b.full {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Package ratelimit limits requests with token buckets keyed by client IP,
+// API key and (client, video) pair. Buckets live in a pluggable Store so
+// that several instances can share them.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Scopes a rule can key its buckets by.
+const (
+	ScopeIP     = "ip"
+	ScopeAPIKey = "apikey"
+	// ScopeVideo keys by the (client, video) pair of an increment.
+	ScopeVideo = "video"
+)
+
+// Limit is a token bucket refilled at Rate tokens per second that holds at
+// most Burst tokens.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseLimit parses "<n>/<period>[:<burst>]", such as "10/1s:20" or
+// "1/10s". Burst defaults to n.
+func ParseLimit(s string) (Limit, error) {
+	spec, burstStr, hasBurst := strings.Cut(s, ":")
+	nStr, periodStr, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid limit %q: want <n>/<period>[:<burst>]", s)
+	}
+	n, err := strconv.Atoi(nStr)
+	if err != nil || n < 1 {
+		return Limit{}, fmt.Errorf("invalid limit %q: n must be a positive integer", s)
+	}
+	period, err := time.ParseDuration(periodStr)
+	if err != nil || period <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q: period must be a positive duration", s)
+	}
+	burst := n
+	if hasBurst {
+		if burst, err = strconv.Atoi(burstStr); err != nil || burst < 1 {
+			return Limit{}, fmt.Errorf("invalid limit %q: burst must be a positive integer", s)
+		}
+	}
+	return Limit{Rate: float64(n) / period.Seconds(), Burst: burst}, nil
+}
+
+// Rule applies Limit to the requests of one scope. Route is a mux path
+// template such as /increment/{vID}; empty matches every route. Rules of
+// ScopeVideo apply to increments and ignore Route.
+type Rule struct {
+	Scope string
+	Route string
+	Limit Limit
+}
+
+// ParseRule parses "<scope>[:<route>]=<limit>", such as
+// "ip:/increment/{vID}=10/1s:20" or "video=5/1m".
+func ParseRule(s string) (Rule, error) {
+	target, limit, ok := strings.Cut(s, "=")
+	if !ok {
+		return Rule{}, fmt.Errorf("invalid rate limit rule %q: want <scope>[:<route>]=<limit>", s)
+	}
+	scope, route, _ := strings.Cut(target, ":")
+	switch scope {
+	case ScopeIP, ScopeAPIKey, ScopeVideo:
+	default:
+		return Rule{}, fmt.Errorf("invalid rate limit rule %q: unknown scope %q", s, scope)
+	}
+	l, err := ParseLimit(limit)
+	if err != nil {
+		return Rule{}, err
+	}
+	return Rule{Scope: scope, Route: route, Limit: l}, nil
+}
+
+// Result is the outcome of taking a token.
+type Result struct {
+	Allowed bool
+	// RetryAfter is how long until a token is available when not Allowed.
+	RetryAfter time.Duration
+}
+
+// Store holds token buckets.
+type Store interface {
+	// Take removes a token from the bucket of key, creating a full one if
+	// there is none.
+	Take(ctx context.Context, key string, l Limit) (Result, error)
+}
+
+// LimitedError is returned when a request exceeded the limit of Scope.
+type LimitedError struct {
+	Scope      string
+	RetryAfter time.Duration
+}
+
+func (e *LimitedError) Error() string {
+	return fmt.Sprintf("rate limit of %s exceeded, retry after %s", e.Scope, e.RetryAfter)
+}
+
+// GRPCStatus makes gRPC servers reply with ResourceExhausted.
+func (e *LimitedError) GRPCStatus() *status.Status {
+	return status.New(codes.ResourceExhausted, e.Error())
+}
+
+// RetryAfter reports whether err is a LimitedError and when to retry.
+func RetryAfter(err error) (time.Duration, bool) {
+	var limited *LimitedError
+	if errors.As(err, &limited) {
+		return limited.RetryAfter, true
+	}
+	return 0, false
+}
+
+// retryAfterSeconds rounds d up to whole seconds, at least 1, for the
+// Retry-After header.
+func retryAfterSeconds(d time.Duration) int {
+	return max(1, int(math.Ceil(d.Seconds())))
+}
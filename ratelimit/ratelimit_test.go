@@ -0,0 +1,246 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"view_count/auth"
+	"view_count/repository/viewrepository"
+	"view_count/viewservice"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/log"
+	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule("ip:/increment/{vID}=10/2s:30")
+	require.NoError(t, err)
+	assert.Equal(t, Rule{Scope: ScopeIP, Route: "/increment/{vID}", Limit: Limit{Rate: 5, Burst: 30}}, rule)
+
+	rule, err = ParseRule("video=6/1m")
+	require.NoError(t, err)
+	assert.Equal(t, Rule{Scope: ScopeVideo, Limit: Limit{Rate: 0.1, Burst: 6}}, rule)
+
+	for _, s := range []string{"ip", "user=1/1s", "ip=1", "ip=0/1s", "ip=1/x", "ip=1/1s:0"} {
+		_, err := ParseRule(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestStores(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	stores := map[string]Store{
+		"memory": NewMemoryStore(),
+		"redis":  NewRedisStore(client, "test:"),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			l := Limit{Rate: 1, Burst: 2}
+
+			for i := 0; i < 2; i++ {
+				res, err := store.Take(ctx, "a", l)
+				require.NoError(t, err)
+				assert.True(t, res.Allowed)
+			}
+			res, err := store.Take(ctx, "a", l)
+			require.NoError(t, err)
+			assert.False(t, res.Allowed)
+			assert.InDelta(t, time.Second, res.RetryAfter, float64(100*time.Millisecond))
+
+			res, err = store.Take(ctx, "b", l)
+			require.NoError(t, err)
+			assert.True(t, res.Allowed, "buckets are per key")
+		})
+	}
+}
+
+func TestMemoryStoreRefills(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+	l := Limit{Rate: 2, Burst: 1}
+
+	res, _ := store.Take(ctx, "a", l)
+	assert.True(t, res.Allowed)
+	res, _ = store.Take(ctx, "a", l)
+	assert.False(t, res.Allowed)
+
+	now = now.Add(500 * time.Millisecond)
+	res, _ = store.Take(ctx, "a", l)
+	assert.True(t, res.Allowed)
+
+	now = now.Add(2 * time.Minute)
+	store.Take(ctx, "b", l)
+	assert.Len(t, store.buckets, 1, "idle full buckets are swept")
+}
+
+// labelCounter records the total added per label set.
+type labelCounter struct {
+	totals map[string]float64
+	lvs    []string
+}
+
+func newLabelCounter() *labelCounter {
+	return &labelCounter{totals: map[string]float64{}}
+}
+
+func (c *labelCounter) With(labelValues ...string) metrics.Counter {
+	return &labelCounter{totals: c.totals, lvs: append(append([]string{}, c.lvs...), labelValues...)}
+}
+
+func (c *labelCounter) Add(delta float64) {
+	c.totals[strings.Join(c.lvs, ",")] += delta
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, Limit) (Result, error) {
+	return Result{}, assert.AnError
+}
+
+func TestMiddleware(t *testing.T) {
+	rejections := newLabelCounter()
+	limiter := NewLimiter(NewMemoryStore(), []Rule{
+		{Scope: ScopeIP, Route: "/increment/{vID}", Limit: Limit{Rate: 0.001, Burst: 2}},
+		{Scope: ScopeAPIKey, Limit: Limit{Rate: 0.001, Burst: 3}},
+	}, rejections, log.NewNopLogger())
+
+	var client string
+	r := mux.NewRouter()
+	r.Use(limiter.Middleware(false))
+	r.HandleFunc("/increment/{vID}", func(w http.ResponseWriter, r *http.Request) {
+		client = FromContext(r.Context())
+	})
+	r.HandleFunc("/views/{vID}", func(w http.ResponseWriter, r *http.Request) {})
+
+	do := func(path, ip, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, nil)
+		req.RemoteAddr = ip + ":1234"
+		if apiKey != "" {
+			req.Header.Set(auth.APIKeyHeader, apiKey)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, do("/increment/a", "10.0.0.1", "").Code)
+	assert.Equal(t, "ip:10.0.0.1", client)
+	assert.Equal(t, http.StatusOK, do("/increment/b", "10.0.0.1", "").Code)
+
+	rec := do("/increment/c", "10.0.0.1", "")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+	assert.Equal(t, map[string]float64{"scope,ip,route,/increment/{vID}": 1}, rejections.totals)
+
+	assert.Equal(t, http.StatusOK, do("/views/a", "10.0.0.1", "").Code, "other routes are not limited by the ip rule")
+	assert.Equal(t, http.StatusOK, do("/increment/a", "10.0.0.2", "").Code, "other IPs have their own bucket")
+
+	t.Run("API keys", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, http.StatusOK, do("/views/a", "10.0.0.3", "k1").Code)
+		}
+		assert.NotContains(t, client, "k1", "API keys are hashed")
+		// the apikey bucket is shared by every IP using the key.
+		assert.Equal(t, http.StatusOK, do("/views/a", "10.0.0.4", "k1").Code)
+		assert.Equal(t, http.StatusTooManyRequests, do("/views/a", "10.0.0.5", "k1").Code)
+		assert.Equal(t, http.StatusOK, do("/views/a", "10.0.0.5", "k2").Code)
+	})
+
+	t.Run("Rules of one scope have their own buckets", func(t *testing.T) {
+		limiter := NewLimiter(NewMemoryStore(), []Rule{
+			{Scope: ScopeIP, Route: "/", Limit: Limit{Rate: 10, Burst: 10}},
+			{Scope: ScopeIP, Route: "/", Limit: Limit{Rate: 0.001, Burst: 2}},
+		}, rejections, log.NewNopLogger())
+		r := mux.NewRouter()
+		r.Use(limiter.Middleware(false))
+		r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+		codes := make([]int, 3)
+		for i := range codes {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+			codes[i] = rec.Code
+		}
+		assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes)
+	})
+
+	t.Run("Store failures let requests through", func(t *testing.T) {
+		limiter := NewLimiter(failingStore{}, []Rule{{Scope: ScopeIP, Limit: Limit{Rate: 1, Burst: 1}}}, rejections, log.NewNopLogger())
+		r := mux.NewRouter()
+		r.Use(limiter.Middleware(false))
+		r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
+
+func TestService(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore(), []Rule{
+		{Scope: ScopeVideo, Limit: Limit{Rate: 0.001, Burst: 1}},
+	}, newLabelCounter(), log.NewNopLogger())
+	svc := NewService(limiter, viewservice.NewService(viewrepository.NewInmemoryRepo()))
+
+	ctx := NewContext(context.Background(), "ip:10.0.0.1")
+	require.NoError(t, svc.Increment(ctx, "a"))
+	require.NoError(t, svc.Increment(ctx, "b"))
+
+	err := svc.Increment(ctx, "a")
+	retryAfter, limited := RetryAfter(err)
+	assert.True(t, limited)
+	assert.Greater(t, retryAfter, time.Duration(0))
+
+	require.NoError(t, svc.Increment(NewContext(context.Background(), "ip:10.0.0.2"), "a"))
+	require.NoError(t, svc.Increment(context.Background(), "a"), "calls without a client are not limited")
+
+	views, _ := svc.GetView(context.Background(), "a")
+	assert.Equal(t, 3, views)
+}
+
+func TestGRPCInterceptors(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore(), []Rule{
+		{Scope: ScopeVideo, Limit: Limit{Rate: 0.001, Burst: 1}},
+	}, newLabelCounter(), log.NewNopLogger())
+	svc := NewService(limiter, viewservice.NewService(viewrepository.NewInmemoryRepo()))
+	interceptor := limiter.UnaryServerInterceptor()
+
+	increment := func(ctx context.Context, videoId string) error {
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req any) (any, error) {
+			return nil, svc.Increment(ctx, videoId)
+		})
+		return err
+	}
+	fromPeer := func(ip string) context.Context {
+		return peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234}})
+	}
+
+	require.NoError(t, increment(fromPeer("10.0.0.1"), "a"))
+	err := increment(fromPeer("10.0.0.1"), "a")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "peers are limited by address")
+	require.NoError(t, increment(fromPeer("10.0.0.2"), "a"))
+
+	withKey := metadata.NewIncomingContext(fromPeer("10.0.0.3"), metadata.Pairs("x-api-key", "k1"))
+	require.NoError(t, increment(withKey, "a"))
+	withKey = metadata.NewIncomingContext(fromPeer("10.0.0.4"), metadata.Pairs("x-api-key", "k1"))
+	err = increment(withKey, "a")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "callers with an API key are limited by key")
+}
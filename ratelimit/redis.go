@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript refills and takes from the bucket in hash KEYS[1], using the
+// server clock so that all instances agree. ARGV is rate per second and
+// burst. It returns 1 or 0 and the wait in milliseconds.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) / 1000 * rate)
+
+local allowed, wait = 0, 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate * 1000)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, wait}
+`)
+
+type redisStore struct {
+	client redis.Scripter
+	prefix string
+}
+
+// NewRedisStore returns a Store shared by all instances using the same
+// Redis-compatible server and prefix. Keys expire once their bucket is
+// full again.
+func NewRedisStore(client redis.Scripter, prefix string) *redisStore {
+	return &redisStore{client: client, prefix: prefix}
+}
+
+func (s *redisStore) Take(ctx context.Context, key string, l Limit) (Result, error) {
+	res, err := takeScript.Run(ctx, s.client, []string{s.prefix + key}, l.Rate, l.Burst).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{
+		Allowed:    res[0] == 1,
+		RetryAfter: time.Duration(res[1]) * time.Millisecond,
+	}, nil
+}
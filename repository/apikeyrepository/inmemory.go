@@ -0,0 +1,89 @@
+package apikeyrepository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+	"view_count/model"
+)
+
+type inmemoryRepo struct {
+	mu   sync.Mutex
+	keys map[string]model.APIKey
+}
+
+func NewInmemoryRepo() *inmemoryRepo {
+	return &inmemoryRepo{
+		keys: make(map[string]model.APIKey),
+	}
+}
+
+func (r *inmemoryRepo) CreateAPIKey(ctx context.Context, k model.APIKey) (model.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k.Id = newId()
+	k.CreatedAt = time.Now().UTC()
+	r.keys[k.Id] = k
+	return k, nil
+}
+
+func (r *inmemoryRepo) GetAPIKeyByHash(ctx context.Context, hash string) (model.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.keys {
+		if k.Hash == hash {
+			return k, nil
+		}
+	}
+	return model.APIKey{}, ErrAPIKeyNotFound
+}
+
+func (r *inmemoryRepo) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := make([]model.APIKey, 0, len(r.keys))
+	for _, k := range r.keys {
+		list = append(list, k)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].Id < list[j].Id
+	})
+	return list, nil
+}
+
+func (r *inmemoryRepo) RevokeAPIKey(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k, ok := r.keys[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	if !k.Revoked() {
+		k.RevokedAt = time.Now().UTC()
+		r.keys[id] = k
+	}
+	return nil
+}
+
+func (r *inmemoryRepo) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k, ok := r.keys[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	if usedAt.After(k.LastUsedAt) {
+		k.LastUsedAt = usedAt
+		r.keys[id] = k
+	}
+	return nil
+}
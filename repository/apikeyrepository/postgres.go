@@ -0,0 +1,91 @@
+package apikeyrepository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"view_count/model"
+)
+
+type postgresRepo struct {
+	*sql.DB
+}
+
+func NewPostgresRepo(db *sql.DB) *postgresRepo {
+	return &postgresRepo{
+		DB: db,
+	}
+}
+
+const apiKeyColumns = "id, name, role, key_hash, created_at, last_used_at, revoked_at"
+
+func scanAPIKey(row interface{ Scan(...any) error }) (k model.APIKey, err error) {
+	var lastUsed, revoked sql.NullTime
+	if err = row.Scan(&k.Id, &k.Name, &k.Role, &k.Hash, &k.CreatedAt, &lastUsed, &revoked); err != nil {
+		return model.APIKey{}, err
+	}
+	k.LastUsedAt = lastUsed.Time
+	k.RevokedAt = revoked.Time
+	return k, nil
+}
+
+func (db *postgresRepo) CreateAPIKey(ctx context.Context, k model.APIKey) (model.APIKey, error) {
+	k.Id = newId()
+	k.CreatedAt = time.Now().UTC()
+	_, err := db.ExecContext(ctx,
+		"INSERT INTO api_keys (id, name, role, key_hash, created_at) VALUES ($1, $2, $3, $4, $5)",
+		k.Id, k.Name, k.Role, k.Hash, k.CreatedAt)
+	if err != nil {
+		return model.APIKey{}, err
+	}
+	return k, nil
+}
+
+func (db *postgresRepo) GetAPIKeyByHash(ctx context.Context, hash string) (model.APIKey, error) {
+	row := db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = $1", hash)
+	k, err := scanAPIKey(row)
+	if err == sql.ErrNoRows {
+		return model.APIKey{}, ErrAPIKeyNotFound
+	}
+	return k, err
+}
+
+func (db *postgresRepo) ListAPIKeys(ctx context.Context) (list []model.APIKey, err error) {
+	rows, err := db.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY created_at, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, k)
+	}
+	return list, rows.Err()
+}
+
+func (db *postgresRepo) RevokeAPIKey(ctx context.Context, id string) error {
+	res, err := db.ExecContext(ctx,
+		"UPDATE api_keys SET revoked_at = COALESCE(revoked_at, NOW()) WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (db *postgresRepo) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	// GREATEST ignores NULL, so the first use is recorded as well.
+	_, err := db.ExecContext(ctx,
+		"UPDATE api_keys SET last_used_at = GREATEST(last_used_at, $2) WHERE id = $1", id, usedAt)
+	return err
+}
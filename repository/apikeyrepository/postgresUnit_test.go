@@ -0,0 +1,60 @@
+package apikeyrepository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+	"view_count/model"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresRepo(t *testing.T) {
+	database, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer database.Close()
+	repo := NewPostgresRepo(database)
+	ctx := context.Background()
+
+	t.Run("GetAPIKeyByHash", func(t *testing.T) {
+		created := time.Now()
+		mock.ExpectQuery("SELECT id, name, role, key_hash, created_at, last_used_at, revoked_at FROM api_keys WHERE key_hash = \\$1").
+			WithArgs("h1").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "role", "key_hash", "created_at", "last_used_at", "revoked_at"}).
+				AddRow("k1", "ingest", "writer", "h1", created, nil, nil))
+		mock.ExpectQuery("SELECT .* FROM api_keys WHERE key_hash = \\$1").
+			WithArgs("missing").
+			WillReturnError(sql.ErrNoRows)
+
+		k, err := repo.GetAPIKeyByHash(ctx, "h1")
+		require.NoError(t, err)
+		assert.Equal(t, model.APIKey{Id: "k1", Name: "ingest", Role: "writer", Hash: "h1", CreatedAt: created}, k)
+		assert.False(t, k.Revoked())
+
+		_, err = repo.GetAPIKeyByHash(ctx, "missing")
+		assert.Equal(t, ErrAPIKeyNotFound, err)
+	})
+
+	t.Run("RevokeAPIKey", func(t *testing.T) {
+		const query = "UPDATE api_keys SET revoked_at = COALESCE\\(revoked_at, NOW\\(\\)\\) WHERE id = \\$1"
+		mock.ExpectExec(query).WithArgs("k1").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(query).WithArgs("missing").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		assert.NoError(t, repo.RevokeAPIKey(ctx, "k1"))
+		assert.Equal(t, ErrAPIKeyNotFound, repo.RevokeAPIKey(ctx, "missing"))
+	})
+
+	t.Run("TouchAPIKey", func(t *testing.T) {
+		usedAt := time.Now()
+		mock.ExpectExec("UPDATE api_keys SET last_used_at = GREATEST\\(last_used_at, \\$2\\) WHERE id = \\$1").
+			WithArgs("k1", usedAt).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		assert.NoError(t, repo.TouchAPIKey(ctx, "k1", usedAt))
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
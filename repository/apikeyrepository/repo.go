@@ -0,0 +1,41 @@
+// Package apikeyrepository stores hashed API keys with their roles and
+// when they were last used.
+package apikeyrepository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+	"view_count/model"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+)
+
+type Repository interface {
+	// CreateAPIKey stores k under a new ID and returns it with the ID and
+	// creation time set. k.Hash must be set.
+	CreateAPIKey(ctx context.Context, k model.APIKey) (model.APIKey, error)
+
+	// GetAPIKeyByHash returns the key, revoked or not, whose hash is hash,
+	// or ErrAPIKeyNotFound.
+	GetAPIKeyByHash(ctx context.Context, hash string) (model.APIKey, error)
+
+	ListAPIKeys(ctx context.Context) ([]model.APIKey, error)
+
+	// RevokeAPIKey marks the key as revoked. Revoking a revoked key keeps
+	// the original time. It returns ErrAPIKeyNotFound if there is none.
+	RevokeAPIKey(ctx context.Context, id string) error
+
+	// TouchAPIKey records that the key was used at usedAt.
+	TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error
+}
+
+func newId() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
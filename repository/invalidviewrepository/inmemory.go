@@ -0,0 +1,83 @@
+package invalidviewrepository
+
+import (
+	"context"
+	"sync"
+	"time"
+	"view_count/model"
+)
+
+// maxQuarantined bounds the quarantined views kept in memory; the oldest
+// are dropped first.
+const maxQuarantined = 10000
+
+type inmemoryRepo struct {
+	mu          sync.Mutex
+	invalid     map[string]map[string]int
+	quarantined []model.QuarantinedView
+}
+
+func NewInmemoryRepo() *inmemoryRepo {
+	return &inmemoryRepo{
+		invalid: make(map[string]map[string]int),
+	}
+}
+
+func (r *inmemoryRepo) RecordInvalid(ctx context.Context, videoId, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.invalid[videoId] == nil {
+		r.invalid[videoId] = make(map[string]int)
+	}
+	r.invalid[videoId][reason]++
+	return nil
+}
+
+func (r *inmemoryRepo) InvalidViews(ctx context.Context, videoId string) (map[string]int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counts := make(map[string]int, len(r.invalid[videoId]))
+	for reason, n := range r.invalid[videoId] {
+		counts[reason] = n
+	}
+	return counts, nil
+}
+
+func (r *inmemoryRepo) Quarantine(ctx context.Context, v model.QuarantinedView) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.quarantined = append(r.quarantined, v)
+	if len(r.quarantined) > maxQuarantined {
+		r.quarantined = r.quarantined[len(r.quarantined)-maxQuarantined:]
+	}
+	return nil
+}
+
+func (r *inmemoryRepo) ListQuarantined(ctx context.Context, n int) ([]model.QuarantinedView, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var list []model.QuarantinedView
+	for i := len(r.quarantined) - 1; i >= 0 && len(list) < n; i-- {
+		list = append(list, r.quarantined[i])
+	}
+	return list, nil
+}
+
+func (r *inmemoryRepo) DeleteQuarantinedBefore(ctx context.Context, t time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.quarantined[:0]
+	for _, v := range r.quarantined {
+		if !v.ViewedAt.Before(t) {
+			kept = append(kept, v)
+		}
+	}
+	deleted := len(r.quarantined) - len(kept)
+	r.quarantined = kept
+	return deleted, nil
+}
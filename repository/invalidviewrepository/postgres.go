@@ -0,0 +1,80 @@
+package invalidviewrepository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"view_count/model"
+)
+
+type postgresRepo struct {
+	*sql.DB
+}
+
+func NewPostgresRepo(db *sql.DB) *postgresRepo {
+	return &postgresRepo{
+		DB: db,
+	}
+}
+
+func (db *postgresRepo) RecordInvalid(ctx context.Context, videoId, reason string) error {
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO invalid_views (video_id, reason, views) VALUES ($1, $2, 1) ON CONFLICT (video_id, reason) DO UPDATE SET views = invalid_views.views + 1`,
+		videoId, reason)
+	return err
+}
+
+func (db *postgresRepo) InvalidViews(ctx context.Context, videoId string) (map[string]int, error) {
+	rows, err := db.QueryContext(ctx, "SELECT reason, views FROM invalid_views WHERE video_id = $1", videoId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var (
+			reason string
+			views  int
+		)
+		if err := rows.Scan(&reason, &views); err != nil {
+			return nil, err
+		}
+		counts[reason] = views
+	}
+	return counts, rows.Err()
+}
+
+func (db *postgresRepo) Quarantine(ctx context.Context, v model.QuarantinedView) error {
+	_, err := db.ExecContext(ctx,
+		"INSERT INTO quarantined_views (video_id, reason, ip, user_agent, viewed_at) VALUES ($1, $2, $3, $4, $5)",
+		v.VideoId, v.Reason, v.IP, v.UserAgent, v.ViewedAt)
+	return err
+}
+
+func (db *postgresRepo) ListQuarantined(ctx context.Context, n int) (list []model.QuarantinedView, err error) {
+	rows, err := db.QueryContext(ctx,
+		"SELECT video_id, reason, ip, user_agent, viewed_at FROM quarantined_views ORDER BY viewed_at DESC, id DESC LIMIT $1", n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v model.QuarantinedView
+		if err := rows.Scan(&v.VideoId, &v.Reason, &v.IP, &v.UserAgent, &v.ViewedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, rows.Err()
+}
+
+func (db *postgresRepo) DeleteQuarantinedBefore(ctx context.Context, t time.Time) (int, error) {
+	res, err := db.ExecContext(ctx, "DELETE FROM quarantined_views WHERE viewed_at < $1", t)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
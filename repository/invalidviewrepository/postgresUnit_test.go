@@ -0,0 +1,41 @@
+package invalidviewrepository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresRepo(t *testing.T) {
+	database, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer database.Close()
+	repo := NewPostgresRepo(database)
+	ctx := context.Background()
+
+	mock.ExpectExec("INSERT INTO invalid_views \\(video_id, reason, views\\) VALUES \\(\\$1, \\$2, 1\\) ON CONFLICT").
+		WithArgs("video1", "crawler").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, repo.RecordInvalid(ctx, "video1", "crawler"))
+
+	mock.ExpectQuery("SELECT reason, views FROM invalid_views WHERE video_id = \\$1").
+		WithArgs("video1").
+		WillReturnRows(sqlmock.NewRows([]string{"reason", "views"}).AddRow("crawler", 3).AddRow("frequency", 1))
+	counts, err := repo.InvalidViews(ctx, "video1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"crawler": 3, "frequency": 1}, counts)
+
+	before := time.Now()
+	mock.ExpectExec("DELETE FROM quarantined_views WHERE viewed_at < \\$1").
+		WithArgs(before).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	deleted, err := repo.DeleteQuarantinedBefore(ctx, before)
+	require.NoError(t, err)
+	assert.Equal(t, 4, deleted)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
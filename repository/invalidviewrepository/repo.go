@@ -0,0 +1,26 @@
+// Package invalidviewrepository counts views that failed qualification, by
+// video and reason, and keeps quarantined ones for review.
+package invalidviewrepository
+
+import (
+	"context"
+	"time"
+	"view_count/model"
+)
+
+type Repository interface {
+	// RecordInvalid counts one invalid view of videoId for reason.
+	RecordInvalid(ctx context.Context, videoId, reason string) error
+
+	// InvalidViews returns the invalid views of videoId by reason.
+	InvalidViews(ctx context.Context, videoId string) (map[string]int, error)
+
+	Quarantine(ctx context.Context, v model.QuarantinedView) error
+
+	// ListQuarantined returns the n most recently quarantined views.
+	ListQuarantined(ctx context.Context, n int) ([]model.QuarantinedView, error)
+
+	// DeleteQuarantinedBefore removes the views quarantined before t and
+	// returns how many there were.
+	DeleteQuarantinedBefore(ctx context.Context, t time.Time) (deleted int, err error)
+}
@@ -2,6 +2,7 @@ package viewrepository
 
 import (
 	"container/heap"
+	"container/list"
 	"context"
 	"sync"
 	"time"
@@ -19,6 +20,23 @@ type inmemoryRepo struct {
 	// TODO: create 2 heap. one for count, one for time : DONE
 	viewHeap VideoViewHeap
 	timeHeap VideoTimeHeap
+	// ranks orders every viewed video for GetRank.
+	ranks *rankList
+
+	// idempotency keys in least recently used order, at most
+	// maxIdempotencyKeys of them.
+	keys     map[string]*list.Element
+	keyOrder *list.List
+}
+
+// maxIdempotencyKeys bounds the idempotency keys kept in memory. Beyond it
+// the least recently used are forgotten before their TTL.
+const maxIdempotencyKeys = 100000
+
+type idempotencyKey struct {
+	key     string
+	videoId string
+	expires time.Time
 }
 
 type videoData struct {
@@ -32,6 +50,9 @@ func NewInmemoryRepo() *inmemoryRepo {
 		data:     make(map[string]*videoData),
 		viewHeap: make(VideoViewHeap, 0),
 		timeHeap: make(VideoTimeHeap, 0),
+		ranks:    newRankList(),
+		keys:     make(map[string]*list.Element),
+		keyOrder: list.New(),
 	}
 }
 
@@ -73,6 +94,30 @@ func (repo *inmemoryRepo) GetView(ctx context.Context, videoId string) (view int
 	return video.Views, nil
 }
 
+func (repo *inmemoryRepo) GetViews(ctx context.Context, ids []string) (views map[string]int, err error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	views = make(map[string]int, len(ids))
+	for _, id := range ids {
+		views[id] = 0
+		if video, ok := repo.data[id]; ok {
+			views[id] = video.Views
+		}
+	}
+	return views, nil
+}
+
+func (repo *inmemoryRepo) GetRank(ctx context.Context, videoId string) (rank model.Rank, err error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	video, ok := repo.data[videoId]
+	if !ok {
+		return model.Rank{}, ErrVideoIdNotFound
+	}
+	position, ties := repo.ranks.rank(video.Views)
+	return model.Rank{Id: videoId, Views: video.Views, Position: position, Ties: ties}, nil
+}
+
 func (repo *inmemoryRepo) GetAllViews(ctx context.Context) (info []model.VideoInfo, err error) {
 	repo.mu.Lock()
 	defer repo.mu.Unlock()
@@ -92,14 +137,52 @@ func (repo *inmemoryRepo) GetAllViews(ctx context.Context) (info []model.VideoIn
 func (repo *inmemoryRepo) Increment(ctx context.Context, videoId string) error {
 	repo.mu.Lock()
 	defer repo.mu.Unlock()
+	return repo.incrementLocked(videoId)
+}
+
+func (repo *inmemoryRepo) IncrementOnce(ctx context.Context, videoId, key string, ttl time.Duration) (replayed bool, err error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	now := time.Now()
+	if e, ok := repo.keys[key]; ok {
+		k := e.Value.(*idempotencyKey)
+		if now.Before(k.expires) {
+			if k.videoId != videoId {
+				return false, ErrIdempotencyKeyReused
+			}
+			repo.keyOrder.MoveToFront(e)
+			return true, nil
+		}
+		repo.keyOrder.Remove(e)
+		delete(repo.keys, key)
+	}
+
+	if err := repo.incrementLocked(videoId); err != nil {
+		return false, err
+	}
+	repo.keys[key] = repo.keyOrder.PushFront(&idempotencyKey{key: key, videoId: videoId, expires: now.Add(ttl)})
+	if repo.keyOrder.Len() > maxIdempotencyKeys {
+		oldest := repo.keyOrder.Back()
+		repo.keyOrder.Remove(oldest)
+		delete(repo.keys, oldest.Value.(*idempotencyKey).key)
+	}
+	return false, nil
+}
+
+func (repo *inmemoryRepo) incrementLocked(videoId string) error {
 	video, exists := repo.data[videoId]
 	if !exists {
 		video = &videoData{Id: videoId, Views: 0}
 	}
 
+	if exists {
+		repo.ranks.remove(videoId, video.Views)
+	}
 	video.Views++
 	video.LastUpdated = time.Now()
 	repo.data[videoId] = video
+	repo.ranks.insert(videoId, video.Views)
 
 	// TODO use fix : done
 	if !exists {
@@ -169,3 +252,9 @@ func (repo *inmemoryRepo) GetRecentVideos(ctx context.Context, n int) ([]model.V
 	}
 	return recentVideos, nil
 }
+
+func (repo *inmemoryRepo) CountVideos(ctx context.Context) (int, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	return len(repo.data), nil
+}
@@ -2,8 +2,12 @@ package viewrepository
 
 import (
 	"context"
+	"fmt"
+	"math/rand/v2"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 	"view_count/model"
 )
 
@@ -61,6 +65,79 @@ func Test_IM_GetView(t *testing.T) {
 
 }
 
+func Test_IM_GetViews(t *testing.T) {
+	testRepo := NewInmemoryRepo()
+	for _, id := range []string{"video1", "video1", "video2"} {
+		testRepo.Increment(context.Background(), id)
+	}
+
+	result, err := testRepo.GetViews(context.Background(), []string{"video1", "video2", "video3"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]int{"video1": 2, "video2": 1, "video3": 0}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("Expected %v, but got %v", expected, result)
+	}
+
+	all, _ := testRepo.GetAllViews(context.Background())
+	if len(all) != 2 {
+		t.Errorf("Expected video3 not to be inserted, but got %+v", all)
+	}
+}
+
+func Test_IM_GetRank(t *testing.T) {
+	testRepo := NewInmemoryRepo()
+	for _, id := range []string{"video1", "video1", "video1", "video2", "video2", "video3", "video3", "video4"} {
+		testRepo.Increment(context.Background(), id)
+	}
+
+	tests := map[string]model.Rank{
+		"video1": {Id: "video1", Views: 3, Position: 1, Ties: 0},
+		"video2": {Id: "video2", Views: 2, Position: 2, Ties: 1},
+		"video3": {Id: "video3", Views: 2, Position: 2, Ties: 1},
+		"video4": {Id: "video4", Views: 1, Position: 4, Ties: 0},
+	}
+	for id, expected := range tests {
+		result, err := testRepo.GetRank(context.Background(), id)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result != expected {
+			t.Errorf("Expected %+v, but got %+v", expected, result)
+		}
+	}
+
+	if _, err := testRepo.GetRank(context.Background(), "video5"); err != ErrVideoIdNotFound {
+		t.Errorf("Expected %v, got %v", ErrVideoIdNotFound, err)
+	}
+
+	t.Run("Ranks agree with a count of all videos", func(t *testing.T) {
+		testRepo := NewInmemoryRepo()
+		rng := rand.New(rand.NewPCG(1, 2))
+		for i := 0; i < 2000; i++ {
+			testRepo.Increment(context.Background(), fmt.Sprintf("video%d", rng.IntN(100)))
+		}
+
+		all, _ := testRepo.GetAllViews(context.Background())
+		for _, video := range all {
+			expected := model.Rank{Id: video.Id, Views: video.Views, Position: 1, Ties: -1}
+			for _, other := range all {
+				if other.Views > video.Views {
+					expected.Position++
+				} else if other.Views == video.Views {
+					expected.Ties++
+				}
+			}
+			result, err := testRepo.GetRank(context.Background(), video.Id)
+			if err != nil || result != expected {
+				t.Fatalf("Expected %+v, but got %+v, %v", expected, result, err)
+			}
+		}
+	})
+}
+
 func Test_IM_GetAllViews(t *testing.T) {
 
 	tests := []testCase{
@@ -270,3 +347,55 @@ func Test_IM_GetRecentVideos(t *testing.T) {
 		})
 	}
 }
+
+func Test_IM_IncrementOnce(t *testing.T) {
+	ctx := context.Background()
+	testRepo := NewInmemoryRepo()
+
+	t.Run("Replays do not increment", func(t *testing.T) {
+		for i, wantReplayed := range []bool{false, true, true} {
+			replayed, err := testRepo.IncrementOnce(ctx, "video1", "key1", time.Hour)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if replayed != wantReplayed {
+				t.Fatalf("call %d: expected replayed %v, got %v", i, wantReplayed, replayed)
+			}
+		}
+		if views, _ := testRepo.GetView(ctx, "video1"); views != 1 {
+			t.Fatalf("Expected 1, got %v", views)
+		}
+	})
+
+	t.Run("Key reused for another video", func(t *testing.T) {
+		if _, err := testRepo.IncrementOnce(ctx, "video2", "key1", time.Hour); err != ErrIdempotencyKeyReused {
+			t.Fatalf("Expected %v, got %v", ErrIdempotencyKeyReused, err)
+		}
+	})
+
+	t.Run("Expired keys count again", func(t *testing.T) {
+		testRepo.IncrementOnce(ctx, "video3", "key2", time.Nanosecond)
+		time.Sleep(time.Millisecond)
+		if replayed, _ := testRepo.IncrementOnce(ctx, "video3", "key2", time.Hour); replayed {
+			t.Fatalf("Expected expired key to increment")
+		}
+		if views, _ := testRepo.GetView(ctx, "video3"); views != 2 {
+			t.Fatalf("Expected 2, got %v", views)
+		}
+	})
+
+	t.Run("Concurrent duplicates increment once", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				testRepo.IncrementOnce(ctx, "video4", "key3", time.Hour)
+			}()
+		}
+		wg.Wait()
+		if views, _ := testRepo.GetView(ctx, "video4"); views != 1 {
+			t.Fatalf("Expected 1, got %v", views)
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package viewrepository
+
+import (
+	"context"
+	"time"
+	"view_count/model"
+	"view_count/requestid"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+type instrumentedRepo struct {
+	latency       metrics.Histogram
+	errors        metrics.Counter
+	rows          metrics.Histogram
+	slowThreshold time.Duration
+	logger        log.Logger
+	Repository
+}
+
+// NewInstrumentedRepo wraps inner so that every call observes its latency
+// and the number of rows it returned, labelled by method, and counts
+// errors. Calls slower than slowThreshold are logged with their arguments.
+// Bind labels such as the backend name with With before passing metrics in.
+func NewInstrumentedRepo(inner Repository, latency metrics.Histogram, errors metrics.Counter, rows metrics.Histogram, slowThreshold time.Duration, logger log.Logger) Repository {
+	return &instrumentedRepo{
+		latency:       latency,
+		errors:        errors,
+		rows:          rows,
+		slowThreshold: slowThreshold,
+		logger:        logger,
+		Repository:    inner,
+	}
+}
+
+// observe records one call. args are logged as key/value pairs when the
+// call is slow.
+func (r *instrumentedRepo) observe(ctx context.Context, method string, begin time.Time, rows int, err error, args ...interface{}) {
+	took := time.Since(begin)
+	r.latency.With("method", method).Observe(took.Seconds())
+	r.rows.With("method", method).Observe(float64(rows))
+	if err != nil {
+		r.errors.With("method", method).Add(1)
+	}
+
+	if took < r.slowThreshold {
+		return
+	}
+	keyvals := []interface{}{
+		"msg", "slow repository call",
+		"method", method,
+		"took", took,
+		"threshold", r.slowThreshold,
+		"rows", rows,
+		"err", err,
+	}
+	if id := requestid.FromContext(ctx); id != "" {
+		keyvals = append(keyvals, "request_id", id)
+	}
+	level.Warn(r.logger).Log(append(keyvals, args...)...)
+}
+
+func (r *instrumentedRepo) GetAllViews(ctx context.Context) (info []model.VideoInfo, err error) {
+	defer func(begin time.Time) {
+		r.observe(ctx, "GetAllViews", begin, len(info), err)
+	}(time.Now())
+	return r.Repository.GetAllViews(ctx)
+}
+
+func (r *instrumentedRepo) Increment(ctx context.Context, videoId string) (err error) {
+	defer func(begin time.Time) {
+		r.observe(ctx, "Increment", begin, 1, err, "videoId", videoId)
+	}(time.Now())
+	return r.Repository.Increment(ctx, videoId)
+}
+
+func (r *instrumentedRepo) GetView(ctx context.Context, videoId string) (view int, err error) {
+	defer func(begin time.Time) {
+		r.observe(ctx, "GetView", begin, 1, err, "videoId", videoId)
+	}(time.Now())
+	return r.Repository.GetView(ctx, videoId)
+}
+
+func (r *instrumentedRepo) GetViews(ctx context.Context, ids []string) (views map[string]int, err error) {
+	defer func(begin time.Time) {
+		r.observe(ctx, "GetViews", begin, len(views), err, "ids", len(ids))
+	}(time.Now())
+	return r.Repository.GetViews(ctx, ids)
+}
+
+// GetRank does not count videos never viewed as errors.
+func (r *instrumentedRepo) GetRank(ctx context.Context, videoId string) (rank model.Rank, err error) {
+	defer func(begin time.Time) {
+		if err == ErrVideoIdNotFound {
+			r.observe(ctx, "GetRank", begin, 0, nil, "videoId", videoId)
+			return
+		}
+		r.observe(ctx, "GetRank", begin, 1, err, "videoId", videoId)
+	}(time.Now())
+	return r.Repository.GetRank(ctx, videoId)
+}
+
+func (r *instrumentedRepo) GetTopVideos(ctx context.Context, n int) (info []model.VideoInfo, err error) {
+	defer func(begin time.Time) {
+		r.observe(ctx, "GetTopVideos", begin, len(info), err, "n", n)
+	}(time.Now())
+	return r.Repository.GetTopVideos(ctx, n)
+}
+
+func (r *instrumentedRepo) GetRecentVideos(ctx context.Context, n int) (info []model.VideoInfo, err error) {
+	defer func(begin time.Time) {
+		r.observe(ctx, "GetRecentVideos", begin, len(info), err, "n", n)
+	}(time.Now())
+	return r.Repository.GetRecentVideos(ctx, n)
+}
+
+// CountVideos keeps the wrapped repository usable as a VideoCounter,
+// falling back to GetAllViews when it is not one.
+func (r *instrumentedRepo) CountVideos(ctx context.Context) (count int, err error) {
+	defer func(begin time.Time) {
+		r.observe(ctx, "CountVideos", begin, 1, err)
+	}(time.Now())
+	if c, ok := r.Repository.(VideoCounter); ok {
+		return c.CountVideos(ctx)
+	}
+	videos, err := r.Repository.GetAllViews(ctx)
+	return len(videos), err
+}
+
+// IncrementOnce keeps the wrapped repository usable as an
+// IdempotentIncrementer.
+func (r *instrumentedRepo) IncrementOnce(ctx context.Context, videoId, key string, ttl time.Duration) (replayed bool, err error) {
+	defer func(begin time.Time) {
+		r.observe(ctx, "IncrementOnce", begin, 1, err, "videoId", videoId)
+	}(time.Now())
+	if i, ok := r.Repository.(IdempotentIncrementer); ok {
+		return i.IncrementOnce(ctx, videoId, key, ttl)
+	}
+	return false, ErrIdempotencyUnsupported
+}
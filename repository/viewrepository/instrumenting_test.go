@@ -0,0 +1,87 @@
+package viewrepository
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/log"
+)
+
+// recordingHistogram records observations per label set.
+type recordingHistogram struct {
+	obs map[string][]float64
+	lvs []string
+}
+
+func (h *recordingHistogram) With(labelValues ...string) metrics.Histogram {
+	return &recordingHistogram{obs: h.obs, lvs: append(append([]string{}, h.lvs...), labelValues...)}
+}
+
+func (h *recordingHistogram) Observe(value float64) {
+	key := strings.Join(h.lvs, ",")
+	h.obs[key] = append(h.obs[key], value)
+}
+
+type recordingCounter struct {
+	totals map[string]float64
+	lvs    []string
+}
+
+func (c *recordingCounter) With(labelValues ...string) metrics.Counter {
+	return &recordingCounter{totals: c.totals, lvs: append(append([]string{}, c.lvs...), labelValues...)}
+}
+
+func (c *recordingCounter) Add(delta float64) {
+	c.totals[strings.Join(c.lvs, ",")] += delta
+}
+
+func Test_InstrumentedRepo(t *testing.T) {
+	latency := &recordingHistogram{obs: map[string][]float64{}}
+	rows := &recordingHistogram{obs: map[string][]float64{}}
+	errs := &recordingCounter{totals: map[string]float64{}}
+	var buf bytes.Buffer
+
+	repo := NewInstrumentedRepo(NewInmemoryRepo(), latency.With("backend", "inmemory"), errs, rows, time.Hour, log.NewLogfmtLogger(&buf))
+
+	repo.Increment(context.Background(), "video1")
+	repo.Increment(context.Background(), "video2")
+	if _, err := repo.GetTopVideos(context.Background(), 10); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got := len(latency.obs["backend,inmemory,method,Increment"]); got != 2 {
+		t.Errorf("Expected 2 Increment latency observations, got %v", got)
+	}
+	if got := rows.obs["method,GetTopVideos"]; len(got) != 1 || got[0] != 2 {
+		t.Errorf("Expected GetTopVideos to observe 2 rows, got %v", got)
+	}
+	if len(errs.totals) != 0 {
+		t.Errorf("Expected no errors, got %v", errs.totals)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected no slow query log, got %q", buf.String())
+	}
+
+	t.Run("Slow calls are logged with their arguments", func(t *testing.T) {
+		repo := NewInstrumentedRepo(NewInmemoryRepo(), latency, errs, rows, 0, log.NewLogfmtLogger(&buf))
+		repo.GetTopVideos(context.Background(), 5)
+
+		line := buf.String()
+		for _, want := range []string{"level=warn", `msg="slow repository call"`, "method=GetTopVideos", "n=5"} {
+			if !strings.Contains(line, want) {
+				t.Errorf("Expected %q in %q", want, line)
+			}
+		}
+	})
+
+	t.Run("Wrapped repository is still a VideoCounter", func(t *testing.T) {
+		count, err := repo.(VideoCounter).CountVideos(context.Background())
+		if err != nil || count != 2 {
+			t.Errorf("Expected 2 videos, got %v, %v", count, err)
+		}
+	})
+}
@@ -7,6 +7,7 @@ package viewrepository
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 	model "view_count/model"
 
 	gomock "github.com/golang/mock/gomock"
@@ -50,6 +51,21 @@ func (mr *MockRepositoryMockRecorder) GetAllViews(ctx interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllViews", reflect.TypeOf((*MockRepository)(nil).GetAllViews), ctx)
 }
 
+// GetRank mocks base method.
+func (m *MockRepository) GetRank(ctx context.Context, videoId string) (model.Rank, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRank", ctx, videoId)
+	ret0, _ := ret[0].(model.Rank)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRank indicates an expected call of GetRank.
+func (mr *MockRepositoryMockRecorder) GetRank(ctx, videoId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRank", reflect.TypeOf((*MockRepository)(nil).GetRank), ctx, videoId)
+}
+
 // GetRecentVideos mocks base method.
 func (m *MockRepository) GetRecentVideos(ctx context.Context, n int) ([]model.VideoInfo, error) {
 	m.ctrl.T.Helper()
@@ -95,6 +111,21 @@ func (mr *MockRepositoryMockRecorder) GetView(ctx, videoId interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetView", reflect.TypeOf((*MockRepository)(nil).GetView), ctx, videoId)
 }
 
+// GetViews mocks base method.
+func (m *MockRepository) GetViews(ctx context.Context, ids []string) (map[string]int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetViews", ctx, ids)
+	ret0, _ := ret[0].(map[string]int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetViews indicates an expected call of GetViews.
+func (mr *MockRepositoryMockRecorder) GetViews(ctx, ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetViews", reflect.TypeOf((*MockRepository)(nil).GetViews), ctx, ids)
+}
+
 // Increment mocks base method.
 func (m *MockRepository) Increment(ctx context.Context, videoId string) error {
 	m.ctrl.T.Helper()
@@ -108,3 +139,154 @@ func (mr *MockRepositoryMockRecorder) Increment(ctx, videoId interface{}) *gomoc
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Increment", reflect.TypeOf((*MockRepository)(nil).Increment), ctx, videoId)
 }
+
+// MockPinger is a mock of Pinger interface.
+type MockPinger struct {
+	ctrl     *gomock.Controller
+	recorder *MockPingerMockRecorder
+}
+
+// MockPingerMockRecorder is the mock recorder for MockPinger.
+type MockPingerMockRecorder struct {
+	mock *MockPinger
+}
+
+// NewMockPinger creates a new mock instance.
+func NewMockPinger(ctrl *gomock.Controller) *MockPinger {
+	mock := &MockPinger{ctrl: ctrl}
+	mock.recorder = &MockPingerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPinger) EXPECT() *MockPingerMockRecorder {
+	return m.recorder
+}
+
+// PingContext mocks base method.
+func (m *MockPinger) PingContext(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PingContext", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PingContext indicates an expected call of PingContext.
+func (mr *MockPingerMockRecorder) PingContext(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PingContext", reflect.TypeOf((*MockPinger)(nil).PingContext), ctx)
+}
+
+// MockVideoCounter is a mock of VideoCounter interface.
+type MockVideoCounter struct {
+	ctrl     *gomock.Controller
+	recorder *MockVideoCounterMockRecorder
+}
+
+// MockVideoCounterMockRecorder is the mock recorder for MockVideoCounter.
+type MockVideoCounterMockRecorder struct {
+	mock *MockVideoCounter
+}
+
+// NewMockVideoCounter creates a new mock instance.
+func NewMockVideoCounter(ctrl *gomock.Controller) *MockVideoCounter {
+	mock := &MockVideoCounter{ctrl: ctrl}
+	mock.recorder = &MockVideoCounterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockVideoCounter) EXPECT() *MockVideoCounterMockRecorder {
+	return m.recorder
+}
+
+// CountVideos mocks base method.
+func (m *MockVideoCounter) CountVideos(ctx context.Context) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountVideos", ctx)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountVideos indicates an expected call of CountVideos.
+func (mr *MockVideoCounterMockRecorder) CountVideos(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountVideos", reflect.TypeOf((*MockVideoCounter)(nil).CountVideos), ctx)
+}
+
+// MockIdempotentIncrementer is a mock of IdempotentIncrementer interface.
+type MockIdempotentIncrementer struct {
+	ctrl     *gomock.Controller
+	recorder *MockIdempotentIncrementerMockRecorder
+}
+
+// MockIdempotentIncrementerMockRecorder is the mock recorder for MockIdempotentIncrementer.
+type MockIdempotentIncrementerMockRecorder struct {
+	mock *MockIdempotentIncrementer
+}
+
+// NewMockIdempotentIncrementer creates a new mock instance.
+func NewMockIdempotentIncrementer(ctrl *gomock.Controller) *MockIdempotentIncrementer {
+	mock := &MockIdempotentIncrementer{ctrl: ctrl}
+	mock.recorder = &MockIdempotentIncrementerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIdempotentIncrementer) EXPECT() *MockIdempotentIncrementerMockRecorder {
+	return m.recorder
+}
+
+// IncrementOnce mocks base method.
+func (m *MockIdempotentIncrementer) IncrementOnce(ctx context.Context, videoId, key string, ttl time.Duration) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementOnce", ctx, videoId, key, ttl)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IncrementOnce indicates an expected call of IncrementOnce.
+func (mr *MockIdempotentIncrementerMockRecorder) IncrementOnce(ctx, videoId, key, ttl interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementOnce", reflect.TypeOf((*MockIdempotentIncrementer)(nil).IncrementOnce), ctx, videoId, key, ttl)
+}
+
+// MockIdempotencyKeyExpirer is a mock of IdempotencyKeyExpirer interface.
+type MockIdempotencyKeyExpirer struct {
+	ctrl     *gomock.Controller
+	recorder *MockIdempotencyKeyExpirerMockRecorder
+}
+
+// MockIdempotencyKeyExpirerMockRecorder is the mock recorder for MockIdempotencyKeyExpirer.
+type MockIdempotencyKeyExpirerMockRecorder struct {
+	mock *MockIdempotencyKeyExpirer
+}
+
+// NewMockIdempotencyKeyExpirer creates a new mock instance.
+func NewMockIdempotencyKeyExpirer(ctrl *gomock.Controller) *MockIdempotencyKeyExpirer {
+	mock := &MockIdempotencyKeyExpirer{ctrl: ctrl}
+	mock.recorder = &MockIdempotencyKeyExpirerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIdempotencyKeyExpirer) EXPECT() *MockIdempotencyKeyExpirerMockRecorder {
+	return m.recorder
+}
+
+// ExpireIdempotencyKeys mocks base method.
+func (m *MockIdempotencyKeyExpirer) ExpireIdempotencyKeys(ctx context.Context) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExpireIdempotencyKeys", ctx)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExpireIdempotencyKeys indicates an expected call of ExpireIdempotencyKeys.
+func (mr *MockIdempotencyKeyExpirerMockRecorder) ExpireIdempotencyKeys(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpireIdempotencyKeys", reflect.TypeOf((*MockIdempotencyKeyExpirer)(nil).ExpireIdempotencyKeys), ctx)
+}
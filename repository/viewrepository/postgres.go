@@ -3,24 +3,78 @@ package viewrepository
 import (
 	"context"
 	"database/sql"
+	"time"
 	"view_count/model"
+	"view_count/requestid"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("view_count/repository/viewrepository")
+
 type postgresRepo struct {
 	*sql.DB
 }
 
+var (
+	// postgresRepo is a Pinger through the embedded DB.PingContext.
+	_ Pinger       = (*postgresRepo)(nil)
+	_ VideoCounter = (*postgresRepo)(nil)
+
+	_ IdempotentIncrementer = (*postgresRepo)(nil)
+	_ IdempotencyKeyExpirer = (*postgresRepo)(nil)
+)
+
 func NewPostgresRepo(db *sql.DB) *postgresRepo {
 	return &postgresRepo{
 		DB: db,
 	}
 }
 
+// annotate prefixes query with a SQL comment carrying the request ID of
+// ctx, so statements seen in Postgres logs and pg_stat_activity can be tied
+// back to the request that issued them.
+func annotate(ctx context.Context, query string) string {
+	id := requestid.FromContext(ctx)
+	if !requestid.Valid(id) {
+		return query
+	}
+	return "/* request_id=" + id + " */ " + query
+}
+
+// startStatement starts a client span for one SQL statement.
+func startStatement(ctx context.Context, operation, query string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "postgres "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationName(operation),
+			semconv.DBQueryText(query),
+		),
+	)
+}
+
+// endStatement records the number of rows the statement returned or
+// affected and its error on span, then ends it.
+func endStatement(span trace.Span, rows int, err error) {
+	span.SetAttributes(attribute.Int("db.rows", rows))
+	if err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
 // TODO: write docker integration test cases. @Abhishek Gupta/Abhishek AK
 
 func (db *postgresRepo) GetView(ctx context.Context, videoId string) (view int, err error) {
 	// TODO impl : done
-	tx, err := db.Begin()
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, err
 	}
@@ -31,11 +85,21 @@ func (db *postgresRepo) GetView(ctx context.Context, videoId string) (view int,
 		}
 	}()
 
-	row := tx.QueryRow("SELECT views FROM videos WHERE id = $1", videoId)
+	const selectQuery = "SELECT views FROM videos WHERE id = $1"
+	sctx, span := startStatement(ctx, "SELECT", selectQuery)
+	row := tx.QueryRowContext(sctx, annotate(ctx, selectQuery), videoId)
 	err = row.Scan(&view)
+	if err == sql.ErrNoRows {
+		endStatement(span, 0, err)
+	} else {
+		endStatement(span, 1, err)
+	}
 
 	if err == sql.ErrNoRows {
-		_, err := tx.Exec("INSERT INTO videos (id, views) VALUES ($1, 0)", videoId)
+		const insertQuery = "INSERT INTO videos (id, views) VALUES ($1, 0)"
+		ictx, span := startStatement(ctx, "INSERT", insertQuery)
+		_, err := tx.ExecContext(ictx, annotate(ctx, insertQuery), videoId)
+		endStatement(span, 1, err)
 		if err != nil {
 			return 0, err
 		}
@@ -47,8 +111,44 @@ func (db *postgresRepo) GetView(ctx context.Context, videoId string) (view int,
 	return view, tx.Commit()
 }
 
+// GetViews does not insert the videos it does not find, unlike GetView.
+func (db *postgresRepo) GetViews(ctx context.Context, ids []string) (views map[string]int, err error) {
+	const query = "SELECT id, views FROM videos WHERE id = ANY($1)"
+	ctx, span := startStatement(ctx, "SELECT", query)
+	found := 0
+	defer func() { endStatement(span, found, err) }()
+
+	rows, err := db.QueryContext(ctx, annotate(ctx, query), pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	views = make(map[string]int, len(ids))
+	for _, id := range ids {
+		views[id] = 0
+	}
+	for rows.Next() {
+		var id string
+		var n int
+		if err = rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		views[id] = n
+		found++
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return views, nil
+}
+
 func (db *postgresRepo) GetAllViews(ctx context.Context) (info []model.VideoInfo, err error) {
-	rows, err := db.Query("SELECT id, views FROM videos")
+	const query = "SELECT id, views FROM videos"
+	ctx, span := startStatement(ctx, "SELECT", query)
+	defer func() { endStatement(span, len(info), err) }()
+
+	rows, err := db.QueryContext(ctx, annotate(ctx, query))
 	if err != nil {
 		return nil, err
 	}
@@ -67,13 +167,86 @@ func (db *postgresRepo) GetAllViews(ctx context.Context) (info []model.VideoInfo
 	return info, nil
 }
 
+const incrementQuery = `INSERT INTO videos (id, views, last_updated) VALUES ($1, 1, NOW()) ON CONFLICT (id) DO UPDATE SET views = videos.views + 1, last_updated = NOW()`
+
 func (db *postgresRepo) Increment(ctx context.Context, videoId string) (err error) {
-	_, err = db.Exec(`INSERT INTO videos (id, views, last_updated) VALUES ($1, 1, NOW()) ON CONFLICT (id) DO UPDATE SET views = videos.views + 1, last_updated = NOW()`, videoId)
+	ctx, span := startStatement(ctx, "INSERT", incrementQuery)
+	defer func() { endStatement(span, 1, err) }()
+
+	_, err = db.ExecContext(ctx, annotate(ctx, incrementQuery), videoId)
 	return err
 }
 
+// IncrementOnce claims key and increments in one transaction. A concurrent
+// call with the same key blocks on the key's primary key until this one
+// commits, then finds the key taken.
+func (db *postgresRepo) IncrementOnce(ctx context.Context, videoId, key string, ttl time.Duration) (replayed bool, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil || replayed {
+			tx.Rollback()
+		}
+	}()
+
+	// an expired key is taken over as if it were new.
+	const claimQuery = `INSERT INTO idempotency_keys (key, video_id, expires_at) VALUES ($1, $2, NOW() + $3::float8 * INTERVAL '1 millisecond') ON CONFLICT (key) DO UPDATE SET video_id = EXCLUDED.video_id, expires_at = EXCLUDED.expires_at WHERE idempotency_keys.expires_at <= NOW()`
+	cctx, span := startStatement(ctx, "INSERT", claimQuery)
+	res, err := tx.ExecContext(cctx, annotate(ctx, claimQuery), key, videoId, ttl.Milliseconds())
+	var claimed int64
+	if err == nil {
+		claimed, err = res.RowsAffected()
+	}
+	endStatement(span, int(claimed), err)
+	if err != nil {
+		return false, err
+	}
+
+	if claimed == 0 {
+		const selectQuery = "SELECT video_id FROM idempotency_keys WHERE key = $1"
+		sctx, span := startStatement(ctx, "SELECT", selectQuery)
+		var claimedFor string
+		err = tx.QueryRowContext(sctx, annotate(ctx, selectQuery), key).Scan(&claimedFor)
+		endStatement(span, 1, err)
+		if err != nil {
+			return false, err
+		}
+		if claimedFor != videoId {
+			return false, ErrIdempotencyKeyReused
+		}
+		return true, nil
+	}
+
+	ictx, span := startStatement(ctx, "INSERT", incrementQuery)
+	_, err = tx.ExecContext(ictx, annotate(ctx, incrementQuery), videoId)
+	endStatement(span, 1, err)
+	if err != nil {
+		return false, err
+	}
+	return false, tx.Commit()
+}
+
+func (db *postgresRepo) ExpireIdempotencyKeys(ctx context.Context) (deleted int, err error) {
+	const query = "DELETE FROM idempotency_keys WHERE expires_at <= NOW()"
+	ctx, span := startStatement(ctx, "DELETE", query)
+	defer func() { endStatement(span, deleted, err) }()
+
+	res, err := db.ExecContext(ctx, annotate(ctx, query))
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
 func (db *postgresRepo) GetTopVideos(ctx context.Context, n int) (info []model.VideoInfo, err error) {
-	rows, err := db.Query("SELECT id, views FROM videos ORDER BY views DESC LIMIT $1", n)
+	const query = "SELECT id, views FROM videos ORDER BY views DESC LIMIT $1"
+	ctx, span := startStatement(ctx, "SELECT", query)
+	defer func() { endStatement(span, len(info), err) }()
+
+	rows, err := db.QueryContext(ctx, annotate(ctx, query), n)
 	if err != nil {
 		return nil, err
 	}
@@ -93,7 +266,11 @@ func (db *postgresRepo) GetTopVideos(ctx context.Context, n int) (info []model.V
 }
 
 func (db *postgresRepo) GetRecentVideos(ctx context.Context, n int) (info []model.VideoInfo, err error) {
-	rows, err := db.Query("SELECT id, views FROM videos ORDER BY last_updated DESC LIMIT $1", n)
+	const query = "SELECT id, views FROM videos ORDER BY last_updated DESC LIMIT $1"
+	ctx, span := startStatement(ctx, "SELECT", query)
+	defer func() { endStatement(span, len(info), err) }()
+
+	rows, err := db.QueryContext(ctx, annotate(ctx, query), n)
 	if err != nil {
 		return nil, err
 	}
@@ -101,10 +278,43 @@ func (db *postgresRepo) GetRecentVideos(ctx context.Context, n int) (info []mode
 
 	for rows.Next() {
 		var video model.VideoInfo
-		if err := rows.Scan(&video.Id, &video.Views); err != nil {
+		if err = rows.Scan(&video.Id, &video.Views); err != nil {
 			return nil, err
 		}
 		info = append(info, video)
 	}
 	return info, nil
 }
+
+// GetRank counts the videos with more and with the same views using the
+// index on views. Videos GetView inserted with 0 views are not ranked.
+func (db *postgresRepo) GetRank(ctx context.Context, videoId string) (rank model.Rank, err error) {
+	const query = `SELECT v.views,
+		(SELECT COUNT(*) FROM videos WHERE views > v.views),
+		(SELECT COUNT(*) FROM videos WHERE views = v.views)
+		FROM videos v WHERE v.id = $1 AND v.views > 0`
+	sctx, span := startStatement(ctx, "SELECT", query)
+	var more, same int
+	err = db.QueryRowContext(sctx, annotate(ctx, query), videoId).Scan(&rank.Views, &more, &same)
+	if err == sql.ErrNoRows {
+		endStatement(span, 0, err)
+		return model.Rank{}, ErrVideoIdNotFound
+	}
+	endStatement(span, 1, err)
+	if err != nil {
+		return model.Rank{}, err
+	}
+	rank.Id = videoId
+	rank.Position = more + 1
+	rank.Ties = same - 1
+	return rank, nil
+}
+
+func (db *postgresRepo) CountVideos(ctx context.Context) (count int, err error) {
+	const query = "SELECT COUNT(*) FROM videos"
+	ctx, span := startStatement(ctx, "SELECT", query)
+	defer func() { endStatement(span, 1, err) }()
+
+	err = db.QueryRowContext(ctx, annotate(ctx, query)).Scan(&count)
+	return count, err
+}
@@ -146,6 +146,54 @@ func Test_DB_GetView(t *testing.T) {
 
 }
 
+func Test_DB_GetViews(t *testing.T) {
+	testRepo := NewPostgresRepo(testSqlDB)
+	for _, id := range []string{"video1", "video1", "video2"} {
+		testRepo.Increment(context.Background(), id)
+	}
+
+	result, err := testRepo.GetViews(context.Background(), []string{"video1", "video2", "video3"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]int{"video1": 2, "video2": 1, "video3": 0}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("Expected %v, but got %v", expected, result)
+	}
+
+	if err := cleanupDB(testSqlDB); err != nil {
+		t.Fatalf("Error cleaning up database: %v", err)
+	}
+}
+
+func Test_DB_GetRank(t *testing.T) {
+	testRepo := NewPostgresRepo(testSqlDB)
+	for _, id := range []string{"video1", "video1", "video2", "video2", "video3"} {
+		testRepo.Increment(context.Background(), id)
+	}
+	if _, err := testSqlDB.Exec("INSERT INTO videos (id, views, last_updated) VALUES ('video4', 0, NOW())"); err != nil {
+		t.Fatalf("Error inserting video4: %v", err)
+	}
+
+	result, err := testRepo.GetRank(context.Background(), "video2")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := model.Rank{Id: "video2", Views: 2, Position: 1, Ties: 1}
+	if result != expected {
+		t.Errorf("Expected %+v, but got %+v", expected, result)
+	}
+
+	if _, err := testRepo.GetRank(context.Background(), "video4"); err != ErrVideoIdNotFound {
+		t.Errorf("Expected %v for a video with 0 views, got %v", ErrVideoIdNotFound, err)
+	}
+
+	if err := cleanupDB(testSqlDB); err != nil {
+		t.Fatalf("Error cleaning up database: %v", err)
+	}
+}
+
 func Test_DB_GetAllViews(t *testing.T) {
 
 	tests := []testCase{
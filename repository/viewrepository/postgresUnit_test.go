@@ -6,9 +6,12 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 	"view_count/model"
+	"view_count/requestid"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 )
 
 func Test_db_GetView(t *testing.T) {
@@ -215,6 +218,105 @@ func Test_db_GetAllViews(t *testing.T) {
 	})
 }
 
+func Test_db_GetViews(t *testing.T) {
+	database, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to connect to the database: %v", err)
+	}
+
+	testRepo := NewPostgresRepo(database)
+
+	defer database.Close()
+
+	ids := []string{"video1", "video2", "video3"}
+
+	t.Run("Get Views", func(t *testing.T) {
+		mock.ExpectQuery("SELECT id, views FROM videos WHERE id = ANY\\(\\$1\\)").
+			WithArgs(pq.Array(ids)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "views"}).AddRow("video1", 2).AddRow("video2", 3))
+
+		result, err := testRepo.GetViews(context.Background(), ids)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expectedResult := map[string]int{"video1": 2, "video2": 3, "video3": 0}
+		if !reflect.DeepEqual(result, expectedResult) {
+			t.Errorf("Expected %+v, but got %+v", expectedResult, result)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unmet expectations : %v", err)
+		}
+	})
+
+	t.Run("Query throws an error", func(t *testing.T) {
+		mock.ExpectQuery("SELECT id, views FROM videos WHERE id = ANY\\(\\$1\\)").
+			WillReturnError(fmt.Errorf("Custom Error"))
+
+		result, err := testRepo.GetViews(context.Background(), ids)
+		if err == nil {
+			t.Fatal("Expected error, but got none")
+		}
+
+		if result != nil {
+			t.Fatalf("Expected nil, but got %+v", result)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unmet expectations : %v", err)
+		}
+	})
+}
+
+func Test_db_GetRank(t *testing.T) {
+	database, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to connect to the database: %v", err)
+	}
+
+	testRepo := NewPostgresRepo(database)
+
+	defer database.Close()
+
+	const query = "SELECT v.views, .+ FROM videos v WHERE v.id = \\$1 AND v.views > 0"
+
+	t.Run("Get Rank", func(t *testing.T) {
+		mock.ExpectQuery(query).
+			WithArgs("video1").
+			WillReturnRows(sqlmock.NewRows([]string{"views", "more", "same"}).AddRow(5, 3, 2))
+
+		result, err := testRepo.GetRank(context.Background(), "video1")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expectedResult := model.Rank{Id: "video1", Views: 5, Position: 4, Ties: 1}
+		if result != expectedResult {
+			t.Errorf("Expected %+v, but got %+v", expectedResult, result)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unmet expectations : %v", err)
+		}
+	})
+
+	t.Run("Video never viewed", func(t *testing.T) {
+		mock.ExpectQuery(query).
+			WithArgs("video2").
+			WillReturnError(sql.ErrNoRows)
+
+		_, err := testRepo.GetRank(context.Background(), "video2")
+		if err != ErrVideoIdNotFound {
+			t.Fatalf("Expected %v, got %v", ErrVideoIdNotFound, err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unmet expectations : %v", err)
+		}
+	})
+}
+
 func Test_db_Increment(t *testing.T) {
 	database, mock, err := sqlmock.New()
 	if err != nil {
@@ -241,6 +343,30 @@ func Test_db_Increment(t *testing.T) {
 	}
 }
 
+func Test_db_RequestIDComment(t *testing.T) {
+	database, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to connect to the databse: %v", err)
+	}
+
+	testRepo := NewPostgresRepo(database)
+
+	defer database.Close()
+
+	mock.ExpectExec(`^/\* request_id=req-1 \*/ INSERT INTO videos`).
+		WithArgs("video1").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	ctx := requestid.NewContext(context.Background(), "req-1")
+	if err := testRepo.Increment(ctx, "video1"); err != nil {
+		t.Fatalf("Unexpected error while incrementing: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unmet expectations : %v", err)
+	}
+}
+
 func Test_db_GetTopVideos(t *testing.T) {
 	database, mock, err := sqlmock.New()
 	if err != nil {
@@ -408,3 +534,63 @@ func Test_db_GetRecentVideos(t *testing.T) {
 		}
 	})
 }
+
+func Test_db_IncrementOnce(t *testing.T) {
+	database, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to connect to the database: %v", err)
+	}
+	defer database.Close()
+	testRepo := NewPostgresRepo(database)
+
+	const (
+		claimQuery     = "INSERT INTO idempotency_keys \\(key, video_id, expires_at\\) VALUES .* ON CONFLICT \\(key\\) DO UPDATE .* WHERE idempotency_keys.expires_at <= NOW\\(\\)"
+		selectQuery    = "SELECT video_id FROM idempotency_keys WHERE key = \\$1"
+		incrementQuery = "INSERT INTO videos \\(id, views, last_updated\\) VALUES"
+	)
+
+	t.Run("New key increments", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(claimQuery).WithArgs("key1", "video1", int64(3600000)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(incrementQuery).WithArgs("video1").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		replayed, err := testRepo.IncrementOnce(context.Background(), "video1", "key1", time.Hour)
+		if err != nil || replayed {
+			t.Fatalf("Expected a fresh increment, got replayed %v, err %v", replayed, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unmet expectations: %v", err)
+		}
+	})
+
+	t.Run("Known key replays", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(claimQuery).WithArgs("key1", "video1", int64(3600000)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(selectQuery).WithArgs("key1").WillReturnRows(sqlmock.NewRows([]string{"video_id"}).AddRow("video1"))
+		mock.ExpectRollback()
+
+		replayed, err := testRepo.IncrementOnce(context.Background(), "video1", "key1", time.Hour)
+		if err != nil || !replayed {
+			t.Fatalf("Expected a replay, got replayed %v, err %v", replayed, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unmet expectations: %v", err)
+		}
+	})
+
+	t.Run("Key reused for another video", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(claimQuery).WithArgs("key1", "video2", int64(3600000)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(selectQuery).WithArgs("key1").WillReturnRows(sqlmock.NewRows([]string{"video_id"}).AddRow("video1"))
+		mock.ExpectRollback()
+
+		_, err := testRepo.IncrementOnce(context.Background(), "video2", "key1", time.Hour)
+		if err != ErrIdempotencyKeyReused {
+			t.Fatalf("Expected %v, got %v", ErrIdempotencyKeyReused, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unmet expectations: %v", err)
+		}
+	})
+}
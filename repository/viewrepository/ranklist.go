@@ -0,0 +1,132 @@
+package viewrepository
+
+import "math/rand/v2"
+
+// rankList is an indexable skip list of videos ordered by views, most
+// first, and then by id. Every link knows how many videos it skips, so
+// counting the videos before a position takes O(log n) expected time
+// instead of a walk of the whole leaderboard.
+type rankList struct {
+	head  *rankNode
+	level int
+	len   int
+}
+
+type rankNode struct {
+	id    string
+	views int
+	next  []rankLink
+}
+
+type rankLink struct {
+	node *rankNode
+	// span is the number of videos the link moves past, node included.
+	// Links to the end span to the end of the list.
+	span int
+}
+
+const rankListMaxLevel = 32
+
+func newRankList() *rankList {
+	return &rankList{head: &rankNode{next: make([]rankLink, rankListMaxLevel)}, level: 1}
+}
+
+// rankBefore reports whether a video with views and id is ordered before
+// one with otherViews and otherId.
+func rankBefore(views int, id string, otherViews int, otherId string) bool {
+	return views > otherViews || views == otherViews && id < otherId
+}
+
+func randomRankLevel() int {
+	level := 1
+	for level < rankListMaxLevel && rand.IntN(4) == 0 {
+		level++
+	}
+	return level
+}
+
+// insert adds a video, which must not be in the list yet.
+func (l *rankList) insert(id string, views int) {
+	var update [rankListMaxLevel]*rankNode
+	var passed [rankListMaxLevel]int
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		if i < l.level-1 {
+			passed[i] = passed[i+1]
+		}
+		for next := x.next[i].node; next != nil && rankBefore(next.views, next.id, views, id); next = x.next[i].node {
+			passed[i] += x.next[i].span
+			x = next
+		}
+		update[i] = x
+	}
+
+	level := randomRankLevel()
+	for i := l.level; i < level; i++ {
+		update[i] = l.head
+		l.head.next[i].span = l.len
+	}
+	l.level = max(l.level, level)
+
+	n := &rankNode{id: id, views: views, next: make([]rankLink, level)}
+	for i := 0; i < level; i++ {
+		n.next[i] = rankLink{update[i].next[i].node, update[i].next[i].span - (passed[0] - passed[i])}
+		update[i].next[i] = rankLink{n, passed[0] - passed[i] + 1}
+	}
+	for i := level; i < l.level; i++ {
+		update[i].next[i].span++
+	}
+	l.len++
+}
+
+// remove deletes a video with the views it was inserted with, if the list
+// has it.
+func (l *rankList) remove(id string, views int) {
+	var update [rankListMaxLevel]*rankNode
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for next := x.next[i].node; next != nil && rankBefore(next.views, next.id, views, id); next = x.next[i].node {
+			x = next
+		}
+		update[i] = x
+	}
+	n := x.next[0].node
+	if n == nil || n.id != id {
+		return
+	}
+
+	for i := 0; i < l.level; i++ {
+		if update[i].next[i].node == n {
+			update[i].next[i] = rankLink{n.next[i].node, update[i].next[i].span + n.next[i].span - 1}
+		} else {
+			update[i].next[i].span--
+		}
+	}
+	for l.level > 1 && l.head.next[l.level-1].node == nil {
+		l.level--
+	}
+	l.len--
+}
+
+// countBefore returns the number of videos ordered before one with views
+// and id, whether or not the list has it.
+func (l *rankList) countBefore(views int, id string) int {
+	count := 0
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for next := x.next[i].node; next != nil && rankBefore(next.views, next.id, views, id); next = x.next[i].node {
+			count += x.next[i].span
+			x = next
+		}
+	}
+	return count
+}
+
+// rank returns the position and ties of a video with views; ids are never
+// empty, so the videos before ("", views) are exactly those with more
+// views.
+func (l *rankList) rank(views int) (position, ties int) {
+	more := l.countBefore(views, "")
+	same := l.countBefore(views-1, "") - more
+	return more + 1, same - 1
+}
@@ -3,11 +3,18 @@ package viewrepository
 import (
 	"context"
 	"errors"
+	"time"
 	"view_count/model"
 )
 
 var (
 	ErrVideoIdNotFound = errors.New("video id not found")
+	// ErrIdempotencyKeyReused is returned when an idempotency key is sent
+	// again for a different video.
+	ErrIdempotencyKeyReused = errors.New("idempotency key reused for another video")
+	// ErrIdempotencyUnsupported is returned for idempotent increments on a
+	// repository that cannot remember keys.
+	ErrIdempotencyUnsupported = errors.New("repository does not support idempotency keys")
 )
 
 type Repository interface {
@@ -18,8 +25,43 @@ type Repository interface {
 	// TODO: write expectation of result
 	GetView(ctx context.Context, videoId string) (view int, err error)
 
+	// GetViews returns the views of every video in ids in one call, with
+	// 0 for videos never viewed.
+	GetViews(ctx context.Context, ids []string) (views map[string]int, err error)
+
 	GetTopVideos(ctx context.Context, n int) (info []model.VideoInfo, err error) // add n as param : Done
 
+	// GetRank returns the place of videoId in the all-time leaderboard,
+	// or ErrVideoIdNotFound if it was never viewed.
+	GetRank(ctx context.Context, videoId string) (rank model.Rank, err error)
+
 	GetRecentVideos(ctx context.Context, n int) (info []model.VideoInfo, err error) // n as param : Done
 }
 
+// Pinger is implemented by repositories backed by an external store that
+// can report whether the store is reachable.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// VideoCounter is implemented by repositories that can count distinct
+// videos without loading all of them.
+type VideoCounter interface {
+	CountVideos(ctx context.Context) (int, error)
+}
+
+// IdempotentIncrementer is implemented by repositories that can remember
+// idempotency keys.
+type IdempotentIncrementer interface {
+	// IncrementOnce increments videoId unless key was already used within
+	// ttl, in which case it reports replayed and changes nothing. Recording
+	// the key and incrementing happen atomically, so of several concurrent
+	// calls with one key exactly one increments.
+	IncrementOnce(ctx context.Context, videoId, key string, ttl time.Duration) (replayed bool, err error)
+}
+
+// IdempotencyKeyExpirer is implemented by repositories whose expired
+// idempotency keys must be deleted explicitly.
+type IdempotencyKeyExpirer interface {
+	ExpireIdempotencyKeys(ctx context.Context) (deleted int, err error)
+}
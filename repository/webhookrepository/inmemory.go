@@ -0,0 +1,151 @@
+package webhookrepository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+	"view_count/model"
+)
+
+type milestone struct {
+	webhookId string
+	videoId   string
+	threshold int
+}
+
+type inmemoryRepo struct {
+	mu          sync.Mutex
+	webhooks    map[string]model.Webhook
+	fired       map[milestone]struct{}
+	deadLetters []model.DeadLetter
+}
+
+func NewInmemoryRepo() *inmemoryRepo {
+	return &inmemoryRepo{
+		webhooks: make(map[string]model.Webhook),
+		fired:    make(map[milestone]struct{}),
+	}
+}
+
+func (r *inmemoryRepo) CreateWebhook(ctx context.Context, w model.Webhook) (model.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w.Id = newId()
+	w.CreatedAt = time.Now().UTC()
+	w.Thresholds = append([]int(nil), w.Thresholds...)
+	r.webhooks[w.Id] = w
+	return w, nil
+}
+
+func (r *inmemoryRepo) GetWebhook(ctx context.Context, id string) (model.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.webhooks[id]
+	if !ok {
+		return model.Webhook{}, ErrWebhookNotFound
+	}
+	return w, nil
+}
+
+func (r *inmemoryRepo) ListWebhooks(ctx context.Context) ([]model.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := make([]model.Webhook, 0, len(r.webhooks))
+	for _, w := range r.webhooks {
+		list = append(list, w)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].Id < list[j].Id
+	})
+	return list, nil
+}
+
+func (r *inmemoryRepo) UpdateWebhook(ctx context.Context, w model.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, ok := r.webhooks[w.Id]
+	if !ok {
+		return ErrWebhookNotFound
+	}
+	w.CreatedAt = old.CreatedAt
+	w.Thresholds = append([]int(nil), w.Thresholds...)
+	r.webhooks[w.Id] = w
+	return nil
+}
+
+func (r *inmemoryRepo) DeleteWebhook(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.webhooks[id]; !ok {
+		return ErrWebhookNotFound
+	}
+	delete(r.webhooks, id)
+	for m := range r.fired {
+		if m.webhookId == id {
+			delete(r.fired, m)
+		}
+	}
+	return nil
+}
+
+func (r *inmemoryRepo) MarkFired(ctx context.Context, webhookId, videoId string, threshold int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m := milestone{webhookId, videoId, threshold}
+	if _, ok := r.fired[m]; ok {
+		return false, nil
+	}
+	r.fired[m] = struct{}{}
+	return true, nil
+}
+
+func (r *inmemoryRepo) AddDeadLetter(ctx context.Context, d model.DeadLetter) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d.Id = newId()
+	r.deadLetters = append(r.deadLetters, d)
+	return nil
+}
+
+func (r *inmemoryRepo) ListDeadLetters(ctx context.Context) ([]model.DeadLetter, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]model.DeadLetter(nil), r.deadLetters...), nil
+}
+
+func (r *inmemoryRepo) GetDeadLetter(ctx context.Context, id string) (model.DeadLetter, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, d := range r.deadLetters {
+		if d.Id == id {
+			return d, nil
+		}
+	}
+	return model.DeadLetter{}, ErrDeadLetterNotFound
+}
+
+func (r *inmemoryRepo) DeleteDeadLetter(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, d := range r.deadLetters {
+		if d.Id == id {
+			r.deadLetters = append(r.deadLetters[:i], r.deadLetters[i+1:]...)
+			return nil
+		}
+	}
+	return ErrDeadLetterNotFound
+}
@@ -0,0 +1,168 @@
+package webhookrepository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"view_count/model"
+
+	"github.com/lib/pq"
+)
+
+type postgresRepo struct {
+	*sql.DB
+}
+
+func NewPostgresRepo(db *sql.DB) *postgresRepo {
+	return &postgresRepo{
+		DB: db,
+	}
+}
+
+const webhookColumns = "id, url, secret, video_id, thresholds, created_at"
+
+func scanWebhook(row interface{ Scan(...any) error }) (w model.Webhook, err error) {
+	var thresholds pq.Int64Array
+	if err = row.Scan(&w.Id, &w.URL, &w.Secret, &w.VideoId, &thresholds, &w.CreatedAt); err != nil {
+		return model.Webhook{}, err
+	}
+	for _, t := range thresholds {
+		w.Thresholds = append(w.Thresholds, int(t))
+	}
+	return w, nil
+}
+
+func (db *postgresRepo) CreateWebhook(ctx context.Context, w model.Webhook) (model.Webhook, error) {
+	w.Id = newId()
+	w.CreatedAt = time.Now().UTC()
+	_, err := db.ExecContext(ctx,
+		"INSERT INTO webhooks ("+webhookColumns+") VALUES ($1, $2, $3, $4, $5, $6)",
+		w.Id, w.URL, w.Secret, w.VideoId, pq.Array(w.Thresholds), w.CreatedAt)
+	if err != nil {
+		return model.Webhook{}, err
+	}
+	return w, nil
+}
+
+func (db *postgresRepo) GetWebhook(ctx context.Context, id string) (model.Webhook, error) {
+	row := db.QueryRowContext(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE id = $1", id)
+	w, err := scanWebhook(row)
+	if err == sql.ErrNoRows {
+		return model.Webhook{}, ErrWebhookNotFound
+	}
+	return w, err
+}
+
+func (db *postgresRepo) ListWebhooks(ctx context.Context) (list []model.Webhook, err error) {
+	rows, err := db.QueryContext(ctx, "SELECT "+webhookColumns+" FROM webhooks ORDER BY created_at, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, w)
+	}
+	return list, rows.Err()
+}
+
+func (db *postgresRepo) UpdateWebhook(ctx context.Context, w model.Webhook) error {
+	res, err := db.ExecContext(ctx,
+		"UPDATE webhooks SET url = $2, secret = $3, video_id = $4, thresholds = $5 WHERE id = $1",
+		w.Id, w.URL, w.Secret, w.VideoId, pq.Array(w.Thresholds))
+	return checkAffected(res, err)
+}
+
+func (db *postgresRepo) DeleteWebhook(ctx context.Context, id string) error {
+	// webhook_milestones rows go with it through ON DELETE CASCADE.
+	res, err := db.ExecContext(ctx, "DELETE FROM webhooks WHERE id = $1", id)
+	return checkAffected(res, err)
+}
+
+func checkAffected(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (db *postgresRepo) MarkFired(ctx context.Context, webhookId, videoId string, threshold int) (bool, error) {
+	res, err := db.ExecContext(ctx,
+		"INSERT INTO webhook_milestones (webhook_id, video_id, threshold, fired_at) VALUES ($1, $2, $3, NOW()) ON CONFLICT DO NOTHING",
+		webhookId, videoId, threshold)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (db *postgresRepo) AddDeadLetter(ctx context.Context, d model.DeadLetter) error {
+	_, err := db.ExecContext(ctx,
+		"INSERT INTO webhook_dead_letters (id, webhook_id, payload, attempts, last_error, failed_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		newId(), d.WebhookId, string(d.Payload), d.Attempts, d.LastError, d.FailedAt)
+	return err
+}
+
+const deadLetterColumns = "id, webhook_id, payload, attempts, last_error, failed_at"
+
+func scanDeadLetter(row interface{ Scan(...any) error }) (d model.DeadLetter, err error) {
+	var payload string
+	if err = row.Scan(&d.Id, &d.WebhookId, &payload, &d.Attempts, &d.LastError, &d.FailedAt); err != nil {
+		return model.DeadLetter{}, err
+	}
+	d.Payload = []byte(payload)
+	return d, nil
+}
+
+func (db *postgresRepo) ListDeadLetters(ctx context.Context) (list []model.DeadLetter, err error) {
+	rows, err := db.QueryContext(ctx, "SELECT "+deadLetterColumns+" FROM webhook_dead_letters ORDER BY failed_at")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
+
+func (db *postgresRepo) GetDeadLetter(ctx context.Context, id string) (model.DeadLetter, error) {
+	row := db.QueryRowContext(ctx, "SELECT "+deadLetterColumns+" FROM webhook_dead_letters WHERE id = $1", id)
+	d, err := scanDeadLetter(row)
+	if err == sql.ErrNoRows {
+		return model.DeadLetter{}, ErrDeadLetterNotFound
+	}
+	return d, err
+}
+
+func (db *postgresRepo) DeleteDeadLetter(ctx context.Context, id string) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM webhook_dead_letters WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package webhookrepository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+	"view_count/model"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresRepo(t *testing.T) {
+	database, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer database.Close()
+	repo := NewPostgresRepo(database)
+	ctx := context.Background()
+
+	t.Run("GetWebhook", func(t *testing.T) {
+		created := time.Now()
+		mock.ExpectQuery("SELECT id, url, secret, video_id, thresholds, created_at FROM webhooks WHERE id = \\$1").
+			WithArgs("wh1").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "url", "secret", "video_id", "thresholds", "created_at"}).
+				AddRow("wh1", "https://example.com", "s", "", "{1000,10000}", created))
+		mock.ExpectQuery("SELECT .* FROM webhooks WHERE id = \\$1").
+			WithArgs("missing").
+			WillReturnError(sql.ErrNoRows)
+
+		w, err := repo.GetWebhook(ctx, "wh1")
+		require.NoError(t, err)
+		assert.Equal(t, model.Webhook{Id: "wh1", URL: "https://example.com", Secret: "s", Thresholds: []int{1000, 10000}, CreatedAt: created}, w)
+
+		_, err = repo.GetWebhook(ctx, "missing")
+		assert.Equal(t, ErrWebhookNotFound, err)
+	})
+
+	t.Run("MarkFired", func(t *testing.T) {
+		const query = "INSERT INTO webhook_milestones \\(webhook_id, video_id, threshold, fired_at\\) VALUES \\(\\$1, \\$2, \\$3, NOW\\(\\)\\) ON CONFLICT DO NOTHING"
+		mock.ExpectExec(query).WithArgs("wh1", "video1", 1000).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(query).WithArgs("wh1", "video1", 1000).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		fired, err := repo.MarkFired(ctx, "wh1", "video1", 1000)
+		require.NoError(t, err)
+		assert.True(t, fired)
+
+		fired, err = repo.MarkFired(ctx, "wh1", "video1", 1000)
+		require.NoError(t, err)
+		assert.False(t, fired)
+	})
+
+	t.Run("DeleteWebhook", func(t *testing.T) {
+		mock.ExpectExec("DELETE FROM webhooks WHERE id = \\$1").WithArgs("missing").WillReturnResult(sqlmock.NewResult(0, 0))
+		assert.Equal(t, ErrWebhookNotFound, repo.DeleteWebhook(ctx, "missing"))
+	})
+
+	t.Run("GetDeadLetter", func(t *testing.T) {
+		failed := time.Now()
+		mock.ExpectQuery("SELECT id, webhook_id, payload, attempts, last_error, failed_at FROM webhook_dead_letters WHERE id = \\$1").
+			WithArgs("dl1").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "webhook_id", "payload", "attempts", "last_error", "failed_at"}).
+				AddRow("dl1", "wh1", `{"id":"e1"}`, 6, "receiver responded 503", failed))
+		mock.ExpectQuery("SELECT .* FROM webhook_dead_letters WHERE id = \\$1").
+			WithArgs("missing").
+			WillReturnError(sql.ErrNoRows)
+
+		d, err := repo.GetDeadLetter(ctx, "dl1")
+		require.NoError(t, err)
+		assert.Equal(t, model.DeadLetter{Id: "dl1", WebhookId: "wh1", Payload: []byte(`{"id":"e1"}`), Attempts: 6, LastError: "receiver responded 503", FailedAt: failed}, d)
+
+		_, err = repo.GetDeadLetter(ctx, "missing")
+		assert.Equal(t, ErrDeadLetterNotFound, err)
+	})
+
+	t.Run("DeleteDeadLetter", func(t *testing.T) {
+		mock.ExpectExec("DELETE FROM webhook_dead_letters WHERE id = \\$1").WithArgs("dl1").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("DELETE FROM webhook_dead_letters WHERE id = \\$1").WithArgs("missing").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		assert.NoError(t, repo.DeleteDeadLetter(ctx, "dl1"))
+		assert.Equal(t, ErrDeadLetterNotFound, repo.DeleteDeadLetter(ctx, "missing"))
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
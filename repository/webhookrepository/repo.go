@@ -0,0 +1,58 @@
+// Package webhookrepository stores webhook subscriptions, the milestones
+// they already fired for and deliveries that failed for good.
+package webhookrepository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"view_count/model"
+)
+
+var (
+	ErrWebhookNotFound    = errors.New("webhook not found")
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+)
+
+type Repository interface {
+	// CreateWebhook stores w under a new ID and returns it with the ID and
+	// creation time set.
+	CreateWebhook(ctx context.Context, w model.Webhook) (model.Webhook, error)
+
+	// GetWebhook returns ErrWebhookNotFound if there is no webhook id.
+	GetWebhook(ctx context.Context, id string) (model.Webhook, error)
+
+	ListWebhooks(ctx context.Context) ([]model.Webhook, error)
+
+	// UpdateWebhook replaces the webhook with w.Id, keeping its creation
+	// time. It returns ErrWebhookNotFound if there is none.
+	UpdateWebhook(ctx context.Context, w model.Webhook) error
+
+	// DeleteWebhook removes the webhook and the milestones it fired for. It
+	// returns ErrWebhookNotFound if there is none.
+	DeleteWebhook(ctx context.Context, id string) error
+
+	// MarkFired records that webhookId fired for videoId reaching
+	// threshold. It reports false if that was already recorded, so every
+	// milestone is delivered once even with several instances.
+	MarkFired(ctx context.Context, webhookId, videoId string, threshold int) (bool, error)
+
+	AddDeadLetter(ctx context.Context, d model.DeadLetter) error
+
+	ListDeadLetters(ctx context.Context) ([]model.DeadLetter, error)
+
+	// GetDeadLetter returns ErrDeadLetterNotFound if there is no dead
+	// letter id.
+	GetDeadLetter(ctx context.Context, id string) (model.DeadLetter, error)
+
+	// DeleteDeadLetter returns ErrDeadLetterNotFound if there is no dead
+	// letter id.
+	DeleteDeadLetter(ctx context.Context, id string) error
+}
+
+func newId() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
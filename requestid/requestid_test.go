@@ -0,0 +1,23 @@
+package requestid
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext(t *testing.T) {
+	assert.Equal(t, "", FromContext(context.Background()))
+
+	ctx := NewContext(context.Background(), "req-1")
+	assert.Equal(t, "req-1", FromContext(ctx))
+}
+
+func TestValid(t *testing.T) {
+	assert.True(t, Valid(New()))
+	assert.True(t, Valid("3f2c:web-1_a.b"))
+	assert.False(t, Valid(""))
+	assert.False(t, Valid("*/ DROP TABLE videos; /*"))
+	assert.False(t, Valid(string(make([]byte, 129))))
+}
@@ -1,24 +1,94 @@
 package main
 
 import (
+	"net/http"
+	"view_count/apiv1"
+	"view_count/auth"
+	"view_count/gql"
+	"view_count/health"
+	"view_count/live"
 	"view_count/middleware"
+	"view_count/openapi"
+	"view_count/problem"
+	"view_count/ratelimit"
+	"view_count/repository/invalidviewrepository"
+	"view_count/viewfilter"
+	"view_count/webhook"
 
+	"github.com/go-kit/kit/metrics"
+	kitlog "github.com/go-kit/log"
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func routeIntialiser(h handler) *mux.Router {
+// routeDeps carries everything besides the view handler that the routes
+// need.
+type routeDeps struct {
+	health              *health.Checker
+	httpDuration        metrics.Histogram
+	live                *live.Hub
+	websocket           live.WebSocketConfig
+	v1                  *apiv1.Handler
+	webhooks            *webhook.AdminHandler
+	graphql             *gql.Handler
+	auth                *auth.Authenticator
+	policy              auth.Policy
+	rateLimiter         *ratelimit.Limiter
+	rateLimitRejections metrics.Counter
+	invalidViewRepo     invalidviewrepository.Repository
+	invalidViews        metrics.Counter
+	viewReports         *viewfilter.ReportHandler
+	viewTokenRejections metrics.Counter
+	requestLogger       kitlog.Logger
+	logging             middleware.LoggingConfig
+}
+
+func routeIntialiser(h handler, deps routeDeps) *mux.Router {
 
 	r := mux.NewRouter()
-	r.Use(middleware.LoggingMiddleware)
+	r.Use(
+		problem.Middleware(apiv1.Prefix+"/"),
+		middleware.RequestID,
+		middleware.Tracing,
+		middleware.Metrics(deps.httpDuration),
+		middleware.Logging(deps.requestLogger, deps.logging),
+		deps.rateLimiter.Middleware(deps.logging.TrustProxy),
+		viewfilter.Capture(deps.logging.TrustProxy),
+		deps.auth.Middleware,
+	)
+	reads := auth.Require(deps.policy.Reads)
+
+	deps.v1.Register(r)
+
+	// the unversioned routes keep their formats for existing clients and
+	// link to their /v1 successors.
+	legacy := middleware.Successor
+	r.Handle("/", legacy("/v1/videos")(reads(http.HandlerFunc(h.handleIndex))))
+	r.Handle("/increment/{vID}", legacy("/v1/videos/{vID}/views")(auth.Require(deps.policy.Increment)(http.HandlerFunc(h.handleIncrement))))
+	r.Handle("/views/{vID}", legacy("/v1/videos/{vID}")(reads(http.HandlerFunc(h.handleViews))))
+	r.Handle("/top/{n}", legacy("/v1/top?n={n}")(reads(http.HandlerFunc(h.handleTopVideos))))
+	r.Handle("/recent/{n}", legacy("/v1/recent?n={n}")(reads(http.HandlerFunc(h.handleRecentVideos))))
+
+	r.Handle("/views", reads(http.HandlerFunc(h.handleViewsQuery))).Methods("GET")
+	r.Handle("/views:batch", reads(http.HandlerFunc(h.handleViewsBatch))).Methods("POST")
+
+	r.Handle("/stream/views/{vID}", reads(http.HandlerFunc(deps.live.ServeVideo))).Methods("GET")
+	r.Handle("/stream/top/{n}", reads(http.HandlerFunc(deps.live.ServeTop))).Methods("GET")
+	r.Handle("/graphql", reads(deps.graphql)).Methods("GET", "POST")
+	r.Handle("/ws", deps.auth.RequireWebSocket(deps.policy.Reads)(live.NewWebSocketHandler(deps.live, deps.websocket, deps.requestLogger))).Methods("GET")
+
+	r.Handle("/metrics", auth.Require(deps.policy.Metrics)(promhttp.Handler()))
 
-	r.HandleFunc("/", h.handleIndex)
-	r.HandleFunc("/increment/{vID}", h.handleIncrement)
-	r.HandleFunc("/views/{vID}", h.handleViews)
-	r.HandleFunc("/top/{n}", h.handleTopVideos)
-	r.HandleFunc("/recent/{n}", h.handleRecentVideos)
+	// the admin handlers register their full /admin paths, so the
+	// subrouter must not add a prefix of its own.
+	admin := r.NewRoute().Subrouter()
+	admin.Use(auth.Audit(deps.requestLogger), auth.Require(deps.policy.Admin))
+	deps.webhooks.Register(admin)
+	deps.viewReports.Register(admin)
 
-	r.Handle("/metrics", promhttp.Handler())
+	r.HandleFunc("/healthz", deps.health.Liveness).Methods("GET")
+	r.HandleFunc("/readyz", deps.health.Readiness).Methods("GET")
+	openapi.Register(r, openapi.Server)
 
 	// TODO: add handler which returns top 10 view video ids : Done
 	// TODO: add handler which gives me 10 recent incrment video ids : Done
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"view_count/apiv1"
+	"view_count/auth"
+	"view_count/gql"
+	"view_count/health"
+	"view_count/live"
+	"view_count/model"
+	"view_count/openapi"
+	"view_count/openapi/openapitest"
+	"view_count/ratelimit"
+	"view_count/repository/apikeyrepository"
+	"view_count/repository/invalidviewrepository"
+	"view_count/repository/viewrepository"
+	"view_count/repository/webhookrepository"
+	"view_count/viewfilter"
+	"view_count/viewservice"
+	"view_count/webhook"
+
+	"github.com/go-kit/kit/metrics/discard"
+	kitlog "github.com/go-kit/log"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRouter returns the routes over in-memory repositories, with an
+// API key per role.
+func newTestRouter(t *testing.T) (*mux.Router, map[auth.Role]string) {
+	t.Helper()
+	ctx := context.Background()
+	logger := kitlog.NewNopLogger()
+	vs := viewservice.Service(viewservice.NewService(viewrepository.NewInmemoryRepo()))
+
+	keyRepo := apikeyrepository.NewInmemoryRepo()
+	keys := make(map[auth.Role]string)
+	for _, role := range []auth.Role{auth.RoleReader, auth.RoleWriter, auth.RoleAdmin} {
+		key, err := auth.GenerateKey()
+		require.NoError(t, err)
+		_, err = keyRepo.CreateAPIKey(ctx, model.APIKey{Name: string(role), Role: string(role), Hash: auth.HashKey(key)})
+		require.NoError(t, err)
+		keys[role] = key
+	}
+
+	hub := live.NewHub(vs, live.HubConfig{Interval: time.Second, Buffer: 16, MaxN: 100}, logger)
+	invalidViewRepo := invalidviewrepository.NewInmemoryRepo()
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), nil, discard.NewCounter(), logger)
+	graphql, err := gql.NewHandler(vs, gql.Config{MaxComplexity: 1000, MaxN: hub.MaxN(), Playground: true})
+	require.NoError(t, err)
+
+	webhookRepo := webhookrepository.NewInmemoryRepo()
+	return routeIntialiser(*NewHandler(vs), routeDeps{
+		health:        health.NewChecker(time.Second),
+		v1:            apiv1.NewHandler(vs, apiv1.Config{Policy: auth.DefaultPolicy, MaxN: hub.MaxN(), MaxBatchSize: viewservice.DefaultMaxBatchSize, IdempotencyTTL: time.Minute}),
+		httpDuration:  discard.NewHistogram(),
+		live:          hub,
+		webhooks:      webhook.NewAdminHandler(webhookRepo, webhook.NewDispatcher(webhookRepo, vs, webhook.Config{}, logger)),
+		graphql:       graphql,
+		auth:          auth.NewAuthenticator(keyRepo, logger),
+		policy:        auth.DefaultPolicy,
+		rateLimiter:   limiter,
+		viewReports:   viewfilter.NewReportHandler(vs, invalidViewRepo),
+		requestLogger: logger,
+	}), keys
+}
+
+func TestLegacyRoutes(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	for target, successor := range map[string]string{
+		"/":             "/v1/videos",
+		"/views/video1": "/v1/videos/video1",
+		"/top/3":        "/v1/top?n=3",
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		assert.Equal(t, "<"+successor+`>; rel="successor-version"`, rec.Header().Get("Link"), target)
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/increment/video1", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"), "legacy routes keep plain text errors")
+}
+
+func TestRoutesContract(t *testing.T) {
+	contract := openapitest.Load(t, openapi.Server)
+	r, keys := newTestRouter(t)
+
+	assert.Empty(t, contract.Undocumented(r), "routes missing from openapi/server.json")
+
+	webhookBody := `{"url": "https://example.com/hook", "thresholds": [100, 10]}`
+	var webhookId string
+
+	for _, tc := range []struct {
+		method, target string
+		role           auth.Role
+		accept, body   string
+		want           int
+	}{
+		{method: "POST", target: "/increment/video1", want: http.StatusUnauthorized},
+		{method: "POST", target: "/increment/video1", role: auth.RoleReader, want: http.StatusForbidden},
+		{method: "POST", target: "/increment/video1", role: auth.RoleWriter, want: http.StatusOK},
+		{method: "POST", target: "/increment/video2", role: auth.RoleWriter, want: http.StatusOK},
+		{method: "GET", target: "/", accept: "application/json", want: http.StatusOK},
+		{method: "GET", target: "/", accept: "text/html;q=0.5, application/json", want: http.StatusOK},
+		{method: "GET", target: "/", want: http.StatusOK},
+		{method: "GET", target: "/", accept: "text/csv", want: http.StatusOK},
+		{method: "GET", target: "/", accept: "application/x-ndjson", want: http.StatusOK},
+		{method: "GET", target: "/views/video1", want: http.StatusOK},
+		{method: "GET", target: "/views?id=video1&id=video2&id=unseen", want: http.StatusOK},
+		{method: "GET", target: "/views", want: http.StatusBadRequest},
+		{method: "GET", target: "/views?id=video1&id=", want: http.StatusBadRequest},
+		{method: "POST", target: "/views:batch", body: `{"ids": ["video1", "unseen"]}`, want: http.StatusOK},
+		{method: "POST", target: "/views:batch", body: `{"ids": []}`, want: http.StatusBadRequest},
+		{method: "POST", target: "/views:batch", body: `{"ids"`, want: http.StatusBadRequest},
+		{method: "GET", target: "/top/2", accept: "application/json", want: http.StatusOK},
+		{method: "GET", target: "/top/2", accept: "application/xml", want: http.StatusOK},
+		{method: "GET", target: "/recent/2", accept: "application/json", want: http.StatusOK},
+		{method: "GET", target: "/recent/2", accept: "application/x-protobuf", want: http.StatusOK},
+		{method: "POST", target: "/v1/videos/video1/views", want: http.StatusUnauthorized},
+		{method: "POST", target: "/v1/videos/video1/views", role: auth.RoleReader, want: http.StatusForbidden},
+		{method: "POST", target: "/v1/videos/video1/views", role: auth.RoleWriter, want: http.StatusOK},
+		{method: "GET", target: "/v1/videos", want: http.StatusOK},
+		{method: "GET", target: "/v1/videos", accept: "text/html", want: http.StatusNotAcceptable},
+		{method: "GET", target: "/v1/videos?id=video1&id=video2", want: http.StatusOK},
+		{method: "GET", target: "/v1/videos/video1", accept: "application/json", want: http.StatusOK},
+		{method: "GET", target: "/v1/videos/video1/rank", want: http.StatusOK},
+		{method: "GET", target: "/v1/videos/unseen/rank", want: http.StatusNotFound},
+		{method: "GET", target: "/v1/top?n=2", want: http.StatusOK},
+		{method: "GET", target: "/v1/recent", want: http.StatusOK},
+		{method: "GET", target: "/v1/recent?n=0", want: http.StatusBadRequest},
+		{method: "GET", target: "/stream/views/video1", want: http.StatusOK},
+		{method: "GET", target: "/stream/top/0", want: http.StatusBadRequest},
+		{method: "GET", target: "/ws", want: http.StatusBadRequest},
+		{method: "GET", target: "/graphql", want: http.StatusOK},
+		{method: "GET", target: "/graphql?query=%7BtopVideos%7Bid%7D%7D", want: http.StatusOK},
+		{method: "POST", target: "/graphql", body: `{"query": "{ video(id: \"video1\") { views } }"}`, want: http.StatusOK},
+		{method: "POST", target: "/graphql", body: `{"query": "{ nope }"}`, want: http.StatusBadRequest},
+		{method: "GET", target: "/metrics", want: http.StatusUnauthorized},
+		{method: "GET", target: "/metrics", role: auth.RoleReader, want: http.StatusOK},
+		{method: "GET", target: "/admin/webhooks", role: auth.RoleWriter, want: http.StatusForbidden},
+		{method: "POST", target: "/admin/webhooks", role: auth.RoleAdmin, body: `{"url": "ftp://example.com"}`, want: http.StatusBadRequest},
+		{method: "POST", target: "/admin/webhooks", role: auth.RoleAdmin, body: webhookBody, want: http.StatusCreated},
+		{method: "GET", target: "/admin/webhooks", role: auth.RoleAdmin, want: http.StatusOK},
+		{method: "GET", target: "/admin/webhooks/{id}", role: auth.RoleAdmin, want: http.StatusOK},
+		{method: "PUT", target: "/admin/webhooks/{id}", role: auth.RoleAdmin, body: webhookBody, want: http.StatusOK},
+		{method: "DELETE", target: "/admin/webhooks/{id}", role: auth.RoleAdmin, want: http.StatusNoContent},
+		{method: "GET", target: "/admin/webhooks/{id}", role: auth.RoleAdmin, want: http.StatusNotFound},
+		{method: "GET", target: "/admin/webhooks/dead-letters", role: auth.RoleAdmin, want: http.StatusOK},
+		{method: "POST", target: "/admin/webhooks/dead-letters/missing/replay", role: auth.RoleAdmin, want: http.StatusNotFound},
+		{method: "DELETE", target: "/admin/webhooks/dead-letters/missing", role: auth.RoleAdmin, want: http.StatusNotFound},
+		{method: "GET", target: "/admin/reports/views/video1", role: auth.RoleAdmin, want: http.StatusOK},
+		{method: "GET", target: "/admin/views/quarantine?n=10", role: auth.RoleAdmin, want: http.StatusOK},
+		{method: "GET", target: "/admin/views/quarantine?n=0", role: auth.RoleAdmin, want: http.StatusBadRequest},
+		{method: "GET", target: "/healthz", want: http.StatusOK},
+		{method: "GET", target: "/readyz", want: http.StatusOK},
+		{method: "GET", target: "/openapi.json", want: http.StatusOK},
+		{method: "GET", target: "/docs", want: http.StatusOK},
+	} {
+		target := strings.Replace(tc.target, "{id}", webhookId, 1)
+		req := httptest.NewRequest(tc.method, target, strings.NewReader(tc.body))
+		if tc.role != auth.RolePublic {
+			req.Header.Set(auth.APIKeyHeader, keys[tc.role])
+		}
+		if tc.accept != "" {
+			req.Header.Set("Accept", tc.accept)
+		}
+		if strings.HasPrefix(target, "/stream/") {
+			// streams end with their request; the first event is enough.
+			ctx, cancel := context.WithCancel(req.Context())
+			cancel()
+			req = req.WithContext(ctx)
+		}
+		rec := httptest.NewRecorder()
+
+		r.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.want, rec.Code, "%s %s: %s", tc.method, target, rec.Body)
+		contract.Check(t, req, rec)
+		if tc.want == http.StatusCreated {
+			var created struct{ Id string }
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+			webhookId = created.Id
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+	"view_count/apiv1"
+	"view_count/auth"
+	"view_count/gql"
+	"view_count/live"
+	"view_count/middleware"
+	"view_count/ratelimit"
+	"view_count/tracing"
+	"view_count/viewfilter"
+	"view_count/viewservice"
+	"view_count/viewservice/pb"
+	"view_count/viewtoken"
+
+	kitlog "github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+)
+
+type serveConfig struct {
+	httpAddr        string
+	metricsAddr     string
+	drainDelay      time.Duration
+	shutdownTimeout time.Duration
+	logging         middleware.LoggingConfig
+	tracing         tracing.Config
+	websocket       live.WebSocketConfig
+	publicReads     bool
+	rateLimits      []string
+	rateLimitRedis  string
+	viewFilter      viewFilterConfig
+	idempotencyTTL  time.Duration
+	maxBatchSize    int
+	grpcAddr        string
+	grpc            viewservice.GRPCConfig
+	graphql         gql.Config
+	jwt             jwtConfig
+	viewTokens      viewTokenConfig
+}
+
+type viewTokenConfig struct {
+	keysFile string
+	maxTTL   time.Duration
+	redis    string
+}
+
+type jwtConfig struct {
+	jwks    string
+	refresh time.Duration
+	roles   map[string]string
+	auth.JWTConfig
+}
+
+type viewFilterConfig struct {
+	httpClients bool
+	cidrFile    string
+	maxViews    int
+	window      time.Duration
+	quarantine  []string
+	retention   time.Duration
+}
+
+// newServeCmd returns the serve command. deps is completed with the
+// request logger once the logging flags are known.
+func newServeCmd(vs viewservice.Service, deps routeDeps, logger kitlog.Logger, workers map[string]worker) *cobra.Command {
+	var cfg serveConfig
+
+	cmd := &cobra.Command{
+		Use:          "serve",
+		Short:        "Run the HTTP server",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return serve(cmd.Context(), cfg, vs, deps, logger, workers)
+		},
+	}
+	cmd.Flags().StringVar(&cfg.httpAddr, "http-addr", ":8080", "address of the HTTP server")
+	cmd.Flags().StringVar(&cfg.metricsAddr, "metrics-addr", "", "address of a separate metrics listener, empty to disable")
+	cmd.Flags().StringVar(&cfg.grpcAddr, "grpc-addr", "", "address of the gRPC server, empty to disable")
+	cmd.Flags().DurationVar(&cfg.grpc.MinWatchInterval, "grpc-watch-min-interval", time.Second, "shortest interval WatchTop streams are refreshed at")
+	cmd.Flags().BoolVar(&cfg.graphql.Playground, "graphql-playground", false, "serve a GraphiQL page on GET /graphql, for development")
+	cmd.Flags().IntVar(&cfg.graphql.MaxComplexity, "graphql-max-complexity", 1000, "largest estimated cost of a GraphQL query, counting list fields once per item")
+	cmd.Flags().DurationVar(&cfg.drainDelay, "drain-delay", 5*time.Second, "how long readiness fails before the server stops accepting connections")
+	cmd.Flags().DurationVar(&cfg.shutdownTimeout, "shutdown-timeout", 10*time.Second, "how long in-flight requests may take to drain")
+	cmd.Flags().StringVar(&cfg.logging.Level, "log-level", "info", "minimum request log level: debug, info, warn or error")
+	cmd.Flags().StringVar(&cfg.logging.Format, "log-format", "logfmt", "request log format: logfmt or json")
+	cmd.Flags().Float64Var(&cfg.logging.SampleRate, "log-sample-rate", 1, "fraction of successful requests to log")
+	cmd.Flags().StringVar(&cfg.tracing.Exporter, "trace-exporter", tracing.ExporterNone, "span exporter: none, stdout, file or otlp")
+	cmd.Flags().StringVar(&cfg.tracing.File, "trace-file", "traces.json", "file the file exporter appends spans to")
+	cmd.Flags().StringVar(&cfg.tracing.OTLPEndpoint, "trace-otlp-endpoint", "", "host:port of an OTLP/HTTP collector, defaults to localhost:4318")
+	cmd.Flags().Float64Var(&cfg.tracing.SampleRatio, "trace-sample-ratio", 1, "fraction of new traces to sample")
+	cmd.Flags().DurationVar(&cfg.websocket.MinInterval, "ws-min-interval", time.Second, "minimum time between two updates sent to one WebSocket client")
+	cmd.Flags().DurationVar(&cfg.websocket.WriteTimeout, "ws-write-timeout", 10*time.Second, "how long a WebSocket write may block before the client is dropped")
+	cmd.Flags().DurationVar(&cfg.websocket.PingInterval, "ws-ping-interval", 30*time.Second, "how often WebSocket clients are pinged")
+	cmd.Flags().IntVar(&cfg.websocket.MaxTopics, "ws-max-topics", 20, "maximum subscriptions per WebSocket connection")
+	cmd.Flags().StringSliceVar(&cfg.websocket.PrivateKinds, "ws-private-topics", []string{live.KindRecent}, "topic kinds that require an authenticated WebSocket connection")
+	cmd.Flags().StringVar(&cfg.jwt.jwks, "jwks", "", "file or URL of the JSON Web Key Set bearer JWTs are verified with, empty to reject JWTs")
+	cmd.Flags().DurationVar(&cfg.jwt.refresh, "jwks-refresh", 10*time.Minute, "how often the JSON Web Key Set is reloaded")
+	cmd.Flags().StringVar(&cfg.jwt.Issuer, "jwt-issuer", "", "required iss claim of JWTs")
+	cmd.Flags().StringVar(&cfg.jwt.Audience, "jwt-audience", "", "required aud claim of JWTs")
+	cmd.Flags().StringVar(&cfg.jwt.RoleClaim, "jwt-role-claim", "roles", "JWT claim listing the caller's roles")
+	cmd.Flags().StringToStringVar(&cfg.jwt.roles, "jwt-roles", nil, "role claim values and the role they grant, e.g. counter:admin=admin; by default reader, writer and admin grant themselves")
+	cmd.Flags().StringVar(&cfg.jwt.TenantClaim, "jwt-tenant-claim", "tenant", "JWT claim naming the caller's tenant")
+	cmd.Flags().DurationVar(&cfg.jwt.Leeway, "jwt-leeway", 30*time.Second, "clock skew tolerated when checking JWT times")
+	cmd.Flags().StringVar(&cfg.viewTokens.keysFile, "view-token-keys-file", "", "file of \"<id> <secret>\" view token signing keys; when set, increments need a signed view token")
+	cmd.Flags().DurationVar(&cfg.viewTokens.maxTTL, "view-token-max-ttl", 10*time.Minute, "longest lifetime of view tokens that is accepted")
+	cmd.Flags().StringVar(&cfg.viewTokens.redis, "view-token-redis", "", "redis:// URL of a used view token cache shared by all instances, empty for an in-memory cache")
+	cmd.Flags().BoolVar(&cfg.publicReads, "public-reads", true, "serve view counts, rankings and streams without an API key")
+	cmd.Flags().StringArrayVar(&cfg.rateLimits, "rate-limit", []string{
+		"ip:/increment/{vID}=20/1s:40",
+		"apikey:/increment/{vID}=200/1s:400",
+		"video=10/1m:10",
+	}, "rate limit rule <scope>[:<route>]=<n>/<period>[:<burst>], scope being ip, apikey or video; repeatable")
+	cmd.Flags().StringVar(&cfg.rateLimitRedis, "rate-limit-redis", "", "redis:// URL of a store shared by all instances, empty for in-memory buckets")
+	cmd.Flags().BoolVar(&cfg.viewFilter.httpClients, "invalidate-http-clients", false, "treat views from HTTP client libraries such as curl, okhttp and Java as crawler views")
+	cmd.Flags().StringVar(&cfg.viewFilter.cidrFile, "datacenter-cidr-file", "", "file of data-center CIDRs, one per line, whose views are invalid")
+	cmd.Flags().IntVar(&cfg.viewFilter.maxViews, "viewer-max-views", 20, "views of one video by one viewer per window that are counted as valid")
+	cmd.Flags().DurationVar(&cfg.viewFilter.window, "viewer-window", 10*time.Minute, "window of --viewer-max-views")
+	cmd.Flags().StringSliceVar(&cfg.viewFilter.quarantine, "quarantine-reasons", []string{viewfilter.ReasonHeadless, viewfilter.ReasonDataCenter}, "invalid view reasons whose viewer details are kept for review")
+	cmd.Flags().DurationVar(&cfg.viewFilter.retention, "quarantine-retention", 30*24*time.Hour, "how long quarantined views are kept, 0 to keep them forever")
+	cmd.Flags().DurationVar(&cfg.idempotencyTTL, "idempotency-ttl", viewservice.DefaultIdempotencyTTL, "how long Idempotency-Key values of increments are remembered")
+	cmd.Flags().IntVar(&cfg.maxBatchSize, "max-batch-size", viewservice.DefaultMaxBatchSize, "most video ids one bulk view lookup may ask for")
+	cmd.Flags().BoolVar(&cfg.logging.TrustProxy, "trust-proxy", false, "take client IPs from X-Forwarded-For and X-Real-IP")
+	return cmd
+}
+
+func serve(ctx context.Context, cfg serveConfig, vs viewservice.Service, deps routeDeps, logger kitlog.Logger, workers map[string]worker) (err error) {
+	cfg.tracing.ServiceName = "view_count"
+	shutdownTracing, err := tracing.Setup(ctx, cfg.tracing)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// flush buffered spans once every server has drained.
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.shutdownTimeout)
+		defer cancel()
+		if terr := shutdownTracing(ctx); terr != nil {
+			logger.Log("msg", "flushing traces failed", "err", terr)
+			if err == nil {
+				err = terr
+			}
+		}
+	}()
+
+	requestLogger, err := middleware.NewLogger(os.Stdout, cfg.logging)
+	if err != nil {
+		return err
+	}
+
+	var rules []ratelimit.Rule
+	for _, s := range cfg.rateLimits {
+		rule, err := ratelimit.ParseRule(s)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, rule)
+	}
+	var store ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.rateLimitRedis != "" {
+		opts, err := redis.ParseURL(cfg.rateLimitRedis)
+		if err != nil {
+			return err
+		}
+		client := redis.NewClient(opts)
+		defer client.Close()
+		store = ratelimit.NewRedisStore(client, "view_count:ratelimit:")
+	}
+	crawlerPatterns := viewfilter.CrawlerPatterns
+	if cfg.viewFilter.httpClients {
+		crawlerPatterns = append(append([]string(nil), crawlerPatterns...), viewfilter.HTTPClientPatterns...)
+	}
+	checks := []viewfilter.Check{
+		viewfilter.NewCrawlerCheck(crawlerPatterns),
+		viewfilter.NewHeadlessCheck(),
+	}
+	if cfg.viewFilter.cidrFile != "" {
+		nets, err := viewfilter.LoadCIDRFile(cfg.viewFilter.cidrFile)
+		if err != nil {
+			return err
+		}
+		checks = append(checks, viewfilter.NewDataCenterCheck(nets))
+	}
+	checks = append(checks, viewfilter.NewFrequencyCheck(cfg.viewFilter.maxViews, cfg.viewFilter.window))
+	vs = viewfilter.NewQualifyingService(checks, cfg.viewFilter.quarantine, deps.invalidViewRepo, deps.invalidViews, logger, vs)
+	if cfg.viewFilter.retention > 0 {
+		workers["quarantine"] = expireQuarantinedViewsWorker(deps.invalidViewRepo, cfg.viewFilter.retention, time.Hour, logger)
+	}
+
+	if cfg.viewTokens.keysFile != "" {
+		keys, err := viewtoken.LoadKeyFile(cfg.viewTokens.keysFile)
+		if err != nil {
+			return err
+		}
+		var replays viewtoken.ReplayCache = viewtoken.NewMemoryCache()
+		if cfg.viewTokens.redis != "" {
+			opts, err := redis.ParseURL(cfg.viewTokens.redis)
+			if err != nil {
+				return err
+			}
+			client := redis.NewClient(opts)
+			defer client.Close()
+			replays = viewtoken.NewRedisCache(client, "view_count:viewtoken:")
+		}
+		verifier := viewtoken.NewVerifier(keys, cfg.viewTokens.maxTTL, replays)
+		vs = viewtoken.NewService(verifier, deps.viewTokenRejections, logger, vs)
+	}
+
+	deps.rateLimiter = ratelimit.NewLimiter(store, rules, deps.rateLimitRejections, logger)
+	vs = ratelimit.NewService(deps.rateLimiter, vs)
+
+	h := NewHandler(vs)
+	h.idempotencyTTL = cfg.idempotencyTTL
+	h.maxBatchSize = cfg.maxBatchSize
+	deps.requestLogger = requestLogger
+	deps.logging = cfg.logging
+	deps.websocket = cfg.websocket
+	if cfg.jwt.jwks != "" {
+		keys, err := auth.NewKeySet(ctx, cfg.jwt.jwks, cfg.jwt.refresh, logger)
+		if err != nil {
+			return err
+		}
+		cfg.jwt.Roles = make(map[string]auth.Role, len(cfg.jwt.roles))
+		for value, name := range cfg.jwt.roles {
+			if cfg.jwt.Roles[value], err = auth.ParseRole(name); err != nil {
+				return err
+			}
+		}
+		deps.auth.SetJWTVerifier(auth.NewJWTVerifier(keys, cfg.jwt.JWTConfig))
+		workers["jwks"] = keys.Run
+	}
+	deps.websocket.Authenticate = deps.auth.WebSocket(auth.RoleReader)
+	cfg.graphql.MaxN = deps.live.MaxN()
+	if deps.graphql, err = gql.NewHandler(vs, cfg.graphql); err != nil {
+		return err
+	}
+	deps.policy = auth.DefaultPolicy
+	if !cfg.publicReads {
+		deps.policy.Reads = auth.RoleReader
+	}
+	deps.v1 = apiv1.NewHandler(vs, apiv1.Config{
+		Policy:         deps.policy,
+		MaxN:           deps.live.MaxN(),
+		MaxBatchSize:   cfg.maxBatchSize,
+		IdempotencyTTL: cfg.idempotencyTTL,
+	})
+	r := routeIntialiser(*h, deps)
+
+	lc := newLifecycle(logger, cfg.drainDelay, cfg.shutdownTimeout)
+	lc.addSignalHandler(ctx)
+	// fail readiness first so load balancers stop sending traffic before
+	// the servers stop accepting connections.
+	lc.addShutdownHook(deps.health.SetDraining)
+
+	server := &http.Server{
+		Addr:    cfg.httpAddr,
+		Handler: r,
+	}
+	// streams never go idle on their own, so end them when shutdown starts.
+	server.RegisterOnShutdown(deps.live.DisconnectAll)
+	lc.addServer("http", server, nil)
+
+	if cfg.metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", deps.auth.Middleware(auth.Require(deps.policy.Metrics)(promhttp.Handler())))
+		lc.addServer("metrics", &http.Server{Addr: cfg.metricsAddr, Handler: mux}, nil)
+	}
+
+	if cfg.grpcAddr != "" {
+		cfg.grpc.MaxWatchN = deps.live.MaxN()
+		endpoints := viewservice.MakeEndpoints(vs)
+		endpoints.GetViews = viewservice.MakeGetViewsEndpoint(vs, cfg.maxBatchSize)
+		endpoints = viewservice.AuthorizeEndpoints(endpoints, deps.policy)
+		grpcServer := viewservice.NewGRPCServer(endpoints, cfg.grpc)
+		srv := grpc.NewServer(
+			grpc.ChainUnaryInterceptor(
+				deps.auth.UnaryServerInterceptor(),
+				deps.rateLimiter.UnaryServerInterceptor(),
+				viewfilter.UnaryServerInterceptor(),
+			),
+			grpc.ChainStreamInterceptor(
+				deps.auth.StreamServerInterceptor(),
+				deps.rateLimiter.StreamServerInterceptor(),
+				viewfilter.StreamServerInterceptor(),
+			),
+		)
+		pb.RegisterViewServiceServer(srv, grpcServer)
+		lc.addGRPCServer("grpc", cfg.grpcAddr, srv, grpcServer.Close)
+	}
+
+	for name, w := range workers {
+		lc.addWorker(name, w)
+	}
+
+	return lc.run()
+}
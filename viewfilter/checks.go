@@ -0,0 +1,202 @@
+package viewfilter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reasons a view is invalid.
+const (
+	ReasonCrawler    = "crawler"
+	ReasonHeadless   = "headless"
+	ReasonDataCenter = "datacenter"
+	ReasonFrequency  = "frequency"
+)
+
+// Check finds one kind of invalid view.
+type Check interface {
+	Reason() string
+	Invalid(v Viewer, videoId string) bool
+}
+
+// CrawlerPatterns are lower-case substrings of the user agents of known
+// crawlers and bots. An empty user agent is treated the same.
+var CrawlerPatterns = []string{
+	"bot", "crawler", "spider", "slurp", "facebookexternalhit", "scrapy",
+}
+
+// HTTPClientPatterns are lower-case substrings of the user agents of HTTP
+// client libraries. Apps and backends send views with these too, so they
+// are only flagged when added to CrawlerPatterns on purpose.
+var HTTPClientPatterns = []string{
+	"curl/", "wget/", "python-requests", "python-urllib", "go-http-client",
+	"java/", "okhttp", "libwww-perl", "httpclient",
+}
+
+type crawlerCheck struct {
+	patterns []string
+}
+
+// NewCrawlerCheck flags user agents containing any of patterns, matched
+// case-insensitively.
+func NewCrawlerCheck(patterns []string) Check {
+	return crawlerCheck{patterns}
+}
+
+func (c crawlerCheck) Reason() string { return ReasonCrawler }
+
+func (c crawlerCheck) Invalid(v Viewer, videoId string) bool {
+	ua := strings.ToLower(v.UserAgent)
+	if ua == "" {
+		return true
+	}
+	for _, p := range c.patterns {
+		if strings.Contains(ua, p) {
+			return true
+		}
+	}
+	return false
+}
+
+type headlessCheck struct{}
+
+// NewHeadlessCheck flags the signatures automated browsers leave in their
+// user agent and client hints.
+func NewHeadlessCheck() Check {
+	return headlessCheck{}
+}
+
+func (headlessCheck) Reason() string { return ReasonHeadless }
+
+func (headlessCheck) Invalid(v Viewer, videoId string) bool {
+	ua := strings.ToLower(v.UserAgent)
+	for _, sig := range []string{"headlesschrome", "phantomjs", "puppeteer", "playwright", "selenium", "electron/"} {
+		if strings.Contains(ua, sig) {
+			return true
+		}
+	}
+	return strings.Contains(strings.ToLower(v.Header.Get("Sec-CH-UA")), "headless")
+}
+
+type dataCenterCheck struct {
+	nets []*net.IPNet
+}
+
+// NewDataCenterCheck flags viewers whose IP is in one of nets.
+func NewDataCenterCheck(nets []*net.IPNet) Check {
+	return dataCenterCheck{nets}
+}
+
+func (c dataCenterCheck) Reason() string { return ReasonDataCenter }
+
+func (c dataCenterCheck) Invalid(v Viewer, videoId string) bool {
+	ip := net.ParseIP(v.IP)
+	if ip == nil {
+		return false
+	}
+	for _, n := range c.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCIDRs reads one CIDR or bare IP per line. Blank lines and text after
+// '#' are ignored.
+func ParseCIDRs(r io.Reader) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text, _, _ := strings.Cut(s.Text(), "#")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		if !strings.Contains(text, "/") {
+			if ip := net.ParseIP(text); ip != nil && ip.To4() != nil {
+				text += "/32"
+			} else {
+				text += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, s.Err()
+}
+
+// LoadCIDRFile parses the CIDR list at path.
+func LoadCIDRFile(path string) ([]*net.IPNet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	nets, err := ParseCIDRs(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return nets, nil
+}
+
+type viewWindow struct {
+	start time.Time
+	views int
+}
+
+type frequencyCheck struct {
+	max    int
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	windows   map[string]*viewWindow
+	lastSweep time.Time
+}
+
+// NewFrequencyCheck flags every view of a video beyond max by the same
+// viewer, identified by IP and user agent, within window.
+func NewFrequencyCheck(max int, window time.Duration) *frequencyCheck {
+	return &frequencyCheck{
+		max:     max,
+		window:  window,
+		now:     time.Now,
+		windows: make(map[string]*viewWindow),
+	}
+}
+
+func (c *frequencyCheck) Reason() string { return ReasonFrequency }
+
+func (c *frequencyCheck) Invalid(v Viewer, videoId string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if now.Sub(c.lastSweep) > c.window {
+		for key, w := range c.windows {
+			if now.Sub(w.start) > c.window {
+				delete(c.windows, key)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	key := v.IP + "\x00" + v.UserAgent + "\x00" + videoId
+	w, ok := c.windows[key]
+	if !ok || now.Sub(w.start) > c.window {
+		w = &viewWindow{start: now}
+		c.windows[key] = w
+	}
+	w.views++
+	return w.views > c.max
+}
@@ -0,0 +1,50 @@
+package viewfilter
+
+import (
+	"context"
+	"net/http"
+	"view_count/middleware"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// grpcContext stores the Viewer of a gRPC call in ctx, as Capture does for
+// HTTP requests: the peer address, with the call's metadata as headers.
+func grpcContext(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	header := make(http.Header, len(md))
+	for k, vs := range md {
+		header[http.CanonicalHeaderKey(k)] = vs
+	}
+	return NewContext(ctx, Viewer{
+		IP:        middleware.PeerIP(ctx),
+		UserAgent: header.Get("User-Agent"),
+		Header:    header,
+	})
+}
+
+// UnaryServerInterceptor stores the Viewer of unary calls in their context
+// so that their increments are checked.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(grpcContext(ctx), req)
+	}
+}
+
+type viewerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s viewerStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming calls,
+// such as IngestViews.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, viewerStream{ss, grpcContext(ss.Context())})
+	}
+}
@@ -0,0 +1,101 @@
+package viewfilter
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+	"view_count/repository/invalidviewrepository"
+	"view_count/viewservice"
+
+	"github.com/gorilla/mux"
+)
+
+type videoReport struct {
+	Id              string         `json:"id"`
+	RawViews        int            `json:"raw_views"`
+	ValidViews      int            `json:"valid_views"`
+	InvalidViews    int            `json:"invalid_views"`
+	InvalidByReason map[string]int `json:"invalid_by_reason"`
+}
+
+type quarantinedView struct {
+	VideoId   string    `json:"video_id"`
+	Reason    string    `json:"reason"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	ViewedAt  time.Time `json:"viewed_at"`
+}
+
+// ReportHandler serves raw against valid counts per video and the
+// quarantined views.
+type ReportHandler struct {
+	svc  viewservice.Service
+	repo invalidviewrepository.Repository
+}
+
+func NewReportHandler(svc viewservice.Service, repo invalidviewrepository.Repository) *ReportHandler {
+	return &ReportHandler{svc: svc, repo: repo}
+}
+
+// Register adds the report routes to r.
+func (h *ReportHandler) Register(r *mux.Router) {
+	r.HandleFunc("/admin/reports/views/{vID}", h.report).Methods("GET")
+	r.HandleFunc("/admin/views/quarantine", h.quarantined).Methods("GET")
+}
+
+func (h *ReportHandler) report(w http.ResponseWriter, r *http.Request) {
+	videoId := mux.Vars(r)["vID"]
+
+	valid, err := h.svc.GetView(r.Context(), videoId)
+	switch err {
+	case nil:
+	case viewservice.ErrInvalidArgument:
+		http.Error(w, "VideoID is Required.", http.StatusBadRequest)
+		return
+	default:
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	byReason, err := h.repo.InvalidViews(r.Context(), videoId)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	report := videoReport{Id: videoId, ValidViews: valid, InvalidByReason: byReason}
+	for _, n := range byReason {
+		report.InvalidViews += n
+	}
+	report.RawViews = report.ValidViews + report.InvalidViews
+	writeJSON(w, report)
+}
+
+// quarantined lists the most recent quarantined views, n of them (100 by
+// default, at most 1000).
+func (h *ReportHandler) quarantined(w http.ResponseWriter, r *http.Request) {
+	n := 100
+	if s := r.URL.Query().Get("n"); s != "" {
+		var err error
+		if n, err = strconv.Atoi(s); err != nil || n < 1 || n > 1000 {
+			http.Error(w, "n must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+	}
+
+	views, err := h.repo.ListQuarantined(r.Context(), n)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	res := make([]quarantinedView, 0, len(views))
+	for _, v := range views {
+		res = append(res, quarantinedView(v))
+	}
+	writeJSON(w, res)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
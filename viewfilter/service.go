@@ -0,0 +1,94 @@
+package viewfilter
+
+import (
+	"context"
+	"time"
+	"view_count/model"
+	"view_count/repository/invalidviewrepository"
+	"view_count/viewservice"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/log"
+)
+
+type qualifyingService struct {
+	checks     []Check
+	quarantine map[string]bool
+	repo       invalidviewrepository.Repository
+	invalid    metrics.Counter
+	logger     log.Logger
+	viewservice.Service
+}
+
+// NewQualifyingService returns a Service that runs checks in order on
+// every Increment made on behalf of a viewer. The first failing check
+// turns the view into an invalid view counted under its reason; views
+// failing a reason in quarantine are also kept with the viewer details.
+// Invalid views still succeed, so clients cannot tell they were filtered.
+// Views relayed over gRPC with a viewer_ip are checked against that
+// address rather than the relay's. Calls without a viewer, such as those
+// from the CLI, are not checked.
+func NewQualifyingService(checks []Check, quarantine []string, repo invalidviewrepository.Repository, invalid metrics.Counter, logger log.Logger, s viewservice.Service) viewservice.Service {
+	q := make(map[string]bool)
+	for _, reason := range quarantine {
+		q[reason] = true
+	}
+	return &qualifyingService{checks, q, repo, invalid, logger, s}
+}
+
+func (s *qualifyingService) Increment(ctx context.Context, videoId string) (err error) {
+	if invalid, err := s.qualify(ctx, videoId); invalid {
+		return err
+	}
+	return s.Service.Increment(ctx, videoId)
+}
+
+// IncrementOnce checks retries again, so an invalid view is counted as
+// invalid on every attempt rather than remembered under key.
+func (s *qualifyingService) IncrementOnce(ctx context.Context, videoId, key string, ttl time.Duration) (replayed bool, err error) {
+	if invalid, err := s.qualify(ctx, videoId); invalid {
+		return false, err
+	}
+	return s.Service.IncrementOnce(ctx, videoId, key, ttl)
+}
+
+// qualify runs the checks on a view of videoId and records it if one
+// fails, reporting invalid.
+func (s *qualifyingService) qualify(ctx context.Context, videoId string) (invalid bool, err error) {
+	v, ok := FromContext(ctx)
+	if !ok || videoId == "" {
+		return false, nil
+	}
+	if ip, relayed := viewservice.TokenViewerFromContext(ctx); relayed {
+		v.IP = ip
+	}
+	for _, c := range s.checks {
+		if c.Invalid(v, videoId) {
+			return true, s.recordInvalid(ctx, v, videoId, c.Reason())
+		}
+	}
+	return false, nil
+}
+
+func (s *qualifyingService) recordInvalid(ctx context.Context, v Viewer, videoId, reason string) error {
+	s.invalid.With("reason", reason).Add(1)
+	if err := s.repo.RecordInvalid(ctx, videoId, reason); err != nil {
+		return err
+	}
+	if !s.quarantine[reason] {
+		return nil
+	}
+	err := s.repo.Quarantine(ctx, model.QuarantinedView{
+		VideoId:   videoId,
+		Reason:    reason,
+		IP:        v.IP,
+		UserAgent: v.UserAgent,
+		ViewedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		// the view is already counted as invalid; losing its details is
+		// not worth failing the request.
+		s.logger.Log("msg", "quarantining view failed", "video_id", videoId, "reason", reason, "err", err)
+	}
+	return nil
+}
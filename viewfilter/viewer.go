@@ -0,0 +1,47 @@
+// Package viewfilter qualifies views before they are counted. Views from
+// crawlers, headless browsers, data-center addresses or viewers watching
+// implausibly often are counted as invalid views instead.
+package viewfilter
+
+import (
+	"context"
+	"net/http"
+	"view_count/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// Viewer describes who sent a view.
+type Viewer struct {
+	IP        string
+	UserAgent string
+	Header    http.Header
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying v.
+func NewContext(ctx context.Context, v Viewer) context.Context {
+	return context.WithValue(ctx, contextKey{}, v)
+}
+
+// FromContext returns the viewer stored in ctx.
+func FromContext(ctx context.Context) (Viewer, bool) {
+	v, ok := ctx.Value(contextKey{}).(Viewer)
+	return v, ok
+}
+
+// Capture stores the Viewer of each request in its context. Client IPs
+// come from proxy headers only when trustProxy is set.
+func Capture(trustProxy bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			v := Viewer{
+				IP:        middleware.ClientIP(r, trustProxy),
+				UserAgent: r.UserAgent(),
+				Header:    r.Header,
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), v)))
+		})
+	}
+}
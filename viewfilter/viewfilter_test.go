@@ -0,0 +1,178 @@
+package viewfilter
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"view_count/repository/invalidviewrepository"
+	"view_count/repository/viewrepository"
+	"view_count/viewservice"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/log"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+const browserUA = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36"
+
+// labelCounter records the total added per label set.
+type labelCounter struct {
+	totals map[string]float64
+	lvs    []string
+}
+
+func newLabelCounter() *labelCounter {
+	return &labelCounter{totals: map[string]float64{}}
+}
+
+func (c *labelCounter) With(labelValues ...string) metrics.Counter {
+	return &labelCounter{totals: c.totals, lvs: append(append([]string{}, c.lvs...), labelValues...)}
+}
+
+func (c *labelCounter) Add(delta float64) {
+	c.totals[strings.Join(c.lvs, ",")] += delta
+}
+
+func TestChecks(t *testing.T) {
+	nets, err := ParseCIDRs(strings.NewReader("# cloud\n10.0.0.0/8\n\n192.0.2.7 # single host\n2001:db8::/32\n"))
+	require.NoError(t, err)
+	_, err = ParseCIDRs(strings.NewReader("10.0.0.0/8\nnot-a-cidr\n"))
+	assert.ErrorContains(t, err, "line 2")
+
+	tests := []struct {
+		name    string
+		check   Check
+		viewer  Viewer
+		invalid bool
+	}{
+		{"Browser", NewCrawlerCheck(CrawlerPatterns), Viewer{UserAgent: browserUA}, false},
+		{"Googlebot", NewCrawlerCheck(CrawlerPatterns), Viewer{UserAgent: "Mozilla/5.0 (compatible; Googlebot/2.1)"}, true},
+		{"curl", NewCrawlerCheck(CrawlerPatterns), Viewer{UserAgent: "curl/8.5.0"}, false},
+		{"okhttp", NewCrawlerCheck(CrawlerPatterns), Viewer{UserAgent: "okhttp/4.12.0"}, false},
+		{"curl with HTTP clients", NewCrawlerCheck(append(CrawlerPatterns, HTTPClientPatterns...)), Viewer{UserAgent: "curl/8.5.0"}, true},
+		{"No user agent", NewCrawlerCheck(CrawlerPatterns), Viewer{}, true},
+		{"Headless Chrome", NewHeadlessCheck(), Viewer{UserAgent: strings.Replace(browserUA, "Chrome", "HeadlessChrome", 1)}, true},
+		{"Headless client hint", NewHeadlessCheck(), Viewer{UserAgent: browserUA, Header: http.Header{"Sec-Ch-Ua": {`"HeadlessChrome";v="126"`}}}, true},
+		{"Headed browser", NewHeadlessCheck(), Viewer{UserAgent: browserUA}, false},
+		{"Data-center IPv4", NewDataCenterCheck(nets), Viewer{IP: "10.1.2.3"}, true},
+		{"Data-center host", NewDataCenterCheck(nets), Viewer{IP: "192.0.2.7"}, true},
+		{"Data-center IPv6", NewDataCenterCheck(nets), Viewer{IP: "2001:db8::1"}, true},
+		{"Residential IP", NewDataCenterCheck(nets), Viewer{IP: "192.0.2.8"}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.invalid, tc.check.Invalid(tc.viewer, "video1"))
+		})
+	}
+}
+
+func TestFrequencyCheck(t *testing.T) {
+	c := NewFrequencyCheck(2, time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	v := Viewer{IP: "192.0.2.1", UserAgent: browserUA}
+
+	assert.False(t, c.Invalid(v, "video1"))
+	assert.False(t, c.Invalid(v, "video1"))
+	assert.True(t, c.Invalid(v, "video1"))
+	assert.False(t, c.Invalid(v, "video2"), "windows are per video")
+	assert.False(t, c.Invalid(Viewer{IP: "192.0.2.2", UserAgent: browserUA}, "video1"), "windows are per viewer")
+
+	now = now.Add(2 * time.Minute)
+	assert.False(t, c.Invalid(v, "video1"))
+}
+
+func TestQualifyingService(t *testing.T) {
+	repo := invalidviewrepository.NewInmemoryRepo()
+	invalid := newLabelCounter()
+	svc := NewQualifyingService(
+		[]Check{NewCrawlerCheck(CrawlerPatterns), NewHeadlessCheck(), NewFrequencyCheck(1, time.Minute)},
+		[]string{ReasonHeadless},
+		repo, invalid, log.NewNopLogger(),
+		viewservice.NewService(viewrepository.NewInmemoryRepo()),
+	)
+
+	r := mux.NewRouter()
+	r.Use(Capture(false))
+	r.HandleFunc("/increment/{vID}", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, svc.Increment(r.Context(), mux.Vars(r)["vID"]))
+	})
+	NewReportHandler(svc, repo).Register(r)
+
+	do := func(method, path, ua string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("User-Agent", ua)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	do("POST", "/increment/video1", browserUA)
+	do("POST", "/increment/video1", browserUA)
+	do("POST", "/increment/video1", "Googlebot/2.1")
+	do("POST", "/increment/video1", "HeadlessChrome/126.0")
+	require.NoError(t, svc.Increment(context.Background(), "video1"), "calls without a viewer are not checked")
+
+	assert.Equal(t, map[string]float64{"reason,frequency": 1, "reason,crawler": 1, "reason,headless": 1}, invalid.totals)
+
+	rec := do("GET", "/admin/reports/views/video1", browserUA)
+	assert.JSONEq(t, `{
+		"id": "video1",
+		"raw_views": 5,
+		"valid_views": 2,
+		"invalid_views": 3,
+		"invalid_by_reason": {"frequency": 1, "crawler": 1, "headless": 1}
+	}`, rec.Body.String())
+
+	rec = do("GET", "/admin/views/quarantine?n=10", browserUA)
+	var quarantined []quarantinedView
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &quarantined))
+	require.Len(t, quarantined, 1, "only headless views are quarantined")
+	assert.Equal(t, ReasonHeadless, quarantined[0].Reason)
+	assert.Equal(t, "192.0.2.1", quarantined[0].IP)
+
+	assert.Equal(t, http.StatusBadRequest, do("GET", "/admin/views/quarantine?n=0", browserUA).Code)
+}
+
+func TestGRPCInterceptors(t *testing.T) {
+	_, dataCenter, err := net.ParseCIDR("192.0.2.0/24")
+	require.NoError(t, err)
+	invalid := newLabelCounter()
+	svc := NewQualifyingService(
+		[]Check{NewCrawlerCheck(CrawlerPatterns), NewDataCenterCheck([]*net.IPNet{dataCenter})},
+		nil, invalidviewrepository.NewInmemoryRepo(), invalid, log.NewNopLogger(),
+		viewservice.NewService(viewrepository.NewInmemoryRepo()),
+	)
+	interceptor := UnaryServerInterceptor()
+
+	increment := func(ctx context.Context, ua string) {
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1234}})
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("user-agent", ua))
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req any) (any, error) {
+			return nil, svc.Increment(ctx, "video1")
+		})
+		require.NoError(t, err)
+	}
+
+	increment(context.Background(), "Googlebot/2.1")
+	increment(context.Background(), browserUA)
+	assert.Equal(t, map[string]float64{"reason,crawler": 1, "reason,datacenter": 1}, invalid.totals)
+
+	// a relayed viewer is checked by its own address, not the relay's.
+	increment(viewservice.NewTokenViewerContext(context.Background(), "198.51.100.7"), browserUA)
+	assert.Equal(t, map[string]float64{"reason,crawler": 1, "reason,datacenter": 1}, invalid.totals)
+	views, err := svc.GetView(context.Background(), "video1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, views)
+}
@@ -0,0 +1,120 @@
+package viewservice
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strconv"
+	"view_count/model"
+	"view_count/negotiate"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Encoder writes lists of videos in one media type.
+type Encoder struct {
+	// ContentType is sent as the Content-Type of responses. Its
+	// parameters, if any, are ignored when negotiating.
+	ContentType string
+	Encode      func(w io.Writer, videos []model.VideoInfo) error
+}
+
+// Encoders of the formats every list endpoint offers besides its own JSON
+// and HTML.
+var (
+	CSV      = Encoder{"text/csv; charset=utf-8", encodeCSV}
+	NDJSON   = Encoder{"application/x-ndjson", encodeNDJSON}
+	XML      = Encoder{"application/xml; charset=utf-8", encodeXML}
+	Protobuf = Encoder{"application/x-protobuf", encodeProtobuf}
+)
+
+// Encoders picks an Encoder by the Accept header of a request. Earlier
+// encoders win ties, so the first one is the default.
+type Encoders []Encoder
+
+// ListEncoders returns encoders offering JSON as encoded by json first and
+// then CSV, NDJSON, XML and Protobuf. Transports add or reorder encoders
+// to fit their clients.
+func ListEncoders(json Encoder) Encoders {
+	return Encoders{json, CSV, NDJSON, XML, Protobuf}
+}
+
+// Negotiate returns the encoder accept prefers, or the first encoder when
+// accept rules out all of them.
+func (e Encoders) Negotiate(accept string) Encoder {
+	offers := make([]string, len(e))
+	for i, enc := range e {
+		offers[i] = enc.ContentType
+	}
+	best := negotiate.Best(accept, offers...)
+	for _, enc := range e {
+		if enc.ContentType == best {
+			return enc
+		}
+	}
+	return e[0]
+}
+
+// Write replies with videos encoded as accept prefers.
+func (e Encoders) Write(w http.ResponseWriter, accept string, videos []model.VideoInfo) error {
+	enc := e.Negotiate(accept)
+	w.Header().Set("Content-Type", enc.ContentType)
+	w.Header().Add("Vary", "Accept")
+	return enc.Encode(w, videos)
+}
+
+// encodeCSV writes a header row and a row per video, for spreadsheets.
+func encodeCSV(w io.Writer, videos []model.VideoInfo) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "views"})
+	for _, v := range videos {
+		cw.Write([]string{v.Id, strconv.Itoa(v.Views)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// encodeNDJSON writes a JSON object per video and line.
+func encodeNDJSON(w io.Writer, videos []model.VideoInfo) error {
+	enc := json.NewEncoder(w)
+	for _, v := range videos {
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type xmlVideos struct {
+	XMLName xml.Name   `xml:"videos"`
+	Videos  []xmlVideo `xml:"video"`
+}
+
+type xmlVideo struct {
+	Id    string `xml:"id"`
+	Views int    `xml:"views"`
+}
+
+func encodeXML(w io.Writer, videos []model.VideoInfo) error {
+	doc := xmlVideos{Videos: make([]xmlVideo, len(videos))}
+	for i, v := range videos {
+		doc.Videos[i] = xmlVideo{Id: v.Id, Views: v.Views}
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(doc)
+}
+
+// encodeProtobuf writes a pb.VideoList, the message the gRPC transport
+// returns lists in.
+func encodeProtobuf(w io.Writer, videos []model.VideoInfo) error {
+	b, err := proto.Marshal(toPBVideoList(videos))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
@@ -0,0 +1,62 @@
+package viewservice
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"view_count/model"
+	"view_count/viewservice/pb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestEncoders(t *testing.T) {
+	videos := []model.VideoInfo{{Id: "video1", Views: 2}, {Id: "a,b", Views: 1}}
+
+	for _, tc := range []struct {
+		enc  Encoder
+		want string
+	}{
+		{CSV, "id,views\nvideo1,2\n\"a,b\",1\n"},
+		{NDJSON, "{\"Id\":\"video1\",\"Views\":2}\n{\"Id\":\"a,b\",\"Views\":1}\n"},
+		{XML, xmlHeader + "<videos><video><id>video1</id><views>2</views></video><video><id>a,b</id><views>1</views></video></videos>"},
+	} {
+		var b bytes.Buffer
+		require.NoError(t, tc.enc.Encode(&b, videos))
+		assert.Equal(t, tc.want, b.String(), tc.enc.ContentType)
+	}
+
+	var b bytes.Buffer
+	require.NoError(t, Protobuf.Encode(&b, videos))
+	var list pb.VideoList
+	require.NoError(t, proto.Unmarshal(b.Bytes(), &list))
+	assert.True(t, proto.Equal(toPBVideoList(videos), &list))
+}
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8"?>` + "\n"
+
+func TestEncodersNegotiate(t *testing.T) {
+	encoders := ListEncoders(Encoder{ContentType: "application/json"})
+
+	for accept, want := range map[string]string{
+		"":                                     "application/json",
+		"*/*":                                  "application/json",
+		"text/html":                            "application/json",
+		"text/csv":                             CSV.ContentType,
+		"application/json;q=0.5, text/*":       CSV.ContentType,
+		"application/x-ndjson":                 NDJSON.ContentType,
+		"application/xml, application/*":       "application/json",
+		"application/xml, application/*;q=0.9": XML.ContentType,
+		"application/x-protobuf":               Protobuf.ContentType,
+	} {
+		assert.Equal(t, want, encoders.Negotiate(accept).ContentType, accept)
+	}
+
+	rec := httptest.NewRecorder()
+	require.NoError(t, encoders.Write(rec, "text/csv", nil))
+	assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "Accept", rec.Header().Get("Vary"))
+	assert.Equal(t, "id,views\n", rec.Body.String())
+}
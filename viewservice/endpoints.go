@@ -2,6 +2,7 @@ package viewservice
 
 import (
 	"context"
+	"view_count/auth"
 	"view_count/model"
 
 	"github.com/go-kit/kit/endpoint"
@@ -9,19 +10,37 @@ import (
 
 type Endpoints struct {
 	GetView         endpoint.Endpoint
+	GetViews        endpoint.Endpoint
 	GetAllViews     endpoint.Endpoint
 	Increment       endpoint.Endpoint
 	GetTopVideos    endpoint.Endpoint
 	GetRecentVideos endpoint.Endpoint
+	GetRank         endpoint.Endpoint
 }
 
 func MakeEndpoints(svc Service) Endpoints {
 	return Endpoints{
 		GetView:         MakeGetViewEndpoint(svc),
+		GetViews:        MakeGetViewsEndpoint(svc, DefaultMaxBatchSize),
 		GetAllViews:     MakeGetAllViewsEndpoint(svc),
 		Increment:       MakeIncrementEndpoint(svc),
 		GetTopVideos:    MakeGetTopVideosEndpoint(svc),
 		GetRecentVideos: MakeGetRecentVideosEndpoint(svc),
+		GetRank:         MakeGetRankEndpoint(svc),
+	}
+}
+
+// AuthorizeEndpoints wraps e so every endpoint requires the role p gives
+// its operation, the same policy the HTTP routes enforce.
+func AuthorizeEndpoints(e Endpoints, p auth.Policy) Endpoints {
+	return Endpoints{
+		GetView:         auth.EndpointMiddleware(p.Reads)(e.GetView),
+		GetViews:        auth.EndpointMiddleware(p.Reads)(e.GetViews),
+		GetAllViews:     auth.EndpointMiddleware(p.Reads)(e.GetAllViews),
+		Increment:       auth.EndpointMiddleware(p.Increment)(e.Increment),
+		GetTopVideos:    auth.EndpointMiddleware(p.Reads)(e.GetTopVideos),
+		GetRecentVideos: auth.EndpointMiddleware(p.Reads)(e.GetRecentVideos),
+		GetRank:         auth.EndpointMiddleware(p.Reads)(e.GetRank),
 	}
 }
 
@@ -44,6 +63,33 @@ func MakeGetViewEndpoint(svc Service) endpoint.Endpoint {
 	}
 }
 
+type getViewsRequest struct {
+	Ids []string `json:"ids"`
+}
+
+type getViewsResponse struct {
+	Views map[string]int `json:"views"`
+}
+
+// MakeGetViewsEndpoint returns a GetViews endpoint accepting between 1 and
+// maxBatchSize ids.
+func MakeGetViewsEndpoint(svc Service, maxBatchSize int) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		req := request.(getViewsRequest)
+		if len(req.Ids) == 0 {
+			return nil, ErrInvalidArgument
+		}
+		if len(req.Ids) > maxBatchSize {
+			return nil, ErrBatchTooLarge
+		}
+		views, err := svc.GetViews(ctx, req.Ids)
+		if err != nil {
+			return nil, err
+		}
+		return getViewsResponse{Views: views}, nil
+	}
+}
+
 type getAllViewsResponse struct {
 	Videos []model.VideoInfo `json:"videos"`
 }
@@ -58,22 +104,54 @@ func MakeGetAllViewsEndpoint(svc Service) endpoint.Endpoint {
 	}
 }
 
+// listedVideos returns the videos of the responses of the endpoints
+// returning lists.
+func listedVideos(response any) ([]model.VideoInfo, bool) {
+	switch res := response.(type) {
+	case getAllViewsResponse:
+		return res.Videos, true
+	case getTopVideosResponse:
+		return res.Videos, true
+	case getRecentVideosResponse:
+		return res.Videos, true
+	}
+	return nil, false
+}
+
 type incrementRequest struct {
-	videoId string
+	videoId        string
+	idempotencyKey string
+	viewToken      string
+	viewerIP       string
 }
 
 type incrementResponse struct {
-	Err error `json:"error,omitempty"`
+	Err      error `json:"error,omitempty"`
+	Replayed bool  `json:"replayed,omitempty"`
 }
 
 func MakeIncrementEndpoint(svc Service) endpoint.Endpoint {
 	return func(ctx context.Context, request any) (any, error) {
 		req := request.(incrementRequest)
-		err := svc.Increment(ctx, req.videoId)
+		if req.viewToken != "" {
+			ctx = NewViewTokenContext(ctx, req.viewToken)
+		}
+		if req.viewerIP != "" {
+			ctx = NewTokenViewerContext(ctx, req.viewerIP)
+		}
+		var (
+			replayed bool
+			err      error
+		)
+		if req.idempotencyKey != "" {
+			replayed, err = svc.IncrementOnce(ctx, req.videoId, req.idempotencyKey, 0)
+		} else {
+			err = svc.Increment(ctx, req.videoId)
+		}
 		if err != nil {
 			return nil, err
 		}
-		return incrementResponse{Err: nil}, nil
+		return incrementResponse{Err: nil, Replayed: replayed}, nil
 	}
 }
 
@@ -114,3 +192,25 @@ func MakeGetTopVideosEndpoint(svc Service) endpoint.Endpoint {
 		return getTopVideosResponse{Videos: videos}, nil
 	}
 }
+
+type getRankRequest struct {
+	videoId string
+}
+
+type getRankResponse struct {
+	Id       string `json:"id"`
+	Views    int    `json:"views"`
+	Position int    `json:"position"`
+	Ties     int    `json:"ties"`
+}
+
+func MakeGetRankEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		req := request.(getRankRequest)
+		rank, err := svc.GetRank(ctx, req.videoId)
+		if err != nil {
+			return nil, err
+		}
+		return getRankResponse(rank), nil
+	}
+}
@@ -0,0 +1,28 @@
+package viewservice
+
+import (
+	"time"
+	"view_count/repository/viewrepository"
+)
+
+// DefaultIdempotencyTTL is how long idempotency keys are remembered when
+// IncrementOnce is given no ttl.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// ErrIdempotencyKeyReused is returned by IncrementOnce when the idempotency key
+// was already used for another video.
+var ErrIdempotencyKeyReused = viewrepository.ErrIdempotencyKeyReused
+
+// ValidIdempotencyKey reports whether key is 1 to 255 printable ASCII
+// characters, as HTTP clients must send in Idempotency-Key.
+func ValidIdempotencyKey(key string) bool {
+	if key == "" || len(key) > 255 {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
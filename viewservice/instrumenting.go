@@ -2,6 +2,7 @@ package viewservice
 
 import (
 	"context"
+	"errors"
 	"time"
 	"view_count/model"
 
@@ -9,84 +10,118 @@ import (
 	"github.com/go-kit/log"
 )
 
+const (
+	outcomeSuccess         = "success"
+	outcomeInvalidArgument = "invalid_argument"
+	outcomeNotFound        = "not_found"
+	outcomeError           = "error"
+)
+
 type instrumentingService struct {
 	requestCount   metrics.Counter
 	requestLatency metrics.Histogram
+	viewsIngested  metrics.Counter
 	Service
 	logger log.Logger
 }
 
 // NewInstrumentingService returns an instance of an instrumenting Service.
-func NewInstrumentingService(counter metrics.Counter, latency metrics.Histogram, logger log.Logger, s Service) Service {
+// counter and latency are labelled by method and outcome; viewsIngested
+// counts views that were successfully incremented.
+func NewInstrumentingService(counter metrics.Counter, latency metrics.Histogram, viewsIngested metrics.Counter, logger log.Logger, s Service) Service {
 	return &instrumentingService{
 		requestCount:   counter,
 		requestLatency: latency,
+		viewsIngested:  viewsIngested,
 		logger:         logger,
 		Service:        s,
 	}
 }
 
-func (s *instrumentingService) GetAllViews(ctx context.Context) ([]model.VideoInfo, error) {
+// outcome classifies err for the outcome label.
+func outcome(err error) string {
+	switch {
+	case err == nil:
+		return outcomeSuccess
+	case errors.Is(err, ErrInvalidArgument):
+		return outcomeInvalidArgument
+	case errors.Is(err, ErrVideoNotFound):
+		return outcomeNotFound
+	default:
+		return outcomeError
+	}
+}
+
+func (s *instrumentingService) observe(ctx context.Context, method string, begin time.Time, err error) {
+	requestLatency := time.Since(begin)
+	o := outcome(err)
+	s.requestCount.With("method", method, "outcome", o).Add(1)
+	s.requestLatency.With("method", method, "outcome", o).Observe(requestLatency.Seconds())
+	withRequestID(ctx, s.logger).Log(
+		"method", method,
+		"outcome", o,
+		"requestLatency", requestLatency.Microseconds(),
+	)
+}
+
+func (s *instrumentingService) GetAllViews(ctx context.Context) (info []model.VideoInfo, err error) {
 	defer func(begin time.Time) {
-		requestLatency := time.Since(begin)
-		s.requestCount.With("method", "GetAllViews").Add(1)
-		s.requestLatency.With("method", "GetAllViews").Observe(requestLatency.Seconds())
-		s.logger.Log(
-			"method", "GetAllViews",
-			"requestLatency", requestLatency.Microseconds(),
-		)
+		s.observe(ctx, "GetAllViews", begin, err)
 	}(time.Now())
 	return s.Service.GetAllViews(ctx)
 }
 
 func (s *instrumentingService) Increment(ctx context.Context, videoId string) (err error) {
 	defer func(begin time.Time) {
-		requestLatency := time.Since(begin)
-		s.requestCount.With("method", "Increment").Add(1)
-		s.requestLatency.With("method", "Increment").Observe(requestLatency.Seconds())
-		s.logger.Log(
-			"method", "Increment",
-			"requestLatency", requestLatency.Microseconds(),
-		)
+		s.observe(ctx, "Increment", begin, err)
+		if err == nil {
+			s.viewsIngested.Add(1)
+		}
 	}(time.Now())
 	return s.Service.Increment(ctx, videoId)
 }
 
+func (s *instrumentingService) IncrementOnce(ctx context.Context, videoId, key string, ttl time.Duration) (replayed bool, err error) {
+	defer func(begin time.Time) {
+		s.observe(ctx, "IncrementOnce", begin, err)
+		if err == nil && !replayed {
+			s.viewsIngested.Add(1)
+		}
+	}(time.Now())
+	return s.Service.IncrementOnce(ctx, videoId, key, ttl)
+}
+
 func (s *instrumentingService) GetView(ctx context.Context, videoId string) (view int, err error) {
 	defer func(begin time.Time) {
-		requestLatency := time.Since(begin)
-		s.requestCount.With("method", "GetView").Add(1)
-		s.requestLatency.With("method", "GetView").Observe(requestLatency.Seconds())
-		s.logger.Log(
-			"method", "GetViews",
-			"requestLatency", requestLatency.Microseconds(),
-		)
+		s.observe(ctx, "GetView", begin, err)
 	}(time.Now())
 	return s.Service.GetView(ctx, videoId)
 }
 
-func (s *instrumentingService) GetRecentVideos(ctx context.Context, n int) ([]model.VideoInfo, error) {
+func (s *instrumentingService) GetViews(ctx context.Context, ids []string) (views map[string]int, err error) {
+	defer func(begin time.Time) {
+		s.observe(ctx, "GetViews", begin, err)
+	}(time.Now())
+	return s.Service.GetViews(ctx, ids)
+}
+
+func (s *instrumentingService) GetRank(ctx context.Context, videoId string) (rank model.Rank, err error) {
+	defer func(begin time.Time) {
+		s.observe(ctx, "GetRank", begin, err)
+	}(time.Now())
+	return s.Service.GetRank(ctx, videoId)
+}
+
+func (s *instrumentingService) GetRecentVideos(ctx context.Context, n int) (info []model.VideoInfo, err error) {
 	defer func(begin time.Time) {
-		requestLatency := time.Since(begin)
-		s.requestCount.With("method", "GetRecentVideos").Add(1)
-		s.requestLatency.With("method", "GetRecentVideos").Observe(requestLatency.Seconds())
-		s.logger.Log(
-			"method", "GetRecentVideos",
-			"requestLatency", requestLatency.Microseconds(),
-		)
+		s.observe(ctx, "GetRecentVideos", begin, err)
 	}(time.Now())
 	return s.Service.GetRecentVideos(ctx, n)
 }
 
-func (s *instrumentingService) GetTopVideos(ctx context.Context, n int) ([]model.VideoInfo, error) {
+func (s *instrumentingService) GetTopVideos(ctx context.Context, n int) (info []model.VideoInfo, err error) {
 	defer func(begin time.Time) {
-		requestLatency := time.Since(begin)
-		s.requestCount.With("method", "GetTopVideos").Add(1)
-		s.requestLatency.With("method", "GetTopVideos").Observe(requestLatency.Seconds())
-		s.logger.Log(
-			"method", "GetTopVideos",
-			"requestLatency", requestLatency.Microseconds(),
-		)
+		s.observe(ctx, "GetTopVideos", begin, err)
 	}(time.Now())
 	return s.Service.GetTopVideos(ctx, n)
 }
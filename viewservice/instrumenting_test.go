@@ -0,0 +1,82 @@
+package viewservice
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"view_count/repository/viewrepository"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/log"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// labelCounter records the total added per label set.
+type labelCounter struct {
+	totals map[string]float64
+	lvs    []string
+}
+
+func newLabelCounter() *labelCounter {
+	return &labelCounter{totals: map[string]float64{}}
+}
+
+func (c *labelCounter) With(labelValues ...string) metrics.Counter {
+	return &labelCounter{totals: c.totals, lvs: append(append([]string{}, c.lvs...), labelValues...)}
+}
+
+func (c *labelCounter) Add(delta float64) {
+	c.totals[strings.Join(c.lvs, ",")] += delta
+}
+
+type nopHistogram struct{}
+
+func (h nopHistogram) With(labelValues ...string) metrics.Histogram { return h }
+func (h nopHistogram) Observe(value float64)                        {}
+
+func TestInstrumentingService(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := viewrepository.NewMockRepository(ctrl)
+	requests := newLabelCounter()
+	ingested := newLabelCounter()
+
+	svc := NewInstrumentingService(requests, nopHistogram{}, ingested, log.NewNopLogger(), NewService(mockRepo))
+
+	mockRepo.EXPECT().Increment(gomock.Any(), "video1").Return(nil)
+	mockRepo.EXPECT().Increment(gomock.Any(), "video2").Return(errors.New("db down"))
+
+	assert.NoError(t, svc.Increment(context.Background(), "video1"))
+	assert.Error(t, svc.Increment(context.Background(), "video2"))
+	assert.Equal(t, ErrInvalidArgument, svc.Increment(context.Background(), ""))
+
+	assert.Equal(t, map[string]float64{
+		"method,Increment,outcome,success":          1,
+		"method,Increment,outcome,error":            1,
+		"method,Increment,outcome,invalid_argument": 1,
+	}, requests.totals)
+	assert.Equal(t, map[string]float64{"": 1}, ingested.totals)
+
+	t.Run("Replays are not ingested", func(t *testing.T) {
+		ingested := newLabelCounter()
+		svc := NewInstrumentingService(newLabelCounter(), nopHistogram{}, ingested, log.NewNopLogger(), NewService(viewrepository.NewInmemoryRepo()))
+
+		for i := 0; i < 2; i++ {
+			_, err := svc.IncrementOnce(context.Background(), "video1", "key1", 0)
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, map[string]float64{"": 1}, ingested.totals)
+	})
+
+	t.Run("Unranked videos are not errors", func(t *testing.T) {
+		requests := newLabelCounter()
+		svc := NewInstrumentingService(requests, nopHistogram{}, newLabelCounter(), log.NewNopLogger(), NewService(viewrepository.NewInmemoryRepo()))
+
+		_, err := svc.GetRank(context.Background(), "video1")
+		assert.ErrorIs(t, err, ErrVideoNotFound)
+		assert.Equal(t, map[string]float64{"method,GetRank,outcome,not_found": 1}, requests.totals)
+	})
+}
@@ -3,7 +3,9 @@ package viewservice
 import (
 	"context"
 	"time"
+	"view_count/auth"
 	"view_count/model"
+	"view_count/requestid"
 
 	"github.com/go-kit/log"
 )
@@ -17,9 +19,30 @@ func NewServiceLogging(logger log.Logger, s Service) Service {
 	return &ServiceLogging{logger, s}
 }
 
+// withRequestID adds the correlation ID carried by ctx, if any, to logger.
+func withRequestID(ctx context.Context, logger log.Logger) log.Logger {
+	if id := requestid.FromContext(ctx); id != "" {
+		return log.With(logger, "request_id", id)
+	}
+	return logger
+}
+
+// withCaller adds who made the call, as authenticated into ctx, to logger.
+func withCaller(ctx context.Context, logger log.Logger) log.Logger {
+	p, ok := auth.FromContext(ctx)
+	if !ok {
+		return logger
+	}
+	logger = log.With(logger, "subject", p.Subject)
+	if p.Tenant != "" {
+		logger = log.With(logger, "tenant", p.Tenant)
+	}
+	return logger
+}
+
 func (s *ServiceLogging) GetAllViews(ctx context.Context) (info []model.VideoInfo, err error) {
 	defer func(begin time.Time) {
-		s.logger.Log(
+		withCaller(ctx, withRequestID(ctx, s.logger)).Log(
 			"Method", "GetAllViews",
 			"took", time.Since(begin),
 			"err", err,
@@ -30,7 +53,7 @@ func (s *ServiceLogging) GetAllViews(ctx context.Context) (info []model.VideoInf
 
 func (s *ServiceLogging) GetView(ctx context.Context, videoId string) (view int, err error) {
 	defer func(begin time.Time) {
-		s.logger.Log(
+		withCaller(ctx, withRequestID(ctx, s.logger)).Log(
 			"Method", "GetView",
 			"videoId", videoId,
 			"took", time.Since(begin),
@@ -40,9 +63,33 @@ func (s *ServiceLogging) GetView(ctx context.Context, videoId string) (view int,
 	return s.Service.GetView(ctx, videoId)
 }
 
+func (s *ServiceLogging) GetViews(ctx context.Context, ids []string) (views map[string]int, err error) {
+	defer func(begin time.Time) {
+		withCaller(ctx, withRequestID(ctx, s.logger)).Log(
+			"Method", "GetViews",
+			"videoIds", len(ids),
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	return s.Service.GetViews(ctx, ids)
+}
+
+func (s *ServiceLogging) GetRank(ctx context.Context, videoId string) (rank model.Rank, err error) {
+	defer func(begin time.Time) {
+		withCaller(ctx, withRequestID(ctx, s.logger)).Log(
+			"Method", "GetRank",
+			"videoId", videoId,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	return s.Service.GetRank(ctx, videoId)
+}
+
 func (s *ServiceLogging) Increment(ctx context.Context, videoId string) (err error) {
 	defer func(begin time.Time) {
-		s.logger.Log(
+		withCaller(ctx, withRequestID(ctx, s.logger)).Log(
 			"Method", "Increment",
 			"videoId", videoId,
 			"took", time.Since(begin),
@@ -52,10 +99,24 @@ func (s *ServiceLogging) Increment(ctx context.Context, videoId string) (err err
 	return s.Service.Increment(ctx, videoId)
 }
 
-func (s *ServiceLogging) TopVideos(ctx context.Context, num int) (info []model.VideoInfo, err error) {
+func (s *ServiceLogging) IncrementOnce(ctx context.Context, videoId, key string, ttl time.Duration) (replayed bool, err error) {
+	defer func(begin time.Time) {
+		withCaller(ctx, withRequestID(ctx, s.logger)).Log(
+			"Method", "IncrementOnce",
+			"videoId", videoId,
+			"idempotencyKey", key,
+			"replayed", replayed,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	return s.Service.IncrementOnce(ctx, videoId, key, ttl)
+}
+
+func (s *ServiceLogging) GetTopVideos(ctx context.Context, num int) (info []model.VideoInfo, err error) {
 	defer func(begin time.Time) {
-		s.logger.Log(
-			"Method", "TopVideos",
+		withCaller(ctx, withRequestID(ctx, s.logger)).Log(
+			"Method", "GetTopVideos",
 			"Params", num,
 			"took", time.Since(begin),
 			"err", err,
@@ -64,12 +125,12 @@ func (s *ServiceLogging) TopVideos(ctx context.Context, num int) (info []model.V
 	return s.Service.GetTopVideos(ctx, num)
 }
 
-func (s *ServiceLogging) RecentViews(ctx context.Context, num int) (info []model.VideoInfo, err error) {
+func (s *ServiceLogging) GetRecentVideos(ctx context.Context, num int) (info []model.VideoInfo, err error) {
 	defer func(begin time.Time) {
-		s.logger.Log(
-			"Method", "RecentViews",
-			"Params", num, "took",
-			time.Since(begin),
+		withCaller(ctx, withRequestID(ctx, s.logger)).Log(
+			"Method", "GetRecentVideos",
+			"Params", num,
+			"took", time.Since(begin),
 			"err", err,
 		)
 	}(time.Now())
@@ -0,0 +1,55 @@
+package viewservice
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"view_count/auth"
+	"view_count/repository/viewrepository"
+	"view_count/requestid"
+
+	"github.com/go-kit/log"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceLogging(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := viewrepository.NewMockRepository(ctrl)
+	var buf bytes.Buffer
+	svc := NewServiceLogging(log.NewLogfmtLogger(&buf), NewService(mockRepo))
+	ctx := requestid.NewContext(context.Background(), "req-1")
+
+	t.Run("GetTopVideos", func(t *testing.T) {
+		buf.Reset()
+		mockRepo.EXPECT().GetTopVideos(ctx, 3).Return(nil, nil)
+
+		svc.GetTopVideos(ctx, 3)
+
+		assert.Contains(t, buf.String(), "Method=GetTopVideos")
+		assert.Contains(t, buf.String(), "request_id=req-1")
+	})
+
+	t.Run("GetRecentVideos", func(t *testing.T) {
+		buf.Reset()
+		mockRepo.EXPECT().GetRecentVideos(ctx, 3).Return(nil, nil)
+
+		svc.GetRecentVideos(ctx, 3)
+
+		assert.Contains(t, buf.String(), "Method=GetRecentVideos")
+		assert.NotContains(t, buf.String(), "subject=")
+	})
+
+	t.Run("Caller", func(t *testing.T) {
+		buf.Reset()
+		ctx := auth.NewContext(ctx, auth.Principal{Subject: "jwt:alice", Role: auth.RoleAdmin, Tenant: "acme"})
+		mockRepo.EXPECT().GetView(ctx, "video1").Return(3, nil)
+
+		svc.GetView(ctx, "video1")
+
+		assert.Contains(t, buf.String(), "subject=jwt:alice")
+		assert.Contains(t, buf.String(), "tenant=acme")
+	})
+}
@@ -0,0 +1,442 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: viewservice.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ViewService_GetView_FullMethodName         = "/viewcount.v1.ViewService/GetView"
+	ViewService_GetAllViews_FullMethodName     = "/viewcount.v1.ViewService/GetAllViews"
+	ViewService_Increment_FullMethodName       = "/viewcount.v1.ViewService/Increment"
+	ViewService_GetTopVideos_FullMethodName    = "/viewcount.v1.ViewService/GetTopVideos"
+	ViewService_GetRecentVideos_FullMethodName = "/viewcount.v1.ViewService/GetRecentVideos"
+	ViewService_GetViews_FullMethodName        = "/viewcount.v1.ViewService/GetViews"
+	ViewService_GetRank_FullMethodName         = "/viewcount.v1.ViewService/GetRank"
+	ViewService_IngestViews_FullMethodName     = "/viewcount.v1.ViewService/IngestViews"
+	ViewService_WatchTop_FullMethodName        = "/viewcount.v1.ViewService/WatchTop"
+)
+
+// ViewServiceClient is the client API for ViewService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ViewService counts video views. Every RPC is a viewservice.Service method
+// except IngestViews, which increments in bulk, and WatchTop, which
+// streams the most viewed videos.
+type ViewServiceClient interface {
+	GetView(ctx context.Context, in *GetViewRequest, opts ...grpc.CallOption) (*GetViewResponse, error)
+	GetAllViews(ctx context.Context, in *GetAllViewsRequest, opts ...grpc.CallOption) (*VideoList, error)
+	Increment(ctx context.Context, in *IncrementRequest, opts ...grpc.CallOption) (*IncrementResponse, error)
+	GetTopVideos(ctx context.Context, in *GetTopVideosRequest, opts ...grpc.CallOption) (*VideoList, error)
+	GetRecentVideos(ctx context.Context, in *GetRecentVideosRequest, opts ...grpc.CallOption) (*VideoList, error)
+	GetViews(ctx context.Context, in *GetViewsRequest, opts ...grpc.CallOption) (*GetViewsResponse, error)
+	// GetRank fails with NOT_FOUND for videos never viewed.
+	GetRank(ctx context.Context, in *GetRankRequest, opts ...grpc.CallOption) (*GetRankResponse, error)
+	// IngestViews increments once per request received and replies with the
+	// totals when the client closes the stream. Failed increments do not end
+	// the stream, except for authorization failures.
+	IngestViews(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[IncrementRequest, IngestViewsResponse], error)
+	// WatchTop sends the top n videos right away and then whenever they
+	// change, checking every interval_ms.
+	WatchTop(ctx context.Context, in *WatchTopRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[VideoList], error)
+}
+
+type viewServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewViewServiceClient(cc grpc.ClientConnInterface) ViewServiceClient {
+	return &viewServiceClient{cc}
+}
+
+func (c *viewServiceClient) GetView(ctx context.Context, in *GetViewRequest, opts ...grpc.CallOption) (*GetViewResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetViewResponse)
+	err := c.cc.Invoke(ctx, ViewService_GetView_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *viewServiceClient) GetAllViews(ctx context.Context, in *GetAllViewsRequest, opts ...grpc.CallOption) (*VideoList, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(VideoList)
+	err := c.cc.Invoke(ctx, ViewService_GetAllViews_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *viewServiceClient) Increment(ctx context.Context, in *IncrementRequest, opts ...grpc.CallOption) (*IncrementResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(IncrementResponse)
+	err := c.cc.Invoke(ctx, ViewService_Increment_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *viewServiceClient) GetTopVideos(ctx context.Context, in *GetTopVideosRequest, opts ...grpc.CallOption) (*VideoList, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(VideoList)
+	err := c.cc.Invoke(ctx, ViewService_GetTopVideos_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *viewServiceClient) GetRecentVideos(ctx context.Context, in *GetRecentVideosRequest, opts ...grpc.CallOption) (*VideoList, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(VideoList)
+	err := c.cc.Invoke(ctx, ViewService_GetRecentVideos_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *viewServiceClient) GetViews(ctx context.Context, in *GetViewsRequest, opts ...grpc.CallOption) (*GetViewsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetViewsResponse)
+	err := c.cc.Invoke(ctx, ViewService_GetViews_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *viewServiceClient) GetRank(ctx context.Context, in *GetRankRequest, opts ...grpc.CallOption) (*GetRankResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetRankResponse)
+	err := c.cc.Invoke(ctx, ViewService_GetRank_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *viewServiceClient) IngestViews(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[IncrementRequest, IngestViewsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ViewService_ServiceDesc.Streams[0], ViewService_IngestViews_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[IncrementRequest, IngestViewsResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ViewService_IngestViewsClient = grpc.ClientStreamingClient[IncrementRequest, IngestViewsResponse]
+
+func (c *viewServiceClient) WatchTop(ctx context.Context, in *WatchTopRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[VideoList], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ViewService_ServiceDesc.Streams[1], ViewService_WatchTop_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchTopRequest, VideoList]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ViewService_WatchTopClient = grpc.ServerStreamingClient[VideoList]
+
+// ViewServiceServer is the server API for ViewService service.
+// All implementations must embed UnimplementedViewServiceServer
+// for forward compatibility.
+//
+// ViewService counts video views. Every RPC is a viewservice.Service method
+// except IngestViews, which increments in bulk, and WatchTop, which
+// streams the most viewed videos.
+type ViewServiceServer interface {
+	GetView(context.Context, *GetViewRequest) (*GetViewResponse, error)
+	GetAllViews(context.Context, *GetAllViewsRequest) (*VideoList, error)
+	Increment(context.Context, *IncrementRequest) (*IncrementResponse, error)
+	GetTopVideos(context.Context, *GetTopVideosRequest) (*VideoList, error)
+	GetRecentVideos(context.Context, *GetRecentVideosRequest) (*VideoList, error)
+	GetViews(context.Context, *GetViewsRequest) (*GetViewsResponse, error)
+	// GetRank fails with NOT_FOUND for videos never viewed.
+	GetRank(context.Context, *GetRankRequest) (*GetRankResponse, error)
+	// IngestViews increments once per request received and replies with the
+	// totals when the client closes the stream. Failed increments do not end
+	// the stream, except for authorization failures.
+	IngestViews(grpc.ClientStreamingServer[IncrementRequest, IngestViewsResponse]) error
+	// WatchTop sends the top n videos right away and then whenever they
+	// change, checking every interval_ms.
+	WatchTop(*WatchTopRequest, grpc.ServerStreamingServer[VideoList]) error
+	mustEmbedUnimplementedViewServiceServer()
+}
+
+// UnimplementedViewServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedViewServiceServer struct{}
+
+func (UnimplementedViewServiceServer) GetView(context.Context, *GetViewRequest) (*GetViewResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetView not implemented")
+}
+func (UnimplementedViewServiceServer) GetAllViews(context.Context, *GetAllViewsRequest) (*VideoList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAllViews not implemented")
+}
+func (UnimplementedViewServiceServer) Increment(context.Context, *IncrementRequest) (*IncrementResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Increment not implemented")
+}
+func (UnimplementedViewServiceServer) GetTopVideos(context.Context, *GetTopVideosRequest) (*VideoList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTopVideos not implemented")
+}
+func (UnimplementedViewServiceServer) GetRecentVideos(context.Context, *GetRecentVideosRequest) (*VideoList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRecentVideos not implemented")
+}
+func (UnimplementedViewServiceServer) GetViews(context.Context, *GetViewsRequest) (*GetViewsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetViews not implemented")
+}
+func (UnimplementedViewServiceServer) GetRank(context.Context, *GetRankRequest) (*GetRankResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRank not implemented")
+}
+func (UnimplementedViewServiceServer) IngestViews(grpc.ClientStreamingServer[IncrementRequest, IngestViewsResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method IngestViews not implemented")
+}
+func (UnimplementedViewServiceServer) WatchTop(*WatchTopRequest, grpc.ServerStreamingServer[VideoList]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchTop not implemented")
+}
+func (UnimplementedViewServiceServer) mustEmbedUnimplementedViewServiceServer() {}
+func (UnimplementedViewServiceServer) testEmbeddedByValue()                     {}
+
+// UnsafeViewServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ViewServiceServer will
+// result in compilation errors.
+type UnsafeViewServiceServer interface {
+	mustEmbedUnimplementedViewServiceServer()
+}
+
+func RegisterViewServiceServer(s grpc.ServiceRegistrar, srv ViewServiceServer) {
+	// If the following call pancis, it indicates UnimplementedViewServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ViewService_ServiceDesc, srv)
+}
+
+func _ViewService_GetView_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetViewRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ViewServiceServer).GetView(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ViewService_GetView_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ViewServiceServer).GetView(ctx, req.(*GetViewRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ViewService_GetAllViews_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAllViewsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ViewServiceServer).GetAllViews(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ViewService_GetAllViews_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ViewServiceServer).GetAllViews(ctx, req.(*GetAllViewsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ViewService_Increment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IncrementRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ViewServiceServer).Increment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ViewService_Increment_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ViewServiceServer).Increment(ctx, req.(*IncrementRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ViewService_GetTopVideos_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTopVideosRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ViewServiceServer).GetTopVideos(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ViewService_GetTopVideos_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ViewServiceServer).GetTopVideos(ctx, req.(*GetTopVideosRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ViewService_GetRecentVideos_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRecentVideosRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ViewServiceServer).GetRecentVideos(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ViewService_GetRecentVideos_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ViewServiceServer).GetRecentVideos(ctx, req.(*GetRecentVideosRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ViewService_GetViews_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetViewsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ViewServiceServer).GetViews(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ViewService_GetViews_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ViewServiceServer).GetViews(ctx, req.(*GetViewsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ViewService_GetRank_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRankRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ViewServiceServer).GetRank(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ViewService_GetRank_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ViewServiceServer).GetRank(ctx, req.(*GetRankRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ViewService_IngestViews_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ViewServiceServer).IngestViews(&grpc.GenericServerStream[IncrementRequest, IngestViewsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ViewService_IngestViewsServer = grpc.ClientStreamingServer[IncrementRequest, IngestViewsResponse]
+
+func _ViewService_WatchTop_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchTopRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ViewServiceServer).WatchTop(m, &grpc.GenericServerStream[WatchTopRequest, VideoList]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ViewService_WatchTopServer = grpc.ServerStreamingServer[VideoList]
+
+// ViewService_ServiceDesc is the grpc.ServiceDesc for ViewService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ViewService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "viewcount.v1.ViewService",
+	HandlerType: (*ViewServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetView",
+			Handler:    _ViewService_GetView_Handler,
+		},
+		{
+			MethodName: "GetAllViews",
+			Handler:    _ViewService_GetAllViews_Handler,
+		},
+		{
+			MethodName: "Increment",
+			Handler:    _ViewService_Increment_Handler,
+		},
+		{
+			MethodName: "GetTopVideos",
+			Handler:    _ViewService_GetTopVideos_Handler,
+		},
+		{
+			MethodName: "GetRecentVideos",
+			Handler:    _ViewService_GetRecentVideos_Handler,
+		},
+		{
+			MethodName: "GetViews",
+			Handler:    _ViewService_GetViews_Handler,
+		},
+		{
+			MethodName: "GetRank",
+			Handler:    _ViewService_GetRank_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "IngestViews",
+			Handler:       _ViewService_IngestViews_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchTop",
+			Handler:       _ViewService_WatchTop_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "viewservice.proto",
+}
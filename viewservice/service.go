@@ -3,14 +3,24 @@ package viewservice
 import (
 	"context"
 	"errors"
+	"time"
 	"view_count/model"
 	"view_count/repository/viewrepository"
 )
 
 var (
 	ErrInvalidArgument = errors.New("invalid Argument")
+	// ErrVideoNotFound is returned for the rank of a video never viewed.
+	ErrVideoNotFound = viewrepository.ErrVideoIdNotFound
+	// ErrBatchTooLarge is returned by the GetViews endpoint for more ids
+	// than its batch size.
+	ErrBatchTooLarge = errors.New("too many video ids")
 )
 
+// DefaultMaxBatchSize is how many video ids one GetViews call made through
+// a transport may ask for when not configured otherwise.
+const DefaultMaxBatchSize = 100
+
 // TODO add middleware of Service for logging and instrumenting : done
 // Validataion, Coordinator
 
@@ -19,13 +29,27 @@ type Service interface {
 	GetAllViews(ctx context.Context) (info []model.VideoInfo, err error)
 
 	// Increment will increment view count of given videoId.
-	// it will return ErrInvalidArgument if videoId is empty
+	// it will return ErrInvalidArgument if videoId is empty.
 	Increment(ctx context.Context, videoId string) (err error)
 
+	// IncrementOnce is an Increment that is safe to retry: of all calls
+	// with the same key within ttl, or DefaultIdempotencyTTL if ttl is 0,
+	// only the first counts a view and the others report replayed. It
+	// returns ErrIdempotencyKeyReused if key was used for another video.
+	IncrementOnce(ctx context.Context, videoId, key string, ttl time.Duration) (replayed bool, err error)
+
 	GetView(ctx context.Context, videoId string) (view int, err error)
 
+	// GetViews returns the views of every video in ids, with 0 for videos
+	// never viewed. It returns ErrInvalidArgument if an id is empty.
+	GetViews(ctx context.Context, ids []string) (views map[string]int, err error)
+
 	GetTopVideos(ctx context.Context, n int) (info []model.VideoInfo, err error)
 
+	// GetRank returns the place of videoId in the all-time leaderboard. It
+	// returns ErrVideoNotFound if the video was never viewed.
+	GetRank(ctx context.Context, videoId string) (rank model.Rank, err error)
+
 	GetRecentVideos(ctx context.Context, n int) (info []model.VideoInfo, err error)
 }
 
@@ -53,6 +77,20 @@ func (svc *service) Increment(ctx context.Context, videoId string) (err error) {
 	return svc.viewRepo.Increment(ctx, videoId)
 }
 
+func (svc *service) IncrementOnce(ctx context.Context, videoId, key string, ttl time.Duration) (replayed bool, err error) {
+	if len(videoId) < 1 || len(key) < 1 {
+		return false, ErrInvalidArgument
+	}
+	repo, ok := svc.viewRepo.(viewrepository.IdempotentIncrementer)
+	if !ok {
+		return false, viewrepository.ErrIdempotencyUnsupported
+	}
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	return repo.IncrementOnce(ctx, videoId, key, ttl)
+}
+
 func (svc *service) GetView(ctx context.Context, videoId string) (view int, err error) {
 	if len(videoId) < 1 {
 		return 0, ErrInvalidArgument
@@ -61,6 +99,25 @@ func (svc *service) GetView(ctx context.Context, videoId string) (view int, err
 	return svc.viewRepo.GetView(ctx, videoId)
 }
 
+func (svc *service) GetViews(ctx context.Context, ids []string) (views map[string]int, err error) {
+	for _, id := range ids {
+		if len(id) < 1 {
+			return nil, ErrInvalidArgument
+		}
+	}
+	if len(ids) == 0 {
+		return map[string]int{}, nil
+	}
+	return svc.viewRepo.GetViews(ctx, ids)
+}
+
+func (svc *service) GetRank(ctx context.Context, videoId string) (rank model.Rank, err error) {
+	if len(videoId) < 1 {
+		return model.Rank{}, ErrInvalidArgument
+	}
+	return svc.viewRepo.GetRank(ctx, videoId)
+}
+
 func (svc *service) GetTopVideos(ctx context.Context, n int) (info []model.VideoInfo, err error) {
 	if n < 0 {
 		return nil, ErrInvalidArgument
@@ -59,6 +59,63 @@ func TestGetViews(t *testing.T) {
 
 }
 
+func TestGetViewsBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := viewrepository.NewMockRepository(ctrl)
+
+	svc := NewService(mockRepo)
+
+	t.Run("Valid", func(t *testing.T) {
+		ids := []string{"video1", "video2"}
+		want := map[string]int{"video1": 3, "video2": 0}
+		mockRepo.EXPECT().GetViews(context.Background(), ids).Return(want, nil)
+		result, err := svc.GetViews(context.Background(), ids)
+		assert.NoError(t, err)
+		assert.Equal(t, want, result)
+	})
+
+	t.Run("No ids", func(t *testing.T) {
+		result, err := svc.GetViews(context.Background(), nil)
+		assert.NoError(t, err)
+		assert.Empty(t, result)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := svc.GetViews(context.Background(), []string{"video1", ""})
+		assert.Equal(t, ErrInvalidArgument, err)
+	})
+}
+
+func TestGetRank(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := viewrepository.NewMockRepository(ctrl)
+
+	svc := NewService(mockRepo)
+
+	t.Run("Valid", func(t *testing.T) {
+		want := model.Rank{Id: "video1", Views: 5, Position: 2, Ties: 1}
+		mockRepo.EXPECT().GetRank(context.Background(), "video1").Return(want, nil)
+		result, err := svc.GetRank(context.Background(), "video1")
+		assert.NoError(t, err)
+		assert.Equal(t, want, result)
+	})
+
+	t.Run("Never viewed", func(t *testing.T) {
+		mockRepo.EXPECT().GetRank(context.Background(), "video2").Return(model.Rank{}, viewrepository.ErrVideoIdNotFound)
+		_, err := svc.GetRank(context.Background(), "video2")
+		assert.Equal(t, ErrVideoNotFound, err)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := svc.GetRank(context.Background(), "")
+		assert.Equal(t, ErrInvalidArgument, err)
+	})
+}
+
 func TestGetAllViews(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -121,6 +178,45 @@ func TestIncrement(t *testing.T) {
 	}
 }
 
+func TestIncrementIdempotent(t *testing.T) {
+	svc := NewService(viewrepository.NewInmemoryRepo())
+
+	for i, wantReplayed := range []bool{false, true} {
+		replayed, err := svc.IncrementOnce(context.Background(), "video1", "key1", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, wantReplayed, replayed, "call %d", i)
+	}
+	views, _ := svc.GetView(context.Background(), "video1")
+	assert.Equal(t, 1, views)
+
+	_, err := svc.IncrementOnce(context.Background(), "video2", "key1", 0)
+	assert.Equal(t, ErrIdempotencyKeyReused, err)
+
+	_, err = svc.IncrementOnce(context.Background(), "video1", "", 0)
+	assert.Equal(t, ErrInvalidArgument, err)
+
+	t.Run("Repository without idempotency support", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		svc := NewService(viewrepository.NewMockRepository(ctrl))
+
+		_, err := svc.IncrementOnce(context.Background(), "video1", "key1", 0)
+		assert.Equal(t, viewrepository.ErrIdempotencyUnsupported, err)
+	})
+
+	t.Run("Zero TTLs use the default", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		repo := struct {
+			*viewrepository.MockRepository
+			*viewrepository.MockIdempotentIncrementer
+		}{viewrepository.NewMockRepository(ctrl), viewrepository.NewMockIdempotentIncrementer(ctrl)}
+		repo.MockIdempotentIncrementer.EXPECT().IncrementOnce(gomock.Any(), "video1", "key1", DefaultIdempotencyTTL).Return(true, nil)
+
+		replayed, err := NewService(repo).IncrementOnce(context.Background(), "video1", "key1", 0)
+		assert.NoError(t, err)
+		assert.True(t, replayed)
+	})
+}
+
 func TestGetTopVideos(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -0,0 +1,100 @@
+package viewservice
+
+import (
+	"context"
+	"time"
+	"view_count/model"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type tracingService struct {
+	tracer trace.Tracer
+	Service
+}
+
+// NewServiceTracing returns a Service that records a span for every call.
+func NewServiceTracing(tracer trace.Tracer, s Service) Service {
+	return &tracingService{tracer, s}
+}
+
+func (s *tracingService) start(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return s.tracer.Start(ctx, "viewservice."+method, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (s *tracingService) GetAllViews(ctx context.Context) (info []model.VideoInfo, err error) {
+	ctx, span := s.start(ctx, "GetAllViews")
+	defer func() {
+		span.SetAttributes(attribute.Int("videos.count", len(info)))
+		endSpan(span, err)
+	}()
+	return s.Service.GetAllViews(ctx)
+}
+
+func (s *tracingService) Increment(ctx context.Context, videoId string) (err error) {
+	ctx, span := s.start(ctx, "Increment", attribute.String("video.id", videoId))
+	defer func() { endSpan(span, err) }()
+	return s.Service.Increment(ctx, videoId)
+}
+
+func (s *tracingService) IncrementOnce(ctx context.Context, videoId, key string, ttl time.Duration) (replayed bool, err error) {
+	ctx, span := s.start(ctx, "IncrementOnce", attribute.String("video.id", videoId))
+	defer func() {
+		span.SetAttributes(attribute.Bool("idempotency.replayed", replayed))
+		endSpan(span, err)
+	}()
+	return s.Service.IncrementOnce(ctx, videoId, key, ttl)
+}
+
+func (s *tracingService) GetView(ctx context.Context, videoId string) (view int, err error) {
+	ctx, span := s.start(ctx, "GetView", attribute.String("video.id", videoId))
+	defer func() {
+		span.SetAttributes(attribute.Int("video.views", view))
+		endSpan(span, err)
+	}()
+	return s.Service.GetView(ctx, videoId)
+}
+
+func (s *tracingService) GetViews(ctx context.Context, ids []string) (views map[string]int, err error) {
+	ctx, span := s.start(ctx, "GetViews", attribute.Int("videos.count", len(ids)))
+	defer func() { endSpan(span, err) }()
+	return s.Service.GetViews(ctx, ids)
+}
+
+func (s *tracingService) GetRank(ctx context.Context, videoId string) (rank model.Rank, err error) {
+	ctx, span := s.start(ctx, "GetRank", attribute.String("video.id", videoId))
+	defer func() {
+		span.SetAttributes(attribute.Int("video.rank", rank.Position))
+		endSpan(span, err)
+	}()
+	return s.Service.GetRank(ctx, videoId)
+}
+
+func (s *tracingService) GetTopVideos(ctx context.Context, n int) (info []model.VideoInfo, err error) {
+	ctx, span := s.start(ctx, "GetTopVideos", attribute.Int("n", n))
+	defer func() {
+		span.SetAttributes(attribute.Int("videos.count", len(info)))
+		endSpan(span, err)
+	}()
+	return s.Service.GetTopVideos(ctx, n)
+}
+
+func (s *tracingService) GetRecentVideos(ctx context.Context, n int) (info []model.VideoInfo, err error) {
+	ctx, span := s.start(ctx, "GetRecentVideos", attribute.Int("n", n))
+	defer func() {
+		span.SetAttributes(attribute.Int("videos.count", len(info)))
+		endSpan(span, err)
+	}()
+	return s.Service.GetRecentVideos(ctx, n)
+}
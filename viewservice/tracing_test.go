@@ -0,0 +1,54 @@
+package viewservice
+
+import (
+	"context"
+	"testing"
+	"view_count/model"
+	"view_count/repository/viewrepository"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestServiceTracing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := viewrepository.NewMockRepository(ctrl)
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	svc := NewServiceTracing(tp.Tracer("test"), NewService(mockRepo))
+
+	t.Run("GetTopVideos", func(t *testing.T) {
+		mockRepo.EXPECT().GetTopVideos(gomock.Any(), 2).Return([]model.VideoInfo{
+			{Id: "video1", Views: 2},
+			{Id: "video2", Views: 1},
+		}, nil)
+
+		_, err := svc.GetTopVideos(context.Background(), 2)
+		require.NoError(t, err)
+
+		spans := recorder.Ended()
+		require.NotEmpty(t, spans)
+		span := spans[len(spans)-1]
+		assert.Equal(t, "viewservice.GetTopVideos", span.Name())
+		assert.Contains(t, span.Attributes(), attribute.Int("n", 2))
+		assert.Contains(t, span.Attributes(), attribute.Int("videos.count", 2))
+	})
+
+	t.Run("Errors are recorded", func(t *testing.T) {
+		err := svc.Increment(context.Background(), "")
+		assert.Equal(t, ErrInvalidArgument, err)
+
+		spans := recorder.Ended()
+		span := spans[len(spans)-1]
+		assert.Equal(t, "viewservice.Increment", span.Name())
+		assert.Equal(t, codes.Error, span.Status().Code)
+	})
+}
@@ -3,8 +3,15 @@ package viewservice
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"view_count/auth"
+	"view_count/middleware"
+	"view_count/model"
+	"view_count/openapi"
 
 	kitlog "github.com/go-kit/kit/log"
 	kithttp "github.com/go-kit/kit/transport/http"
@@ -14,43 +21,89 @@ import (
 // TODO: write gokit client also
 
 // Write unit test cases. Hint: use httptest package : done
-func MakeHandler(endpoints Endpoints, logger kitlog.Logger) http.Handler {
+// MakeHandler serves endpoints and their OpenAPI document; opts apply to
+// every endpoint, e.g. a ServerBefore with auth's HTTPToContext for
+// AuthorizeEndpoints.
+func MakeHandler(endpoints Endpoints, logger kitlog.Logger, opts ...kithttp.ServerOption) http.Handler {
 	r := mux.NewRouter()
+	opts = append([]kithttp.ServerOption{
+		kithttp.ServerErrorEncoder(encodeError),
+		kithttp.ServerBefore(kithttp.PopulateRequestContext),
+	}, opts...)
+	r.Use(middleware.RequestID, middleware.Tracing)
 
 	r.Handle("/", kithttp.NewServer(
 		endpoints.GetAllViews,
 		decodeGetAllViewsRequest,
 		encodeResponse,
+		opts...,
 	)).Methods("GET")
 
 	r.Handle("/views/{id}", kithttp.NewServer(
 		endpoints.GetView,
 		decodeGetViewRequest,
 		encodeResponse,
+		opts...,
 	)).Methods("GET")
 
+	r.Handle("/views", kithttp.NewServer(
+		endpoints.GetViews,
+		decodeGetViewsRequest,
+		encodeResponse,
+		opts...,
+	)).Methods("GET")
+
+	r.Handle("/views:batch", kithttp.NewServer(
+		endpoints.GetViews,
+		decodeGetViewsBatchRequest,
+		encodeResponse,
+		opts...,
+	)).Methods("POST")
+
 	r.Handle("/increment/{id}", kithttp.NewServer(
 		endpoints.Increment,
 		decodeIncrementRequest,
 		encodeResponse,
+		opts...,
 	)).Methods("POST")
 
 	r.Handle("/top/{n}", kithttp.NewServer(
 		endpoints.GetTopVideos,
 		decodeGetTopVideosRequest,
 		encodeResponse,
+		opts...,
 	)).Methods("GET")
 
 	r.Handle("/recent/{n}", kithttp.NewServer(
 		endpoints.GetRecentVideos,
 		decodeGetRecentVideosRequest,
 		encodeResponse,
+		opts...,
 	)).Methods("GET")
 
+	r.Handle("/rank/{id}", kithttp.NewServer(
+		endpoints.GetRank,
+		decodeGetRankRequest,
+		encodeResponse,
+		opts...,
+	)).Methods("GET")
+
+	openapi.Register(r, openapi.ViewService)
+
 	return r
 }
 
+// listEncoders encode the responses of the list endpoints, JSON by
+// default.
+var listEncoders = ListEncoders(Encoder{"application/json; charset=utf-8", func(w io.Writer, videos []model.VideoInfo) error {
+	return json.NewEncoder(w).Encode(getAllViewsResponse{Videos: videos})
+}})
+
 func encodeResponse(ctx context.Context, w http.ResponseWriter, response any) error {
+	if videos, ok := listedVideos(response); ok {
+		accept, _ := ctx.Value(kithttp.ContextKeyRequestAccept).(string)
+		return listEncoders.Write(w, accept, videos)
+	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	if err, ok := response.(error); ok && err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -61,6 +114,35 @@ func encodeResponse(ctx context.Context, w http.ResponseWriter, response any) er
 	return json.NewEncoder(w).Encode(response)
 }
 
+// encodeError replies to errors returned by endpoints, with 401 and 403 for
+// those of auth.Authorize, 403 for rejected view tokens, 400 for invalid
+// arguments and batches that are too large, 404 for unranked videos and
+// 422 for idempotency keys reused for another video.
+func encodeError(ctx context.Context, err error, w http.ResponseWriter) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, auth.ErrUnauthenticated):
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		status = http.StatusUnauthorized
+	case errors.Is(err, auth.ErrForbidden),
+		errors.Is(err, ErrViewTokenRequired),
+		errors.Is(err, ErrViewTokenInvalid),
+		errors.Is(err, ErrViewTokenReplayed):
+		status = http.StatusForbidden
+	case errors.Is(err, ErrInvalidArgument), errors.Is(err, ErrBatchTooLarge):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrVideoNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrIdempotencyKeyReused):
+		status = http.StatusUnprocessableEntity
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
 func decodeGetViewRequest(_ context.Context, r *http.Request) (any, error) {
 	vars := mux.Vars(r)
 	// Validatiaons should be at service level
@@ -68,6 +150,24 @@ func decodeGetViewRequest(_ context.Context, r *http.Request) (any, error) {
 	return getViewRequest{videoId: videoId}, nil
 }
 
+func decodeGetRankRequest(_ context.Context, r *http.Request) (any, error) {
+	return getRankRequest{videoId: mux.Vars(r)["id"]}, nil
+}
+
+func decodeGetViewsRequest(_ context.Context, r *http.Request) (any, error) {
+	return getViewsRequest{Ids: r.URL.Query()["id"]}, nil
+}
+
+// decodeGetViewsBatchRequest reads the ids from a JSON body, for lists too
+// long for a URL.
+func decodeGetViewsBatchRequest(_ context.Context, r *http.Request) (any, error) {
+	var req getViewsRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+	}
+	return req, nil
+}
+
 func decodeGetAllViewsRequest(_ context.Context, r *http.Request) (any, error) {
 	return nil, nil
 }
@@ -75,7 +175,15 @@ func decodeGetAllViewsRequest(_ context.Context, r *http.Request) (any, error) {
 func decodeIncrementRequest(_ context.Context, r *http.Request) (any, error) {
 	vars := mux.Vars(r)
 	videoId := vars["id"]
-	return incrementRequest{videoId: videoId}, nil
+	key := r.Header.Get("Idempotency-Key")
+	if key != "" && !ValidIdempotencyKey(key) {
+		return nil, fmt.Errorf("%w: Idempotency-Key must be 1 to 255 printable ASCII characters", ErrInvalidArgument)
+	}
+	return incrementRequest{
+		videoId:        videoId,
+		idempotencyKey: key,
+		viewToken:      ViewTokenFromRequest(r),
+	}, nil
 }
 
 func decodeGetRecentVideosRequest(_ context.Context, r *http.Request) (any, error) {
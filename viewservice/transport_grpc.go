@@ -0,0 +1,303 @@
+package viewservice
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+	"view_count/auth"
+	"view_count/model"
+	"view_count/viewservice/pb"
+
+	kitgrpc "github.com/go-kit/kit/transport/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// GRPCConfig configures the streaming RPCs of a GRPCServer.
+type GRPCConfig struct {
+	// MinWatchInterval is the shortest interval WatchTop polls at.
+	MinWatchInterval time.Duration
+	// MaxWatchN is the largest n WatchTop accepts.
+	MaxWatchN int
+}
+
+// GRPCServer serves endpoints over gRPC. Unary RPCs go through go-kit's
+// gRPC transport; the streaming ones call the endpoints once per message.
+type GRPCServer struct {
+	pb.UnimplementedViewServiceServer
+
+	getView         kitgrpc.Handler
+	getAllViews     kitgrpc.Handler
+	increment       kitgrpc.Handler
+	getTopVideos    kitgrpc.Handler
+	getRecentVideos kitgrpc.Handler
+	getViews        kitgrpc.Handler
+	getRank         kitgrpc.Handler
+
+	endpoints Endpoints
+	cfg       GRPCConfig
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// NewGRPCServer returns a server for endpoints; opts apply to every unary
+// RPC.
+func NewGRPCServer(endpoints Endpoints, cfg GRPCConfig, opts ...kitgrpc.ServerOption) *GRPCServer {
+	return &GRPCServer{
+		getView:         kitgrpc.NewServer(endpoints.GetView, decodeGRPCGetViewRequest, encodeGRPCGetViewResponse, opts...),
+		getAllViews:     kitgrpc.NewServer(endpoints.GetAllViews, decodeGRPCGetAllViewsRequest, encodeGRPCVideoList, opts...),
+		increment:       kitgrpc.NewServer(endpoints.Increment, decodeGRPCIncrementRequest, encodeGRPCIncrementResponse, opts...),
+		getTopVideos:    kitgrpc.NewServer(endpoints.GetTopVideos, decodeGRPCGetTopVideosRequest, encodeGRPCVideoList, opts...),
+		getRecentVideos: kitgrpc.NewServer(endpoints.GetRecentVideos, decodeGRPCGetRecentVideosRequest, encodeGRPCVideoList, opts...),
+		getViews:        kitgrpc.NewServer(endpoints.GetViews, decodeGRPCGetViewsRequest, encodeGRPCGetViewsResponse, opts...),
+		getRank:         kitgrpc.NewServer(endpoints.GetRank, decodeGRPCGetRankRequest, encodeGRPCGetRankResponse, opts...),
+		endpoints:       endpoints,
+		cfg:             cfg,
+		closed:          make(chan struct{}),
+	}
+}
+
+// Close ends every WatchTop stream, which would otherwise keep a graceful
+// stop waiting forever, and refuses new ones.
+func (s *GRPCServer) Close() {
+	s.closeOnce.Do(func() { close(s.closed) })
+}
+
+func (s *GRPCServer) GetView(ctx context.Context, req *pb.GetViewRequest) (*pb.GetViewResponse, error) {
+	_, res, err := s.getView.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return res.(*pb.GetViewResponse), nil
+}
+
+func (s *GRPCServer) GetAllViews(ctx context.Context, req *pb.GetAllViewsRequest) (*pb.VideoList, error) {
+	_, res, err := s.getAllViews.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return res.(*pb.VideoList), nil
+}
+
+func (s *GRPCServer) Increment(ctx context.Context, req *pb.IncrementRequest) (*pb.IncrementResponse, error) {
+	_, res, err := s.increment.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return res.(*pb.IncrementResponse), nil
+}
+
+func (s *GRPCServer) GetTopVideos(ctx context.Context, req *pb.GetTopVideosRequest) (*pb.VideoList, error) {
+	_, res, err := s.getTopVideos.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return res.(*pb.VideoList), nil
+}
+
+func (s *GRPCServer) GetRecentVideos(ctx context.Context, req *pb.GetRecentVideosRequest) (*pb.VideoList, error) {
+	_, res, err := s.getRecentVideos.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return res.(*pb.VideoList), nil
+}
+
+func (s *GRPCServer) GetViews(ctx context.Context, req *pb.GetViewsRequest) (*pb.GetViewsResponse, error) {
+	_, res, err := s.getViews.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return res.(*pb.GetViewsResponse), nil
+}
+
+func (s *GRPCServer) GetRank(ctx context.Context, req *pb.GetRankRequest) (*pb.GetRankResponse, error) {
+	_, res, err := s.getRank.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return res.(*pb.GetRankResponse), nil
+}
+
+func (s *GRPCServer) IngestViews(stream pb.ViewService_IngestViewsServer) error {
+	ctx := stream.Context()
+	var res pb.IngestViewsResponse
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&res)
+		}
+		if err != nil {
+			return err
+		}
+
+		req, _ := decodeGRPCIncrementRequest(ctx, msg)
+		out, err := s.endpoints.Increment(ctx, req)
+		switch {
+		case err == nil && out.(incrementResponse).Replayed:
+			res.Replayed++
+		case err == nil:
+			res.Accepted++
+		case errors.Is(err, auth.ErrUnauthenticated), errors.Is(err, auth.ErrForbidden):
+			return grpcError(err)
+		default:
+			res.Failed++
+		}
+	}
+}
+
+func (s *GRPCServer) WatchTop(req *pb.WatchTopRequest, stream pb.ViewService_WatchTopServer) error {
+	n := int(req.GetN())
+	if n < 1 || n > s.cfg.MaxWatchN {
+		return status.Errorf(codes.InvalidArgument, "n must be between 1 and %d", s.cfg.MaxWatchN)
+	}
+	interval := max(time.Duration(req.GetIntervalMs())*time.Millisecond, s.cfg.MinWatchInterval)
+
+	ctx := stream.Context()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last *pb.VideoList
+	for {
+		select {
+		case <-s.closed:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		default:
+		}
+
+		res, err := s.endpoints.GetTopVideos(ctx, getTopVideosRequest{n: n})
+		if err != nil {
+			return grpcError(err)
+		}
+		encoded, _ := encodeGRPCVideoList(ctx, res)
+		if list := encoded.(*pb.VideoList); last == nil || !proto.Equal(last, list) {
+			if err := stream.Send(list); err != nil {
+				return err
+			}
+			last = list
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.closed:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case <-ticker.C:
+		}
+	}
+}
+
+// grpcError converts errors returned by endpoints to gRPC statuses. Errors
+// that carry a status already, such as rate limits, keep it.
+func grpcError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	code := codes.Internal
+	switch {
+	case errors.Is(err, ErrInvalidArgument), errors.Is(err, ErrBatchTooLarge):
+		code = codes.InvalidArgument
+	case errors.Is(err, ErrVideoNotFound):
+		code = codes.NotFound
+	case errors.Is(err, auth.ErrUnauthenticated):
+		code = codes.Unauthenticated
+	case errors.Is(err, auth.ErrForbidden),
+		errors.Is(err, ErrViewTokenRequired),
+		errors.Is(err, ErrViewTokenInvalid),
+		errors.Is(err, ErrViewTokenReplayed):
+		code = codes.PermissionDenied
+	case errors.Is(err, ErrIdempotencyKeyReused):
+		code = codes.FailedPrecondition
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	}
+	return status.Error(code, err.Error())
+}
+
+func decodeGRPCGetViewRequest(_ context.Context, grpcReq any) (any, error) {
+	req := grpcReq.(*pb.GetViewRequest)
+	return getViewRequest{videoId: req.GetVideoId()}, nil
+}
+
+func encodeGRPCGetViewResponse(_ context.Context, response any) (any, error) {
+	res := response.(getViewResponse)
+	return &pb.GetViewResponse{Views: int64(res.Views)}, nil
+}
+
+func decodeGRPCGetAllViewsRequest(_ context.Context, _ any) (any, error) {
+	return nil, nil
+}
+
+func decodeGRPCIncrementRequest(_ context.Context, grpcReq any) (any, error) {
+	req := grpcReq.(*pb.IncrementRequest)
+	return incrementRequest{
+		videoId:        req.GetVideoId(),
+		idempotencyKey: req.GetIdempotencyKey(),
+		viewToken:      req.GetViewToken(),
+		viewerIP:       req.GetViewerIp(),
+	}, nil
+}
+
+func encodeGRPCIncrementResponse(_ context.Context, response any) (any, error) {
+	res := response.(incrementResponse)
+	return &pb.IncrementResponse{Replayed: res.Replayed}, nil
+}
+
+func decodeGRPCGetTopVideosRequest(_ context.Context, grpcReq any) (any, error) {
+	req := grpcReq.(*pb.GetTopVideosRequest)
+	return getTopVideosRequest{n: int(req.GetN())}, nil
+}
+
+func decodeGRPCGetRecentVideosRequest(_ context.Context, grpcReq any) (any, error) {
+	req := grpcReq.(*pb.GetRecentVideosRequest)
+	return getRecentVideosRequest{n: int(req.GetN())}, nil
+}
+
+func decodeGRPCGetViewsRequest(_ context.Context, grpcReq any) (any, error) {
+	req := grpcReq.(*pb.GetViewsRequest)
+	return getViewsRequest{Ids: req.GetVideoIds()}, nil
+}
+
+func encodeGRPCGetViewsResponse(_ context.Context, response any) (any, error) {
+	res := response.(getViewsResponse)
+	views := make(map[string]int64, len(res.Views))
+	for id, n := range res.Views {
+		views[id] = int64(n)
+	}
+	return &pb.GetViewsResponse{Views: views}, nil
+}
+
+func decodeGRPCGetRankRequest(_ context.Context, grpcReq any) (any, error) {
+	req := grpcReq.(*pb.GetRankRequest)
+	return getRankRequest{videoId: req.GetVideoId()}, nil
+}
+
+func encodeGRPCGetRankResponse(_ context.Context, response any) (any, error) {
+	res := response.(getRankResponse)
+	return &pb.GetRankResponse{
+		VideoId:  res.Id,
+		Views:    int64(res.Views),
+		Position: int64(res.Position),
+		Ties:     int64(res.Ties),
+	}, nil
+}
+
+// encodeGRPCVideoList encodes the response of every endpoint returning
+// videos.
+func encodeGRPCVideoList(_ context.Context, response any) (any, error) {
+	videos, _ := listedVideos(response)
+	return toPBVideoList(videos), nil
+}
+
+func toPBVideoList(videos []model.VideoInfo) *pb.VideoList {
+	list := &pb.VideoList{Videos: make([]*pb.Video, len(videos))}
+	for i, v := range videos {
+		list.Videos[i] = &pb.Video{Id: v.Id, Views: int64(v.Views)}
+	}
+	return list
+}
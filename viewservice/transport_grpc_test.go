@@ -0,0 +1,216 @@
+package viewservice
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+	"view_count/auth"
+	"view_count/model"
+	"view_count/repository/apikeyrepository"
+	"view_count/repository/viewrepository"
+	"view_count/viewservice/pb"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dialGRPC serves server over an in-memory connection and returns a client.
+func dialGRPC(t *testing.T, server *GRPCServer, opts ...grpc.ServerOption) pb.ViewServiceClient {
+	t.Helper()
+	ln := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(opts...)
+	pb.RegisterViewServiceServer(srv, server)
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewViewServiceClient(conn)
+}
+
+var testGRPCConfig = GRPCConfig{MinWatchInterval: 10 * time.Millisecond, MaxWatchN: 100}
+
+func TestGRPCTransport(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService(viewrepository.NewInmemoryRepo())
+	client := dialGRPC(t, NewGRPCServer(MakeEndpoints(svc), testGRPCConfig))
+
+	t.Run("Unary", func(t *testing.T) {
+		for _, id := range []string{"video1", "video1", "video2"} {
+			res, err := client.Increment(ctx, &pb.IncrementRequest{VideoId: id})
+			require.NoError(t, err)
+			assert.False(t, res.Replayed)
+		}
+
+		view, err := client.GetView(ctx, &pb.GetViewRequest{VideoId: "video1"})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), view.Views)
+
+		top, err := client.GetTopVideos(ctx, &pb.GetTopVideosRequest{N: 1})
+		require.NoError(t, err)
+		require.Len(t, top.Videos, 1)
+		assert.Equal(t, "video1", top.Videos[0].Id)
+
+		recent, err := client.GetRecentVideos(ctx, &pb.GetRecentVideosRequest{N: 2})
+		require.NoError(t, err)
+		assert.Len(t, recent.Videos, 2)
+
+		all, err := client.GetAllViews(ctx, &pb.GetAllViewsRequest{})
+		require.NoError(t, err)
+		assert.Len(t, all.Videos, 2)
+
+		views, err := client.GetViews(ctx, &pb.GetViewsRequest{VideoIds: []string{"video1", "video2", "unseen"}})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int64{"video1": 2, "video2": 1, "unseen": 0}, views.Views)
+		_, err = client.GetViews(ctx, &pb.GetViewsRequest{VideoIds: make([]string, DefaultMaxBatchSize+1)})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		rank, err := client.GetRank(ctx, &pb.GetRankRequest{VideoId: "video2"})
+		require.NoError(t, err)
+		assert.Equal(t, "video2", rank.VideoId)
+		assert.Equal(t, int64(1), rank.Views)
+		assert.Equal(t, int64(2), rank.Position)
+		assert.Equal(t, int64(0), rank.Ties)
+		_, err = client.GetRank(ctx, &pb.GetRankRequest{VideoId: "unseen"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+
+		_, err = client.Increment(ctx, &pb.IncrementRequest{})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("IngestViews", func(t *testing.T) {
+		stream, err := client.IngestViews(ctx)
+		require.NoError(t, err)
+		for _, req := range []*pb.IncrementRequest{
+			{VideoId: "bulk1", IdempotencyKey: "k1"},
+			{VideoId: "bulk1", IdempotencyKey: "k1"},
+			{VideoId: "bulk2"},
+			{VideoId: ""},
+		} {
+			require.NoError(t, stream.Send(req))
+		}
+		res, err := stream.CloseAndRecv()
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), res.Accepted)
+		assert.Equal(t, int64(1), res.Replayed)
+		assert.Equal(t, int64(1), res.Failed)
+
+		views, err := svc.GetView(ctx, "bulk1")
+		require.NoError(t, err)
+		assert.Equal(t, 1, views)
+	})
+
+	t.Run("WatchTop", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stream, err := client.WatchTop(ctx, &pb.WatchTopRequest{N: 1})
+		require.NoError(t, err)
+
+		first, err := stream.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, "video1", first.Videos[0].Id)
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, svc.Increment(ctx, "video3"))
+		}
+		next, err := stream.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, "video3", next.Videos[0].Id)
+
+		invalid, err := client.WatchTop(ctx, &pb.WatchTopRequest{N: 0})
+		require.NoError(t, err)
+		_, err = invalid.Recv()
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func TestGRPCWatchTopClose(t *testing.T) {
+	server := NewGRPCServer(MakeEndpoints(NewService(viewrepository.NewInmemoryRepo())), testGRPCConfig)
+	client := dialGRPC(t, server)
+
+	stream, err := client.WatchTop(context.Background(), &pb.WatchTopRequest{N: 1})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.NoError(t, err)
+
+	server.Close()
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestGRPCAuthorization(t *testing.T) {
+	ctx := context.Background()
+	repo := apikeyrepository.NewInmemoryRepo()
+	key, err := auth.GenerateKey()
+	require.NoError(t, err)
+	_, err = repo.CreateAPIKey(ctx, model.APIKey{Role: string(auth.RoleWriter), Hash: auth.HashKey(key)})
+	require.NoError(t, err)
+	authn := auth.NewAuthenticator(repo, log.NewNopLogger())
+
+	endpoints := AuthorizeEndpoints(MakeEndpoints(NewService(viewrepository.NewInmemoryRepo())), auth.DefaultPolicy)
+	client := dialGRPC(t, NewGRPCServer(endpoints, testGRPCConfig),
+		grpc.UnaryInterceptor(authn.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(authn.StreamServerInterceptor()),
+	)
+
+	_, err = client.GetView(ctx, &pb.GetViewRequest{VideoId: "video1"})
+	assert.NoError(t, err, "reads are public")
+
+	_, err = client.Increment(ctx, &pb.IncrementRequest{VideoId: "video1"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	stream, err := client.IngestViews(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&pb.IncrementRequest{VideoId: "video1"}))
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	authed := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+key)
+	_, err = client.Increment(authed, &pb.IncrementRequest{VideoId: "video1"})
+	assert.NoError(t, err)
+
+	stream, err = client.IngestViews(authed)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&pb.IncrementRequest{VideoId: "video1"}))
+	res, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Accepted)
+}
+
+// tokenRecorder records the view token and relayed viewer of each Increment.
+type tokenRecorder struct {
+	tokens, viewers []string
+	Service
+}
+
+func (s *tokenRecorder) Increment(ctx context.Context, videoId string) error {
+	viewer, _ := TokenViewerFromContext(ctx)
+	s.tokens = append(s.tokens, ViewTokenFromContext(ctx))
+	s.viewers = append(s.viewers, viewer)
+	return s.Service.Increment(ctx, videoId)
+}
+
+func TestGRPCRelayedViewer(t *testing.T) {
+	svc := &tokenRecorder{Service: NewService(viewrepository.NewInmemoryRepo())}
+	client := dialGRPC(t, NewGRPCServer(MakeEndpoints(svc), testGRPCConfig))
+
+	_, err := client.Increment(context.Background(), &pb.IncrementRequest{VideoId: "video1", ViewToken: "token1", ViewerIp: "198.51.100.9"})
+	require.NoError(t, err)
+	_, err = client.Increment(context.Background(), &pb.IncrementRequest{VideoId: "video1"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"token1", ""}, svc.tokens)
+	assert.Equal(t, []string{"198.51.100.9", ""}, svc.viewers)
+}
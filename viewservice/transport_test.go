@@ -5,12 +5,21 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"view_count/auth"
 	"view_count/model"
+	"view_count/openapi"
+	"view_count/openapi/openapitest"
+	"view_count/repository/apikeyrepository"
+	"view_count/repository/viewrepository"
 
 	"github.com/go-kit/kit/endpoint"
 	kitlog "github.com/go-kit/kit/log"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/go-kit/log"
 	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -88,6 +97,35 @@ func TestTransport(t *testing.T) {
 		assert.Equal(t, http.StatusOK, res.StatusCode)
 	})
 
+	t.Run("Authorization", func(t *testing.T) {
+		repo := apikeyrepository.NewInmemoryRepo()
+		key, err := auth.GenerateKey()
+		assert.NoError(t, err)
+		_, err = repo.CreateAPIKey(context.Background(), model.APIKey{Role: string(auth.RoleReader), Hash: auth.HashKey(key)})
+		assert.NoError(t, err)
+		authn := auth.NewAuthenticator(repo, log.NewNopLogger())
+		handler := MakeHandler(AuthorizeEndpoints(endpoints, auth.DefaultPolicy), mockLogger, kithttp.ServerBefore(authn.HTTPToContext))
+
+		for _, tc := range []struct {
+			method, target, key string
+			want                int
+		}{
+			{http.MethodGet, "/views/vishal", "", http.StatusOK},
+			{http.MethodPost, "/increment/vishal", "", http.StatusUnauthorized},
+			{http.MethodPost, "/increment/vishal", key, http.StatusForbidden},
+		} {
+			req := httptest.NewRequest(tc.method, tc.target, nil)
+			if tc.key != "" {
+				req.Header.Set(auth.APIKeyHeader, tc.key)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want, rec.Result().StatusCode, tc.target)
+		}
+	})
+
 	t.Run("Encoding throws an status 500", func(t *testing.T) {
 		rec := httptest.NewRecorder()
 		customError := errors.New("custom error")
@@ -98,6 +136,82 @@ func TestTransport(t *testing.T) {
 	})
 }
 
+func TestTransportContract(t *testing.T) {
+	contract := openapitest.Load(t, openapi.ViewService)
+	svc := NewService(viewrepository.NewInmemoryRepo())
+	handler := MakeHandler(MakeEndpoints(svc), kitlog.NewNopLogger())
+
+	assert.Empty(t, contract.Undocumented(handler.(*mux.Router)), "routes missing from openapi/viewservice.json")
+
+	for _, tc := range []struct {
+		method, target string
+		accept         string
+		want           int
+	}{
+		{http.MethodPost, "/increment/video1", "", http.StatusOK},
+		{http.MethodPost, "/increment/video2", "", http.StatusOK},
+		{http.MethodGet, "/", "", http.StatusOK},
+		{http.MethodGet, "/", "text/csv", http.StatusOK},
+		{http.MethodGet, "/views/video1", "", http.StatusOK},
+		{http.MethodGet, "/views?id=video1&id=unseen", "", http.StatusOK},
+		{http.MethodGet, "/views", "", http.StatusBadRequest},
+		{http.MethodGet, "/views?" + strings.Repeat("id=v&", DefaultMaxBatchSize+1), "", http.StatusBadRequest},
+		{http.MethodGet, "/rank/video1", "", http.StatusOK},
+		{http.MethodGet, "/rank/unseen", "", http.StatusNotFound},
+		{http.MethodGet, "/top/1", "application/x-protobuf", http.StatusOK},
+		{http.MethodGet, "/recent/5", "application/x-ndjson", http.StatusOK},
+		{http.MethodGet, "/recent/5", "application/xml", http.StatusOK},
+		{http.MethodGet, "/top/-1", "", http.StatusBadRequest},
+		{http.MethodGet, "/recent/-1", "", http.StatusBadRequest},
+		{http.MethodGet, "/openapi.json", "", http.StatusOK},
+		{http.MethodGet, "/docs", "", http.StatusOK},
+	} {
+		req := httptest.NewRequest(tc.method, tc.target, nil)
+		if tc.accept != "" {
+			req.Header.Set("Accept", tc.accept)
+		}
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, tc.want, rec.Code, tc.target)
+		contract.Check(t, req, rec)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/views:batch", strings.NewReader(`{"ids": ["video1", "unseen"]}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"views": {"video1": 1, "unseen": 0}}`, rec.Body.String())
+	contract.Check(t, req, rec)
+
+	for _, body := range []string{`{"ids": [`, `{"ids": []}`, `{}`} {
+		req := httptest.NewRequest(http.MethodPost, "/views:batch", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+		contract.Check(t, req, rec)
+	}
+
+	for _, tc := range []struct {
+		target, key string
+		want        int
+	}{
+		{"/increment/video1", "key-1", http.StatusOK},
+		{"/increment/video1", "key-1", http.StatusOK},
+		{"/increment/video2", "key-1", http.StatusUnprocessableEntity},
+		{"/increment/video1", strings.Repeat("k", 256), http.StatusBadRequest},
+		{"/increment/video1", "key\n", http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tc.target, nil)
+		req.Header.Set("Idempotency-Key", tc.key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, tc.want, rec.Code, tc.key)
+		contract.Check(t, req, rec)
+	}
+}
+
 func MockGetViewsEndpoint() endpoint.Endpoint {
 	return func(ctx context.Context, request any) (any, error) {
 		return 1, nil
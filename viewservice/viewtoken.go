@@ -0,0 +1,59 @@
+package viewservice
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// View tokens are sent in ViewTokenHeader or, for beacons that cannot set
+// headers, the ViewTokenParam query parameter.
+const (
+	ViewTokenHeader = "X-View-Token"
+	ViewTokenParam  = "view_token"
+)
+
+// Errors returned by Increment when signed view tokens are required.
+var (
+	ErrViewTokenRequired = errors.New("view token required")
+	ErrViewTokenInvalid  = errors.New("view token invalid")
+	ErrViewTokenReplayed = errors.New("view token already used")
+)
+
+type viewTokenKey struct{}
+
+// NewViewTokenContext returns a copy of ctx carrying the signed view token
+// that came with an Increment.
+func NewViewTokenContext(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, viewTokenKey{}, token)
+}
+
+// ViewTokenFromContext returns the view token stored in ctx, or "".
+func ViewTokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(viewTokenKey{}).(string)
+	return token
+}
+
+type tokenViewerKey struct{}
+
+// NewTokenViewerContext returns a copy of ctx naming the IP address of the
+// viewer a view is relayed for, as gRPC callers do with viewer_ip. View
+// tokens are then bound to it, and views qualified by it, rather than by
+// the address of the caller.
+func NewTokenViewerContext(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, tokenViewerKey{}, ip)
+}
+
+// TokenViewerFromContext returns the relayed viewer stored in ctx, if any.
+func TokenViewerFromContext(ctx context.Context) (ip string, ok bool) {
+	ip, ok = ctx.Value(tokenViewerKey{}).(string)
+	return ip, ok
+}
+
+// ViewTokenFromRequest returns the view token sent with r, or "".
+func ViewTokenFromRequest(r *http.Request) string {
+	if token := r.Header.Get(ViewTokenHeader); token != "" {
+		return token
+	}
+	return r.URL.Query().Get(ViewTokenParam)
+}
@@ -0,0 +1,87 @@
+package viewtoken
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ReplayCache remembers used tokens until they expire.
+type ReplayCache interface {
+	// Claim records id as used by owner until expires. It reports false
+	// if id was already recorded and has not expired, unless owner is not
+	// empty and the same as the recorded one.
+	Claim(ctx context.Context, id, owner string, expires time.Time) (bool, error)
+}
+
+type memoryCache struct {
+	mu        sync.Mutex
+	used      map[string]claim
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryCache returns a ReplayCache for a single instance. Expired
+// tokens are dropped every minute.
+func NewMemoryCache() *memoryCache {
+	return &memoryCache{
+		used: make(map[string]claim),
+		now:  time.Now,
+	}
+}
+
+type claim struct {
+	owner   string
+	expires time.Time
+}
+
+func (c *memoryCache) Claim(ctx context.Context, id, owner string, expires time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if now.Sub(c.lastSweep) > time.Minute {
+		for k, cl := range c.used {
+			if !now.Before(cl.expires) {
+				delete(c.used, k)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	if cl, ok := c.used[id]; ok && now.Before(cl.expires) {
+		return owner != "" && cl.owner == owner, nil
+	}
+	c.used[id] = claim{owner, expires}
+	return true, nil
+}
+
+type redisCache struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisCache returns a ReplayCache shared by every instance using
+// client. Keys are prefixed with prefix and expire with their token.
+func NewRedisCache(client redis.Cmdable, prefix string) *redisCache {
+	return &redisCache{client: client, prefix: prefix}
+}
+
+// Claim stores owner as the value of the key; a claim never changes once
+// made, so comparing it after a failed SET NX needs no transaction.
+func (c *redisCache) Claim(ctx context.Context, id, owner string, expires time.Time) (bool, error) {
+	err := c.client.SetArgs(ctx, c.prefix+id, owner, redis.SetArgs{Mode: "NX", ExpireAt: expires}).Err()
+	if err != redis.Nil {
+		return err == nil, err
+	}
+	if owner == "" {
+		return false, nil
+	}
+	recorded, err := c.client.Get(ctx, c.prefix+id).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return err == nil && recorded == owner, err
+}
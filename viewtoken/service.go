@@ -0,0 +1,76 @@
+package viewtoken
+
+import (
+	"context"
+	"errors"
+	"time"
+	"view_count/viewfilter"
+	"view_count/viewservice"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/log"
+)
+
+type verifyingService struct {
+	verifier   *Verifier
+	rejections metrics.Counter
+	logger     log.Logger
+	viewservice.Service
+}
+
+// NewService returns a Service whose Increment only counts views carrying
+// a valid token, taken from viewservice.ViewTokenFromContext and checked
+// against the viewer it was minted for: the relayed viewer of
+// viewservice.TokenViewerFromContext when a backend sent one, as gRPC
+// callers do, and otherwise the viewfilter.Viewer of the context. Rejections are counted by
+// reason. When the replay cache fails, tokens are accepted on their
+// signature alone so the cache cannot take the service down.
+//
+// A token is claimed for the idempotency key of IncrementOnce, so a retry
+// with the same key and token is let through, where the key keeps it from
+// counting twice; a failed attempt does not use up the view. Tokens of
+// plain Increments are used once, whether or not the increment succeeds.
+func NewService(verifier *Verifier, rejections metrics.Counter, logger log.Logger, s viewservice.Service) viewservice.Service {
+	return &verifyingService{verifier, rejections, logger, s}
+}
+
+func (s *verifyingService) Increment(ctx context.Context, videoId string) (err error) {
+	if err := s.verify(ctx, videoId, ""); err != nil {
+		return err
+	}
+	return s.Service.Increment(ctx, videoId)
+}
+
+func (s *verifyingService) IncrementOnce(ctx context.Context, videoId, key string, ttl time.Duration) (replayed bool, err error) {
+	if err := s.verify(ctx, videoId, key); err != nil {
+		return false, err
+	}
+	return s.Service.IncrementOnce(ctx, videoId, key, ttl)
+}
+
+func (s *verifyingService) verify(ctx context.Context, videoId, key string) (err error) {
+	if videoId == "" {
+		return viewservice.ErrInvalidArgument
+	}
+	ip, ok := viewservice.TokenViewerFromContext(ctx)
+	if !ok {
+		viewer, _ := viewfilter.FromContext(ctx)
+		ip = viewer.IP
+	}
+	err = s.verifier.Verify(ctx, viewservice.ViewTokenFromContext(ctx), videoId, ip, key)
+	switch {
+	case err == nil:
+	case errors.Is(err, viewservice.ErrViewTokenRequired):
+		s.rejections.With("reason", "missing").Add(1)
+		return err
+	case errors.Is(err, viewservice.ErrViewTokenInvalid):
+		s.rejections.With("reason", "invalid").Add(1)
+		return err
+	case errors.Is(err, viewservice.ErrViewTokenReplayed):
+		s.rejections.With("reason", "replayed").Add(1)
+		return err
+	default:
+		s.logger.Log("msg", "view token replay cache failed, accepting token", "err", err)
+	}
+	return nil
+}
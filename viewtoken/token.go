@@ -0,0 +1,167 @@
+// Package viewtoken stops forged increments. The page server signs a token
+// for every rendered page that binds the video, the viewer and an expiry,
+// and in the required mode Increment only counts views carrying a valid
+// token that was not used before.
+//
+// A token is "<key id>.<payload>.<signature>" where payload is the
+// base64url JSON of Claims and signature the base64url HMAC-SHA256 of
+// "<key id>.<payload>" keyed with the key's secret.
+package viewtoken
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"view_count/viewservice"
+)
+
+// Claims is what a token binds.
+type Claims struct {
+	VideoId string `json:"vid"`
+	// Viewer is the client IP the page was rendered for.
+	Viewer    string `json:"viewer"`
+	ExpiresAt int64  `json:"exp"`
+	// Nonce makes tokens for the same page render unique.
+	Nonce string `json:"nonce"`
+}
+
+// Key is a signing secret. Several keys can be active at once so they can
+// be rotated: page servers move to a new key while tokens signed with the
+// old one are still accepted.
+type Key struct {
+	Id     string
+	Secret []byte
+}
+
+func mac(secret []byte, signed string) []byte {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(signed))
+	return m.Sum(nil)
+}
+
+// Issue returns a token for a view of videoId by viewer that is valid for
+// ttl. It is what page servers written in Go call.
+func Issue(key Key, videoId, viewer string, ttl time.Duration) (string, error) {
+	var nonce [12]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(Claims{
+		VideoId:   videoId,
+		Viewer:    viewer,
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+		Nonce:     base64.RawURLEncoding.EncodeToString(nonce[:]),
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := key.Id + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac(key.Secret, signed)), nil
+}
+
+// Verifier checks tokens against a set of active keys.
+type Verifier struct {
+	keys    map[string][]byte
+	maxTTL  time.Duration
+	replays ReplayCache
+}
+
+// NewVerifier returns a Verifier accepting tokens signed with any of keys
+// that expire within maxTTL. Used tokens are remembered in replays until
+// they expire, which is what bounds its size.
+func NewVerifier(keys []Key, maxTTL time.Duration, replays ReplayCache) *Verifier {
+	v := &Verifier{keys: make(map[string][]byte, len(keys)), maxTTL: maxTTL, replays: replays}
+	for _, k := range keys {
+		v.keys[k.Id] = k.Secret
+	}
+	return v
+}
+
+// Verify returns nil if token is valid for a view of videoId by viewer and
+// was not verified before, or only with the same non-empty
+// idempotencyKey, and one of the viewservice view token errors otherwise.
+func (v *Verifier) Verify(ctx context.Context, token, videoId, viewer, idempotencyKey string) error {
+	if token == "" {
+		return viewservice.ErrViewTokenRequired
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return viewservice.ErrViewTokenInvalid
+	}
+	secret, ok := v.keys[parts[0]]
+	if !ok {
+		return viewservice.ErrViewTokenInvalid
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, mac(secret, parts[0]+"."+parts[1])) {
+		return viewservice.ErrViewTokenInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return viewservice.ErrViewTokenInvalid
+	}
+	var c Claims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return viewservice.ErrViewTokenInvalid
+	}
+	now := time.Now()
+	expires := time.Unix(c.ExpiresAt, 0)
+	if c.VideoId != videoId || c.Viewer != viewer ||
+		!now.Before(expires) || expires.After(now.Add(v.maxTTL)) {
+		return viewservice.ErrViewTokenInvalid
+	}
+
+	// the signature is unique per token, so it identifies it.
+	fresh, err := v.replays.Claim(ctx, hex.EncodeToString(sig), idempotencyKey, expires)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return viewservice.ErrViewTokenReplayed
+	}
+	return nil
+}
+
+// LoadKeyFile reads keys from a file with one "<id> <secret>" pair per
+// line. Blank lines and lines starting with # are skipped.
+func LoadKeyFile(path string) ([]Key, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var keys []Key
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || strings.Contains(fields[0], ".") {
+			return nil, fmt.Errorf("%s:%d: expected \"<id> <secret>\" with an id without dots", path, n)
+		}
+		if len(fields[1]) < 32 {
+			return nil, fmt.Errorf("%s:%d: secret of key %q is shorter than 32 characters", path, n, fields[0])
+		}
+		keys = append(keys, Key{Id: fields[0], Secret: []byte(fields[1])})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no keys", path)
+	}
+	return keys, nil
+}
@@ -0,0 +1,235 @@
+package viewtoken
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"view_count/repository/viewrepository"
+	"view_count/viewfilter"
+	"view_count/viewservice"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/log"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// labelCounter records the total added per label set.
+type labelCounter struct {
+	totals map[string]float64
+	lvs    []string
+}
+
+func newLabelCounter() *labelCounter {
+	return &labelCounter{totals: map[string]float64{}}
+}
+
+func (c *labelCounter) With(labelValues ...string) metrics.Counter {
+	return &labelCounter{totals: c.totals, lvs: append(append([]string{}, c.lvs...), labelValues...)}
+}
+
+func (c *labelCounter) Add(delta float64) {
+	c.totals[strings.Join(c.lvs, ",")] += delta
+}
+
+var (
+	oldKey = Key{Id: "2024", Secret: []byte("old-secret-old-secret-old-secret")}
+	newKey = Key{Id: "2025", Secret: []byte("new-secret-new-secret-new-secret")}
+)
+
+func issue(t *testing.T, key Key, videoId, viewer string, ttl time.Duration) string {
+	t.Helper()
+	token, err := Issue(key, videoId, viewer, ttl)
+	require.NoError(t, err)
+	return token
+}
+
+func TestVerifier(t *testing.T) {
+	ctx := context.Background()
+	v := NewVerifier([]Key{oldKey, newKey}, 10*time.Minute, NewMemoryCache())
+
+	t.Run("Every active key is accepted", func(t *testing.T) {
+		assert.NoError(t, v.Verify(ctx, issue(t, oldKey, "video1", "203.0.113.7", time.Minute), "video1", "203.0.113.7", ""))
+		assert.NoError(t, v.Verify(ctx, issue(t, newKey, "video1", "203.0.113.7", time.Minute), "video1", "203.0.113.7", ""))
+	})
+
+	t.Run("Tokens are used once", func(t *testing.T) {
+		token := issue(t, newKey, "video1", "203.0.113.7", time.Minute)
+		assert.NoError(t, v.Verify(ctx, token, "video1", "203.0.113.7", ""))
+		assert.Equal(t, viewservice.ErrViewTokenReplayed, v.Verify(ctx, token, "video1", "203.0.113.7", ""))
+	})
+
+	token := issue(t, newKey, "video1", "203.0.113.7", time.Minute)
+	for name, tc := range map[string]struct {
+		token, videoId, viewer string
+		want                   error
+	}{
+		"missing":      {"", "video1", "203.0.113.7", viewservice.ErrViewTokenRequired},
+		"other video":  {token, "video2", "203.0.113.7", viewservice.ErrViewTokenInvalid},
+		"other viewer": {token, "video1", "198.51.100.1", viewservice.ErrViewTokenInvalid},
+		"expired":      {issue(t, newKey, "video1", "203.0.113.7", -time.Second), "video1", "203.0.113.7", viewservice.ErrViewTokenInvalid},
+		"too long":     {issue(t, newKey, "video1", "203.0.113.7", time.Hour), "video1", "203.0.113.7", viewservice.ErrViewTokenInvalid},
+		"unknown key":  {issue(t, Key{Id: "2023", Secret: oldKey.Secret}, "video1", "203.0.113.7", time.Minute), "video1", "203.0.113.7", viewservice.ErrViewTokenInvalid},
+		"forged":       {issue(t, Key{Id: newKey.Id, Secret: []byte("guessed")}, "video1", "203.0.113.7", time.Minute), "video1", "203.0.113.7", viewservice.ErrViewTokenInvalid},
+		"malformed":    {"not-a-token", "video1", "203.0.113.7", viewservice.ErrViewTokenInvalid},
+	} {
+		t.Run("Rejects "+name, func(t *testing.T) {
+			assert.Equal(t, tc.want, v.Verify(ctx, tc.token, tc.videoId, tc.viewer, ""))
+		})
+	}
+}
+
+func TestReplayCaches(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	for name, cache := range map[string]ReplayCache{
+		"memory": NewMemoryCache(),
+		"redis":  NewRedisCache(client, "test:"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			expires := time.Now().Add(time.Minute)
+			fresh, err := cache.Claim(ctx, "sig1", "", expires)
+			require.NoError(t, err)
+			assert.True(t, fresh)
+
+			fresh, err = cache.Claim(ctx, "sig1", "", expires)
+			require.NoError(t, err)
+			assert.False(t, fresh)
+
+			fresh, err = cache.Claim(ctx, "sig2", "", expires)
+			require.NoError(t, err)
+			assert.True(t, fresh)
+
+			for owner, want := range map[string]bool{"key1": true, "key2": false, "": false} {
+				if _, err := cache.Claim(ctx, "sig3", "key1", expires); err != nil {
+					t.Fatal(err)
+				}
+				fresh, err = cache.Claim(ctx, "sig3", owner, expires)
+				require.NoError(t, err)
+				assert.Equal(t, want, fresh, "claimed again by %q", owner)
+			}
+		})
+	}
+
+	t.Run("Expired tokens are forgotten", func(t *testing.T) {
+		cache := NewMemoryCache()
+		now := time.Now()
+		cache.now = func() time.Time { return now }
+
+		_, err := cache.Claim(ctx, "sig1", "", now.Add(time.Minute))
+		require.NoError(t, err)
+		now = now.Add(2 * time.Minute)
+		fresh, err := cache.Claim(ctx, "sig2", "", now.Add(time.Minute))
+		require.NoError(t, err)
+		assert.True(t, fresh)
+		assert.NotContains(t, cache.used, "sig1")
+	})
+}
+
+// flakyService fails its first failures IncrementOnce calls, as a timed
+// out database would.
+type flakyService struct {
+	viewservice.Service
+	failures int
+}
+
+func (s *flakyService) IncrementOnce(ctx context.Context, videoId, key string, ttl time.Duration) (bool, error) {
+	if s.failures > 0 {
+		s.failures--
+		return false, errors.New("db timeout")
+	}
+	return s.Service.IncrementOnce(ctx, videoId, key, ttl)
+}
+
+type failingCache struct{}
+
+func (failingCache) Claim(ctx context.Context, id, owner string, expires time.Time) (bool, error) {
+	return false, errors.New("redis down")
+}
+
+func TestService(t *testing.T) {
+	repo := viewrepository.NewInmemoryRepo()
+	rejections := newLabelCounter()
+	svc := NewService(NewVerifier([]Key{newKey}, 10*time.Minute, NewMemoryCache()), rejections, log.NewNopLogger(), viewservice.NewService(repo))
+
+	viewerCtx := viewfilter.NewContext(context.Background(), viewfilter.Viewer{IP: "203.0.113.7"})
+	token := issue(t, newKey, "video1", "203.0.113.7", time.Minute)
+	ctx := viewservice.NewViewTokenContext(viewerCtx, token)
+
+	assert.NoError(t, svc.Increment(ctx, "video1"))
+	assert.Equal(t, viewservice.ErrViewTokenReplayed, svc.Increment(ctx, "video1"))
+	assert.Equal(t, viewservice.ErrViewTokenRequired, svc.Increment(viewerCtx, "video1"))
+	assert.Equal(t, viewservice.ErrViewTokenInvalid, svc.Increment(viewservice.NewViewTokenContext(viewerCtx, "a.b.c"), "video1"))
+
+	views, err := repo.GetView(context.Background(), "video1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, views)
+	assert.Equal(t, map[string]float64{
+		"reason,replayed": 1,
+		"reason,missing":  1,
+		"reason,invalid":  1,
+	}, rejections.totals)
+
+	t.Run("Retries with the same idempotency key reuse their token", func(t *testing.T) {
+		repo := viewrepository.NewInmemoryRepo()
+		flaky := &flakyService{Service: viewservice.NewService(repo), failures: 1}
+		svc := NewService(NewVerifier([]Key{newKey}, 10*time.Minute, NewMemoryCache()), newLabelCounter(), log.NewNopLogger(), flaky)
+		ctx := viewservice.NewViewTokenContext(viewerCtx, issue(t, newKey, "video1", "203.0.113.7", time.Minute))
+
+		_, err := svc.IncrementOnce(ctx, "video1", "key1", 0)
+		assert.Error(t, err, "the first attempt fails")
+		replayed, err := svc.IncrementOnce(ctx, "video1", "key1", 0)
+		assert.NoError(t, err)
+		assert.False(t, replayed)
+		replayed, err = svc.IncrementOnce(ctx, "video1", "key1", 0)
+		assert.NoError(t, err)
+		assert.True(t, replayed, "a retry after a lost response replays")
+
+		_, err = svc.IncrementOnce(ctx, "video1", "key2", 0)
+		assert.Equal(t, viewservice.ErrViewTokenReplayed, err)
+		assert.Equal(t, viewservice.ErrViewTokenReplayed, svc.Increment(ctx, "video1"))
+
+		views, err := repo.GetView(context.Background(), "video1")
+		require.NoError(t, err)
+		assert.Equal(t, 1, views)
+	})
+
+	t.Run("Tokens bind to a relayed viewer", func(t *testing.T) {
+		token := issue(t, newKey, "video2", "198.51.100.9", time.Minute)
+		backendCtx := viewfilter.NewContext(context.Background(), viewfilter.Viewer{IP: "10.0.0.2"})
+
+		assert.Equal(t, viewservice.ErrViewTokenInvalid, svc.Increment(viewservice.NewViewTokenContext(backendCtx, token), "video2"))
+		relayed := viewservice.NewTokenViewerContext(backendCtx, "198.51.100.9")
+		assert.NoError(t, svc.Increment(viewservice.NewViewTokenContext(relayed, token), "video2"))
+	})
+
+	t.Run("Cache failures accept signed tokens", func(t *testing.T) {
+		svc := NewService(NewVerifier([]Key{newKey}, 10*time.Minute, failingCache{}), rejections, log.NewNopLogger(), viewservice.NewService(repo))
+		token := issue(t, newKey, "video1", "203.0.113.7", time.Minute)
+
+		assert.NoError(t, svc.Increment(viewservice.NewViewTokenContext(viewerCtx, token), "video1"))
+	})
+}
+
+func TestLoadKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keys")
+	require.NoError(t, os.WriteFile(path, []byte("# rotated monthly\n2024 old-secret-old-secret-old-secret\n\n2025 new-secret-new-secret-new-secret\n"), 0o600))
+
+	keys, err := LoadKeyFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []Key{oldKey, newKey}, keys)
+
+	require.NoError(t, os.WriteFile(path, []byte("2025 short\n"), 0o600))
+	_, err = LoadKeyFile(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,257 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+	"view_count/model"
+	"view_count/repository/webhookrepository"
+	"view_count/requestid"
+
+	"github.com/gorilla/mux"
+)
+
+// webhookRequest is the body of create and update requests. A secret is
+// generated when none is given.
+type webhookRequest struct {
+	URL        string `json:"url"`
+	Secret     string `json:"secret"`
+	VideoId    string `json:"video_id"`
+	Thresholds []int  `json:"thresholds"`
+}
+
+// webhookResponse never includes the secret except right after creation.
+type webhookResponse struct {
+	Id         string    `json:"id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	VideoId    string    `json:"video_id,omitempty"`
+	Thresholds []int     `json:"thresholds"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type deadLetterResponse struct {
+	Id        string          `json:"id"`
+	WebhookId string          `json:"webhook_id"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error"`
+	FailedAt  time.Time       `json:"failed_at"`
+}
+
+func toResponse(w model.Webhook) webhookResponse {
+	return webhookResponse{
+		Id:         w.Id,
+		URL:        w.URL,
+		VideoId:    w.VideoId,
+		Thresholds: w.Thresholds,
+		CreatedAt:  w.CreatedAt,
+	}
+}
+
+// AdminHandler serves the CRUD API for webhooks and lets dead letters be
+// listed, replayed and deleted.
+type AdminHandler struct {
+	repo       webhookrepository.Repository
+	dispatcher *Dispatcher
+}
+
+// NewAdminHandler returns an AdminHandler that invalidates the webhooks
+// cached by dispatcher whenever they change.
+func NewAdminHandler(repo webhookrepository.Repository, dispatcher *Dispatcher) *AdminHandler {
+	return &AdminHandler{repo: repo, dispatcher: dispatcher}
+}
+
+// Register adds the routes below /admin/webhooks to r.
+func (h *AdminHandler) Register(r *mux.Router) {
+	r.HandleFunc("/admin/webhooks", h.list).Methods("GET")
+	r.HandleFunc("/admin/webhooks", h.create).Methods("POST")
+	r.HandleFunc("/admin/webhooks/dead-letters", h.listDeadLetters).Methods("GET")
+	r.HandleFunc("/admin/webhooks/dead-letters/{id}", h.deleteDeadLetter).Methods("DELETE")
+	r.HandleFunc("/admin/webhooks/dead-letters/{id}/replay", h.replayDeadLetter).Methods("POST")
+	r.HandleFunc("/admin/webhooks/{id}", h.get).Methods("GET")
+	r.HandleFunc("/admin/webhooks/{id}", h.update).Methods("PUT")
+	r.HandleFunc("/admin/webhooks/{id}", h.delete).Methods("DELETE")
+}
+
+func (h *AdminHandler) list(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.repo.ListWebhooks(r.Context())
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	res := make([]webhookResponse, 0, len(webhooks))
+	for _, wh := range webhooks {
+		res = append(res, toResponse(wh))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h *AdminHandler) create(w http.ResponseWriter, r *http.Request) {
+	wh, ok := decodeWebhook(w, r)
+	if !ok {
+		return
+	}
+	if wh.Secret == "" {
+		wh.Secret = requestid.New()
+	}
+
+	wh, err := h.repo.CreateWebhook(r.Context(), wh)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	h.dispatcher.Invalidate()
+	res := toResponse(wh)
+	res.Secret = wh.Secret
+	writeJSON(w, http.StatusCreated, res)
+}
+
+func (h *AdminHandler) get(w http.ResponseWriter, r *http.Request) {
+	wh, err := h.repo.GetWebhook(r.Context(), mux.Vars(r)["id"])
+	if !checkErr(w, err) {
+		return
+	}
+	writeJSON(w, http.StatusOK, toResponse(wh))
+}
+
+func (h *AdminHandler) update(w http.ResponseWriter, r *http.Request) {
+	wh, ok := decodeWebhook(w, r)
+	if !ok {
+		return
+	}
+	old, err := h.repo.GetWebhook(r.Context(), mux.Vars(r)["id"])
+	if !checkErr(w, err) {
+		return
+	}
+	wh.Id, wh.CreatedAt = old.Id, old.CreatedAt
+	if wh.Secret == "" {
+		wh.Secret = old.Secret
+	}
+	if !checkErr(w, h.repo.UpdateWebhook(r.Context(), wh)) {
+		return
+	}
+	h.dispatcher.Invalidate()
+	writeJSON(w, http.StatusOK, toResponse(wh))
+}
+
+func (h *AdminHandler) delete(w http.ResponseWriter, r *http.Request) {
+	if !checkErr(w, h.repo.DeleteWebhook(r.Context(), mux.Vars(r)["id"])) {
+		return
+	}
+	h.dispatcher.Invalidate()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) listDeadLetters(w http.ResponseWriter, r *http.Request) {
+	letters, err := h.repo.ListDeadLetters(r.Context())
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	res := make([]deadLetterResponse, 0, len(letters))
+	for _, d := range letters {
+		res = append(res, deadLetterResponse{
+			Id:        d.Id,
+			WebhookId: d.WebhookId,
+			Payload:   d.Payload,
+			Attempts:  d.Attempts,
+			LastError: d.LastError,
+			FailedAt:  d.FailedAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// replayDeadLetter queues the delivery again and removes the dead letter.
+// A delivery that fails again is dead-lettered anew.
+func (h *AdminHandler) replayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	letter, err := h.repo.GetDeadLetter(r.Context(), mux.Vars(r)["id"])
+	if !checkErr(w, err) {
+		return
+	}
+	if !checkErr(w, h.dispatcher.Replay(r.Context(), letter)) {
+		return
+	}
+	if !checkErr(w, h.repo.DeleteDeadLetter(r.Context(), letter.Id)) {
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *AdminHandler) deleteDeadLetter(w http.ResponseWriter, r *http.Request) {
+	if !checkErr(w, h.repo.DeleteDeadLetter(r.Context(), mux.Vars(r)["id"])) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeWebhook reads and validates the request body, replying with 400
+// when it is invalid.
+func decodeWebhook(w http.ResponseWriter, r *http.Request) (model.Webhook, bool) {
+	var req webhookRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return model.Webhook{}, false
+	}
+	if err := validate(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return model.Webhook{}, false
+	}
+
+	// sort and deduplicate so milestones fire in order.
+	sort.Ints(req.Thresholds)
+	thresholds := req.Thresholds[:1]
+	for _, t := range req.Thresholds[1:] {
+		if t != thresholds[len(thresholds)-1] {
+			thresholds = append(thresholds, t)
+		}
+	}
+	return model.Webhook{
+		URL:        req.URL,
+		Secret:     req.Secret,
+		VideoId:    req.VideoId,
+		Thresholds: thresholds,
+	}, true
+}
+
+func validate(req webhookRequest) error {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if len(req.Thresholds) == 0 {
+		return errors.New("at least one threshold is required")
+	}
+	for _, t := range req.Thresholds {
+		if t < 1 {
+			return errors.New("thresholds must be positive")
+		}
+	}
+	return nil
+}
+
+// checkErr replies to a repository error and reports whether there was
+// none.
+func checkErr(w http.ResponseWriter, err error) bool {
+	switch err {
+	case nil:
+		return true
+	case webhookrepository.ErrWebhookNotFound:
+		http.Error(w, "webhook not found", http.StatusNotFound)
+	case webhookrepository.ErrDeadLetterNotFound:
+		http.Error(w, "dead letter not found", http.StatusNotFound)
+	default:
+		http.Error(w, "server error", http.StatusInternalServerError)
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
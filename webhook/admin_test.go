@@ -0,0 +1,115 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"view_count/model"
+	"view_count/repository/viewrepository"
+	"view_count/repository/webhookrepository"
+	"view_count/viewservice"
+
+	"github.com/go-kit/log"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminHandler(t *testing.T) {
+	r := mux.NewRouter()
+	repo := webhookrepository.NewInmemoryRepo()
+	d := NewDispatcher(repo, viewservice.NewService(viewrepository.NewInmemoryRepo()), Config{}, log.NewNopLogger())
+	NewAdminHandler(repo, d).Register(r)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := do("POST", "/admin/webhooks", `{"url":"https://example.com/hook","thresholds":[10000,1000,1000]}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created webhookResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.Id)
+	assert.NotEmpty(t, created.Secret)
+	assert.Equal(t, []int{1000, 10000}, created.Thresholds)
+	assert.True(t, d.stale.Swap(false), "changes invalidate the dispatcher")
+
+	rec = do("GET", "/admin/webhooks/"+created.Id, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "secret")
+
+	rec = do("PUT", "/admin/webhooks/"+created.Id, `{"url":"https://example.com/other","video_id":"video1","thresholds":[5]}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = do("GET", "/admin/webhooks", "")
+	var list []webhookResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	require.Len(t, list, 1)
+	assert.Equal(t, "video1", list[0].VideoId)
+	assert.Equal(t, "https://example.com/other", list[0].URL)
+
+	assert.Equal(t, http.StatusNoContent, do("DELETE", "/admin/webhooks/"+created.Id, "").Code)
+	assert.Equal(t, http.StatusNotFound, do("GET", "/admin/webhooks/"+created.Id, "").Code)
+	assert.Equal(t, http.StatusNotFound, do("DELETE", "/admin/webhooks/"+created.Id, "").Code)
+
+	rec = do("GET", "/admin/webhooks/dead-letters", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, "[]", rec.Body.String())
+
+	t.Run("Invalid bodies are rejected", func(t *testing.T) {
+		for _, body := range []string{
+			`{`,
+			`{"url":"ftp://example.com","thresholds":[1]}`,
+			`{"url":"/relative","thresholds":[1]}`,
+			`{"url":"https://example.com"}`,
+			`{"url":"https://example.com","thresholds":[0]}`,
+		} {
+			assert.Equal(t, http.StatusBadRequest, do("POST", "/admin/webhooks", body).Code, body)
+		}
+	})
+}
+
+func TestAdminHandlerDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	repo := webhookrepository.NewInmemoryRepo()
+	server, deliveries := newReceiver(t, "s")
+	d, _ := startDispatcher(t, repo)
+	r := mux.NewRouter()
+	NewAdminHandler(repo, d).Register(r)
+
+	do := func(method, path string) int {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec.Code
+	}
+	letter := func(webhookId string) model.DeadLetter {
+		payload, _ := json.Marshal(Event{Id: "event1", Type: EventMilestone, WebhookId: webhookId, VideoId: "video1", Threshold: 10})
+		require.NoError(t, repo.AddDeadLetter(ctx, model.DeadLetter{WebhookId: webhookId, Payload: payload, Attempts: 6}))
+		letters, err := repo.ListDeadLetters(ctx)
+		require.NoError(t, err)
+		return letters[len(letters)-1]
+	}
+
+	wh, err := repo.CreateWebhook(ctx, model.Webhook{URL: server.URL, Secret: "s", Thresholds: []int{10}})
+	require.NoError(t, err)
+	replayed := letter(wh.Id)
+	assert.Equal(t, http.StatusAccepted, do("POST", "/admin/webhooks/dead-letters/"+replayed.Id+"/replay"))
+	got := wait(t, deliveries)
+	assert.True(t, got.valid)
+	assert.Equal(t, "event1", got.event.Id, "replays keep the event ID")
+	assert.Equal(t, http.StatusNotFound, do("POST", "/admin/webhooks/dead-letters/"+replayed.Id+"/replay"))
+
+	orphan := letter("deleted")
+	assert.Equal(t, http.StatusNotFound, do("POST", "/admin/webhooks/dead-letters/"+orphan.Id+"/replay"))
+	assert.Equal(t, http.StatusNoContent, do("DELETE", "/admin/webhooks/dead-letters/"+orphan.Id))
+	assert.Equal(t, http.StatusNotFound, do("DELETE", "/admin/webhooks/dead-letters/"+orphan.Id))
+
+	letters, err := repo.ListDeadLetters(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, letters)
+}
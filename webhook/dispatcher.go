@@ -0,0 +1,382 @@
+// Package webhook notifies subscribers over HTTP when videos reach view
+// count milestones. Increments are only recorded on the hot path; a
+// Dispatcher detects milestones and delivers them in the background.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"view_count/model"
+	"view_count/repository/webhookrepository"
+	"view_count/requestid"
+	"view_count/viewservice"
+
+	"github.com/go-kit/log"
+)
+
+const (
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of
+	// "<timestamp>.<body>" keyed with the webhook secret.
+	SignatureHeader = "X-Webhook-Signature"
+	// TimestampHeader carries the Unix time the delivery was signed at.
+	TimestampHeader = "X-Webhook-Timestamp"
+
+	EventMilestone = "video.milestone"
+)
+
+// Event is the JSON body of a delivery.
+type Event struct {
+	Id         string    `json:"id"`
+	Type       string    `json:"type"`
+	WebhookId  string    `json:"webhook_id"`
+	VideoId    string    `json:"video_id"`
+	Threshold  int       `json:"threshold"`
+	Views      int       `json:"views"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// Sign returns the value of SignatureHeader for body sent at timestamp.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is valid for body sent at timestamp.
+// Receivers should also reject timestamps that are too old.
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Config configures a Dispatcher.
+type Config struct {
+	// Workers is the number of concurrent deliveries.
+	Workers int
+	// MaxAttempts is the number of tries before a delivery is dead-lettered.
+	MaxAttempts int
+	// Backoff is the wait before the first retry. It doubles with every
+	// further retry up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout bounds a single delivery attempt.
+	Timeout time.Duration
+	// Interval is how often viewed videos are checked for milestones.
+	// Videos viewed several times in between are checked once.
+	Interval time.Duration
+	// RefreshInterval is how often the webhooks are reloaded, which picks
+	// up changes made through other instances. Changes made through this
+	// instance's AdminHandler are picked up on the next Interval.
+	RefreshInterval time.Duration
+}
+
+type delivery struct {
+	webhook model.Webhook
+	event   Event
+}
+
+type Dispatcher struct {
+	repo    webhookrepository.Repository
+	svc     viewservice.Service
+	cfg     Config
+	client  *http.Client
+	logger  log.Logger
+	changes chan string
+	queue   chan delivery
+
+	// stale is set by Invalidate so the next check reloads webhooks.
+	stale atomic.Bool
+	// webhooks and loadedAt are only used by Run.
+	webhooks []model.Webhook
+	loadedAt time.Time
+}
+
+// NewDispatcher returns a Dispatcher that reads counts from svc and
+// subscriptions from repo. Run must be running for anything to be sent.
+func NewDispatcher(repo webhookrepository.Repository, svc viewservice.Service, cfg Config, logger log.Logger) *Dispatcher {
+	return &Dispatcher{
+		repo:    repo,
+		svc:     svc,
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		logger:  logger,
+		changes: make(chan string, 4096),
+		queue:   make(chan delivery, 1024),
+	}
+}
+
+// Notify records that videoId was viewed. It never blocks: when the
+// dispatcher is behind the change is dropped, and milestones it would have
+// reached are detected on the video's next view.
+func (d *Dispatcher) Notify(videoId string) {
+	select {
+	case d.changes <- videoId:
+	default:
+	}
+}
+
+// Invalidate makes the dispatcher reload webhooks before it next checks
+// for milestones. It is called when webhooks are changed.
+func (d *Dispatcher) Invalidate() {
+	d.stale.Store(true)
+}
+
+// Run detects milestones every Interval and delivers them until ctx is
+// done. Deliveries still queued then are dead-lettered, since their
+// milestones are already marked as fired.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for i := 0; i < d.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case dl := <-d.queue:
+					d.deliver(ctx, dl)
+				}
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+
+	dirty := make(map[string]struct{})
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			d.drain()
+			return ctx.Err()
+		case videoId := <-d.changes:
+			dirty[videoId] = struct{}{}
+		case <-ticker.C:
+			// videos stay dirty until webhooks could be loaded.
+			if len(dirty) > 0 && d.refresh(ctx) {
+				for videoId := range dirty {
+					d.detect(ctx, videoId)
+				}
+				dirty = make(map[string]struct{})
+			}
+		}
+	}
+}
+
+// refresh reloads webhooks when they were invalidated or RefreshInterval
+// passed. It reports whether the cached webhooks can be used.
+func (d *Dispatcher) refresh(ctx context.Context) bool {
+	if !d.stale.Swap(false) && !d.loadedAt.IsZero() && time.Since(d.loadedAt) < d.cfg.RefreshInterval {
+		return true
+	}
+	webhooks, err := d.repo.ListWebhooks(ctx)
+	if err != nil {
+		d.stale.Store(true)
+		d.logger.Log("msg", "listing webhooks failed", "err", err)
+		return false
+	}
+	d.webhooks, d.loadedAt = webhooks, time.Now()
+	return true
+}
+
+// Replay queues the delivery of dead letter letter again, to the current
+// URL and secret of its webhook. The event keeps its ID, so receivers can
+// tell a replay from a new milestone. It returns
+// webhookrepository.ErrWebhookNotFound when the webhook was deleted.
+func (d *Dispatcher) Replay(ctx context.Context, letter model.DeadLetter) error {
+	w, err := d.repo.GetWebhook(ctx, letter.WebhookId)
+	if err != nil {
+		return err
+	}
+	var event Event
+	if err := json.Unmarshal(letter.Payload, &event); err != nil {
+		return err
+	}
+	select {
+	case d.queue <- delivery{webhook: w, event: event}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Dispatcher) drain() {
+	for {
+		select {
+		case dl := <-d.queue:
+			d.deadLetter(dl, 0, "shutdown before delivery")
+		default:
+			return
+		}
+	}
+}
+
+// detect enqueues a delivery for every threshold of a matching webhook that
+// the video has reached and that was not fired before.
+func (d *Dispatcher) detect(ctx context.Context, videoId string) {
+	var (
+		views int
+		err   error
+	)
+	fetched := false
+	for _, w := range d.webhooks {
+		if !w.Matches(videoId) {
+			continue
+		}
+		if !fetched {
+			if views, err = d.svc.GetView(ctx, videoId); err != nil {
+				d.logger.Log("msg", "reading views for webhooks failed", "video_id", videoId, "err", err)
+				return
+			}
+			fetched = true
+		}
+
+		for _, threshold := range w.Thresholds {
+			if views < threshold {
+				continue
+			}
+			fired, err := d.repo.MarkFired(ctx, w.Id, videoId, threshold)
+			if err != nil {
+				d.logger.Log("msg", "marking milestone failed", "webhook_id", w.Id, "err", err)
+				continue
+			}
+			if !fired {
+				continue
+			}
+			dl := delivery{webhook: w, event: Event{
+				Id:         requestid.New(),
+				Type:       EventMilestone,
+				WebhookId:  w.Id,
+				VideoId:    videoId,
+				Threshold:  threshold,
+				Views:      views,
+				OccurredAt: time.Now().UTC(),
+			}}
+			select {
+			case d.queue <- dl:
+			case <-ctx.Done():
+				d.deadLetter(dl, 0, "shutdown before delivery")
+			}
+		}
+	}
+}
+
+// deliver posts dl, retrying with exponential backoff, and dead-letters it
+// once MaxAttempts tries failed or the receiver rejected it for good.
+func (d *Dispatcher) deliver(ctx context.Context, dl delivery) {
+	body, err := json.Marshal(dl.event)
+	if err != nil {
+		d.deadLetter(dl, 0, err.Error())
+		return
+	}
+
+	backoff := d.cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := d.post(ctx, dl.webhook, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= d.cfg.MaxAttempts {
+			d.deadLetter(dl, attempt, err.Error())
+			return
+		}
+		d.logger.Log("msg", "webhook delivery failed, retrying", "webhook_id", dl.webhook.Id, "attempt", attempt, "backoff", backoff, "err", err)
+
+		select {
+		case <-ctx.Done():
+			d.deadLetter(dl, attempt, err.Error())
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, d.cfg.MaxBackoff)
+	}
+}
+
+// post makes one delivery attempt. It reports whether a failure is worth
+// retrying: network errors, 408, 429 and 5xx are, other statuses are not.
+func (d *Dispatcher) post(ctx context.Context, w model.Webhook, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(w.Secret, timestamp, body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	res.Body.Close()
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return false, nil
+	case res.StatusCode == http.StatusRequestTimeout,
+		res.StatusCode == http.StatusTooManyRequests,
+		res.StatusCode >= 500:
+		return true, fmt.Errorf("receiver responded %d", res.StatusCode)
+	default:
+		return false, fmt.Errorf("receiver responded %d", res.StatusCode)
+	}
+}
+
+func (d *Dispatcher) deadLetter(dl delivery, attempts int, reason string) {
+	body, _ := json.Marshal(dl.event)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := d.repo.AddDeadLetter(ctx, model.DeadLetter{
+		WebhookId: dl.webhook.Id,
+		Payload:   body,
+		Attempts:  attempts,
+		LastError: reason,
+		FailedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		d.logger.Log("msg", "storing dead letter failed", "webhook_id", dl.webhook.Id, "err", err)
+		return
+	}
+	d.logger.Log("msg", "webhook delivery dead-lettered", "webhook_id", dl.webhook.Id, "attempts", attempts, "err", reason)
+}
+
+type milestoneService struct {
+	dispatcher *Dispatcher
+	viewservice.Service
+}
+
+// NewMilestoneService returns a Service that notifies dispatcher of every
+// successful Increment.
+func NewMilestoneService(dispatcher *Dispatcher, s viewservice.Service) viewservice.Service {
+	return &milestoneService{dispatcher, s}
+}
+
+func (s *milestoneService) Increment(ctx context.Context, videoId string) (err error) {
+	if err = s.Service.Increment(ctx, videoId); err == nil {
+		s.dispatcher.Notify(videoId)
+	}
+	return err
+}
+
+func (s *milestoneService) IncrementOnce(ctx context.Context, videoId, key string, ttl time.Duration) (replayed bool, err error) {
+	if replayed, err = s.Service.IncrementOnce(ctx, videoId, key, ttl); err == nil && !replayed {
+		s.dispatcher.Notify(videoId)
+	}
+	return replayed, err
+}
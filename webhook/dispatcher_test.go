@@ -0,0 +1,201 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"view_count/model"
+	"view_count/repository/viewrepository"
+	"view_count/repository/webhookrepository"
+	"view_count/viewservice"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type received struct {
+	event Event
+	valid bool
+}
+
+// newReceiver returns a webhook receiver that answers with the statuses in
+// order, then 200, and passes every delivery it got to the channel.
+func newReceiver(t *testing.T, secret string, statuses ...int) (*httptest.Server, <-chan received) {
+	t.Helper()
+	c := make(chan received, 16)
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var e Event
+		json.Unmarshal(body, &e)
+		c <- received{e, Verify(secret, r.Header.Get(TimestampHeader), body, r.Header.Get(SignatureHeader))}
+
+		if n := int(calls.Add(1)); n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, c
+}
+
+// countingRepo counts ListWebhooks calls.
+type countingRepo struct {
+	lists atomic.Int32
+	webhookrepository.Repository
+}
+
+func (r *countingRepo) ListWebhooks(ctx context.Context) ([]model.Webhook, error) {
+	r.lists.Add(1)
+	return r.Repository.ListWebhooks(ctx)
+}
+
+func startDispatcher(t *testing.T, repo webhookrepository.Repository) (*Dispatcher, viewservice.Service) {
+	t.Helper()
+	base := viewservice.NewService(viewrepository.NewInmemoryRepo())
+	d := NewDispatcher(repo, base, Config{
+		Workers:         1,
+		MaxAttempts:     3,
+		Backoff:         time.Millisecond,
+		MaxBackoff:      5 * time.Millisecond,
+		Timeout:         time.Second,
+		Interval:        5 * time.Millisecond,
+		RefreshInterval: time.Minute,
+	}, log.NewNopLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return d, NewMilestoneService(d, base)
+}
+
+func wait(t *testing.T, c <-chan received) received {
+	t.Helper()
+	select {
+	case r := <-c:
+		return r
+	case <-time.After(time.Second):
+		t.Fatal("no delivery received")
+		return received{}
+	}
+}
+
+func TestSign(t *testing.T) {
+	sig := Sign("secret", "1700000000", []byte(`{"a":1}`))
+	assert.Regexp(t, "^sha256=[0-9a-f]{64}$", sig)
+	assert.True(t, Verify("secret", "1700000000", []byte(`{"a":1}`), sig))
+	assert.False(t, Verify("other", "1700000000", []byte(`{"a":1}`), sig))
+	assert.False(t, Verify("secret", "1700000001", []byte(`{"a":1}`), sig))
+}
+
+func TestDispatcher(t *testing.T) {
+	ctx := context.Background()
+	repo := webhookrepository.NewInmemoryRepo()
+	server, deliveries := newReceiver(t, "s3cret", http.StatusServiceUnavailable)
+	d, svc := startDispatcher(t, repo)
+
+	wh, err := repo.CreateWebhook(ctx, model.Webhook{URL: server.URL, Secret: "s3cret", Thresholds: []int{2, 3}})
+	require.NoError(t, err)
+	d.Invalidate()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, svc.Increment(ctx, "video1"))
+	}
+
+	// the first attempt for threshold 2 fails with 503 and is retried.
+	first, retried := wait(t, deliveries), wait(t, deliveries)
+	assert.Equal(t, first.event, retried.event)
+	assert.True(t, retried.valid)
+	assert.Equal(t, EventMilestone, retried.event.Type)
+	assert.Equal(t, wh.Id, retried.event.WebhookId)
+	assert.Equal(t, "video1", retried.event.VideoId)
+	assert.Equal(t, 2, retried.event.Threshold)
+
+	third := wait(t, deliveries)
+	assert.Equal(t, 3, third.event.Threshold)
+
+	t.Run("Milestones fire once", func(t *testing.T) {
+		require.NoError(t, svc.Increment(ctx, "video1"))
+		select {
+		case r := <-deliveries:
+			t.Fatalf("unexpected delivery %+v", r.event)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+}
+
+func TestDispatcherDeadLetters(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		statuses []int
+		attempts int
+	}{
+		{"Retries are exhausted", []int{500, 502, 503}, 3},
+		{"Client errors are not retried", []int{http.StatusGone}, 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := webhookrepository.NewInmemoryRepo()
+			server, deliveries := newReceiver(t, "s", tc.statuses...)
+			d, svc := startDispatcher(t, repo)
+
+			wh, _ := repo.CreateWebhook(ctx, model.Webhook{URL: server.URL, Secret: "s", VideoId: "video1", Thresholds: []int{1}})
+			d.Invalidate()
+			require.NoError(t, svc.Increment(ctx, "video2"))
+			require.NoError(t, svc.Increment(ctx, "video1"))
+			for i := 0; i < tc.attempts; i++ {
+				assert.Equal(t, "video1", wait(t, deliveries).event.VideoId)
+			}
+
+			var letters []model.DeadLetter
+			require.Eventually(t, func() bool {
+				letters, _ = repo.ListDeadLetters(ctx)
+				return len(letters) == 1
+			}, time.Second, 5*time.Millisecond)
+			assert.Equal(t, wh.Id, letters[0].WebhookId)
+			assert.Equal(t, tc.attempts, letters[0].Attempts)
+			assert.Contains(t, string(letters[0].Payload), `"video_id":"video1"`)
+		})
+	}
+}
+
+func TestDispatcherCachesWebhooks(t *testing.T) {
+	ctx := context.Background()
+	repo := &countingRepo{Repository: webhookrepository.NewInmemoryRepo()}
+	server, deliveries := newReceiver(t, "s")
+	d, svc := startDispatcher(t, repo)
+
+	require.NoError(t, svc.Increment(ctx, "video0"))
+	require.Eventually(t, func() bool { return repo.lists.Load() == 1 }, time.Second, time.Millisecond)
+
+	// the webhook is not seen until the cache is invalidated.
+	_, err := repo.CreateWebhook(ctx, model.Webhook{URL: server.URL, Secret: "s", Thresholds: []int{1}})
+	require.NoError(t, err)
+	require.NoError(t, svc.Increment(ctx, "video0"))
+	select {
+	case r := <-deliveries:
+		t.Fatalf("unexpected delivery %+v", r.event)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	d.Invalidate()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, svc.Increment(ctx, "video1"))
+	}
+	assert.Equal(t, "video1", wait(t, deliveries).event.VideoId)
+	assert.Equal(t, int32(2), repo.lists.Load(), "webhooks are listed once per invalidation")
+}